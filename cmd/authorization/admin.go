@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"ozon-task/pkg/variables"
+	"ozon-task/services/authorization/usecase"
+)
+
+// createAdmin bootstraps an admin: `create-admin -login <login>`. The
+// password can be passed in ADMIN_PASSWORD instead of the flag, so it does
+// not end up in the shell history.
+func createAdmin(core *usecase.Core, args []string) error {
+	flags := flag.NewFlagSet(variables.CreateAdminCommand, flag.ContinueOnError)
+	login := flags.String("login", "", "admin login")
+	password := flags.String("password", "", "admin password, $"+variables.AdminPasswordEnv+" by default")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *password == "" {
+		*password = os.Getenv(variables.AdminPasswordEnv)
+	}
+
+	if *login == "" || *password == "" {
+		flags.Usage()
+		return fmt.Errorf(variables.CreateAdminUsageError)
+	}
+
+	user, err := core.BootstrapAdmin(context.Background(), *login, *password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (id %d) is now %s\n", user.Login, user.Id, user.Role)
+	return nil
+}
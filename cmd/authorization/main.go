@@ -5,6 +5,8 @@ import (
 	"log/slog"
 	"os"
 	"ozon-task/configs"
+	"ozon-task/database"
+	"ozon-task/pkg/migrations"
 	"ozon-task/pkg/variables"
 	delivery_grpc "ozon-task/services/authorization/delivery/grpc"
 	delivery "ozon-task/services/authorization/delivery/http"
@@ -42,25 +44,49 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == variables.MigrateCommand {
+		err = migrations.Command(relationalDataBaseConfig, database.AuthorizationMigrations(), os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Error(variables.MigrateError, "error", err.Error())
+			fmt.Println(variables.MigrateError+":", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cacheDatabaseConfig, err := configs.ReadCacheDatabaseConfig()
 	if err != nil {
 		logger.Error(variables.ReadAuthCacheConfigError, err.Error())
 		return
 	}
 
-	core, err := usecase.GetCore(relationalDataBaseConfig, cacheDatabaseConfig, logger)
+	core, err := usecase.GetCore(relationalDataBaseConfig, cacheDatabaseConfig, authAppConfig, logger)
 	if err != nil {
 		logger.Error(variables.CoreInitializeError, err)
 		return
 	}
 
-	grpcServer, err := delivery_grpc.NewServer(relationalDataBaseConfig, cacheDatabaseConfig, logger)
+	if len(os.Args) > 1 && os.Args[1] == variables.CreateAdminCommand {
+		err = createAdmin(core, os.Args[2:])
+		if err != nil {
+			logger.Error(variables.CreateAdminError, "error", err.Error())
+			fmt.Println(variables.CreateAdminError+":", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	grpcServer, err := delivery_grpc.NewServer(relationalDataBaseConfig, cacheDatabaseConfig, &authAppConfig.Session, logger)
 	if err != nil {
 		logger.Error(variables.ListenAndServeError)
 		return
 	}
 
-	api := delivery.GetAuthorizationApi(core, logger)
+	api, err := delivery.GetAuthorizationApi(core, authAppConfig, logger)
+	if err != nil {
+		logger.Error(variables.ReadAuthConfigError, "error", err.Error())
+		return
+	}
 
 	errs := make(chan error, 2)
 	go func() {
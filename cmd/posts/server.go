@@ -7,9 +7,13 @@ import (
 	"net/http"
 	"os"
 	"ozon-task/configs"
+	"ozon-task/database"
 	"ozon-task/pkg/middleware"
+	"ozon-task/pkg/migrations"
+	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/posts/delivery/graph"
+	"ozon-task/services/posts/delivery/loaders"
 	"ozon-task/services/posts/usecase"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -38,6 +42,16 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == variables.MigrateCommand {
+		err = migrations.Command(relationalDataBaseConfig, database.PostsMigrations(), os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Error(variables.MigrateError, "error", err.Error())
+			fmt.Println(variables.MigrateError+":", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cacheDatabaseConfig, err := configs.ReadCacheDatabaseConfig()
 	if err != nil {
 		logger.Error(variables.ReadAuthCacheConfigError, err.Error())
@@ -48,11 +62,17 @@ func main() {
 		logger.Error("failed to parse grpc configs file: %s", err.Error())
 		return
 	}
-	core, err := usecase.GetCore(relationalDataBaseConfig, cacheDatabaseConfig, grpcCfg, postsAppConfig.InMemory, logger)
+	core, err := usecase.GetCore(relationalDataBaseConfig, cacheDatabaseConfig, grpcCfg, postsAppConfig, logger)
 	if err != nil {
 		logger.Error(variables.CoreInitializeError, err)
 		return
 	}
+	trustedProxies, err := util.ParseTrustedProxies(postsAppConfig.TrustedProxies)
+	if err != nil {
+		logger.Error(variables.ReadAuthConfigError, "error", err.Error())
+		return
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = defaultPort
@@ -63,10 +83,17 @@ func main() {
 		Log:  logger,
 	}
 
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{
+		Resolvers:  resolver,
+		Directives: resolver.Directives(),
+	}))
+	srv.AroundOperations(resolver.RateLimitOperations)
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", middleware.AuthorizationMiddleware(srv, core, logger))
+	// Reads are public, mutations and subscriptions are guarded by the
+	// @auth directive of the schema. POSTs with the session cookie need the
+	// CSRF token.
+	http.Handle("/query", middleware.CSRFMiddleware(middleware.OptionalAuthorizationMiddleware(middleware.ResponseContextMiddleware(loaders.LoadersMiddleware(srv, core), trustedProxies), core, postsAppConfig.Cookies.Secure, logger), logger))
 
 	log.Printf("Server Post with GraphQL running on %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
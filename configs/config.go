@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"ozon-task/pkg/variables"
+	"strconv"
 	"syscall"
 
 	"gopkg.in/yaml.v2"
@@ -39,15 +40,51 @@ func ParseFlagsAndReadYAMLFile[T any](fileName string, defaultFilePath string, f
 }
 
 func ReadAuthAppConfig() (*variables.AppConfig, error) {
-	return ParseFlagsAndReadYAMLFile[variables.AppConfig]("auth_config_path", "configs/AuthorizationAppConfig.yml", flag.CommandLine)
+	return withEnvironment(ParseFlagsAndReadYAMLFile[variables.AppConfig]("auth_config_path", "configs/AuthorizationAppConfig.yml", flag.CommandLine))
 }
 
 func ReadGrpcConfig() (*variables.GrpcConfig, error) {
-	return ParseFlagsAndReadYAMLFile[variables.GrpcConfig]("grpc_config_path", "configs/GrpcConfig.yml", flag.CommandLine)
+	config, err := ParseFlagsAndReadYAMLFile[variables.GrpcConfig]("grpc_config_path", "configs/GrpcConfig.yml", flag.CommandLine)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("grpc config is empty")
+	}
+
+	if value := os.Getenv(variables.ServiceSecretEnv); value != "" {
+		config.Secret = value
+	}
+
+	return config, nil
 }
 
 func ReadPostsAppConfig() (*variables.AppConfig, error) {
-	return ParseFlagsAndReadYAMLFile[variables.AppConfig]("posts_config_path", "configs/PostsAppConfig.yml", flag.CommandLine)
+	return withEnvironment(ParseFlagsAndReadYAMLFile[variables.AppConfig]("posts_config_path", "configs/PostsAppConfig.yml", flag.CommandLine))
+}
+
+// withEnvironment applies the environment overrides to an app config, so
+// one config file serves every deployment.
+func withEnvironment(config *variables.AppConfig, err error) (*variables.AppConfig, error) {
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("app config is empty")
+	}
+
+	if value := os.Getenv(variables.CookiesSecureEnv); value != "" {
+		config.Cookies.Secure, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", variables.CookiesSecureEnv, err)
+		}
+	}
+
+	if value := os.Getenv(variables.TokenSecretEnv); value != "" {
+		config.Token.Secret = value
+	}
+
+	return config, nil
 }
 
 func ReadRelationalAuthDataBaseConfig() (*variables.RelationalDataBaseConfig, error) {
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS ban;
+DROP TABLE IF EXISTS role_permission;
+DROP TABLE IF EXISTS permission;
+DROP TABLE IF EXISTS profile;
+DROP TABLE IF EXISTS role;
+DROP TABLE IF EXISTS profile_role;
+DROP TABLE IF EXISTS password;
@@ -0,0 +1,80 @@
+-- Создание таблицы password
+CREATE TABLE IF NOT EXISTS password (
+                          id SERIAL PRIMARY KEY,
+                          value BYTEA
+);
+
+-- Создание таблицы profile_role
+CREATE TABLE IF NOT EXISTS profile_role (
+                              id SERIAL PRIMARY KEY,
+                              profile_id INT,
+                              role_id INT
+);
+
+-- Создание таблицы profile
+CREATE TABLE IF NOT EXISTS profile (
+                         id SERIAL PRIMARY KEY,
+                         login TEXT NOT NULL UNIQUE,
+                         password_id INT NOT NULL,
+                         profile_role_id INT,
+                         CONSTRAINT fk_password FOREIGN KEY (password_id) REFERENCES password (id),
+                         CONSTRAINT fk_profile_role FOREIGN KEY (profile_role_id) REFERENCES profile_role (id)
+);
+
+-- Создание таблицы role
+CREATE TABLE IF NOT EXISTS role (
+                      id SERIAL PRIMARY KEY,
+                      value TEXT
+);
+
+-- Роли заводятся по порядку: user и admin получают id 1 и 2
+INSERT INTO role(value)
+SELECT seed.value FROM (VALUES (1, 'user'), (2, 'admin'), (3, 'moderator')) AS seed(position, value)
+WHERE NOT EXISTS (SELECT 1 FROM role WHERE role.value = seed.value)
+ORDER BY seed.position;
+
+-- Заполнение profile_role_id для профилей, созданных до его появления
+UPDATE profile SET profile_role_id = profile_role.id
+FROM profile_role
+WHERE profile_role.profile_id = profile.id AND profile.profile_role_id IS NULL;
+
+-- Создание таблицы permission
+CREATE TABLE IF NOT EXISTS permission (
+                            id SERIAL PRIMARY KEY,
+                            value TEXT NOT NULL UNIQUE
+);
+
+-- Создание таблицы role_permission
+CREATE TABLE IF NOT EXISTS role_permission (
+                                 role_id INT NOT NULL,
+                                 permission_id INT NOT NULL,
+                                 PRIMARY KEY (role_id, permission_id),
+                                 CONSTRAINT fk_role FOREIGN KEY (role_id) REFERENCES role (id),
+                                 CONSTRAINT fk_permission FOREIGN KEY (permission_id) REFERENCES permission (id)
+);
+
+INSERT INTO permission(value) VALUES
+    ('post:create'), ('post:update:any'), ('post:delete:any'),
+    ('comment:create'), ('comment:update:any'), ('comment:delete:any'), ('comment:moderate'),
+    ('user:ban'), ('user:manage'), ('post:moderate')
+ON CONFLICT (value) DO NOTHING;
+
+INSERT INTO role_permission(role_id, permission_id)
+SELECT role.id, permission.id FROM role, permission
+WHERE role.value = 'admin'
+   OR (role.value = 'moderator' AND permission.value IN ('post:create', 'comment:create', 'post:delete:any',
+                                                         'comment:delete:any', 'comment:moderate', 'user:ban',
+                                                         'post:moderate'))
+   OR (role.value = 'user' AND permission.value IN ('post:create', 'comment:create'))
+ON CONFLICT DO NOTHING;
+
+-- Создание таблицы ban
+CREATE TABLE IF NOT EXISTS ban (
+                     profile_id INT PRIMARY KEY,
+                     until TIMESTAMPTZ,
+                     reason TEXT NOT NULL DEFAULT '',
+                     banned_by INT,
+                     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                     CONSTRAINT fk_ban_profile FOREIGN KEY (profile_id) REFERENCES profile (id),
+                     CONSTRAINT fk_ban_banned_by FOREIGN KEY (banned_by) REFERENCES profile (id)
+);
@@ -0,0 +1,26 @@
+DROP INDEX IF EXISTS ban_banned_by_idx;
+DROP INDEX IF EXISTS role_permission_permission_id_idx;
+DROP INDEX IF EXISTS profile_profile_role_id_idx;
+DROP INDEX IF EXISTS profile_password_id_idx;
+DROP INDEX IF EXISTS profile_role_role_id_idx;
+DROP INDEX IF EXISTS profile_role_profile_id_idx;
+
+ALTER TABLE role_permission
+    DROP CONSTRAINT fk_role,
+    DROP CONSTRAINT fk_permission,
+    ADD CONSTRAINT fk_role FOREIGN KEY (role_id) REFERENCES role (id),
+    ADD CONSTRAINT fk_permission FOREIGN KEY (permission_id) REFERENCES permission (id);
+
+ALTER TABLE ban
+    DROP CONSTRAINT fk_ban_profile,
+    DROP CONSTRAINT fk_ban_banned_by,
+    ADD CONSTRAINT fk_ban_profile FOREIGN KEY (profile_id) REFERENCES profile (id),
+    ADD CONSTRAINT fk_ban_banned_by FOREIGN KEY (banned_by) REFERENCES profile (id);
+
+ALTER TABLE profile
+    DROP CONSTRAINT fk_profile_role,
+    ADD CONSTRAINT fk_profile_role FOREIGN KEY (profile_role_id) REFERENCES profile_role (id);
+
+ALTER TABLE profile_role
+    DROP CONSTRAINT fk_profile_role_role,
+    DROP CONSTRAINT fk_profile_role_profile;
@@ -0,0 +1,35 @@
+-- Роли профилей, которых уже нет
+DELETE FROM profile_role
+WHERE profile_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM profile WHERE profile.id = profile_role.profile_id)
+  AND NOT EXISTS (SELECT 1 FROM profile WHERE profile.profile_role_id = profile_role.id);
+
+-- Роль профиля удаляется вместе с профилем
+ALTER TABLE profile_role
+    ADD CONSTRAINT fk_profile_role_profile FOREIGN KEY (profile_id) REFERENCES profile (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_profile_role_role FOREIGN KEY (role_id) REFERENCES role (id);
+
+ALTER TABLE profile
+    DROP CONSTRAINT fk_profile_role,
+    ADD CONSTRAINT fk_profile_role FOREIGN KEY (profile_role_id) REFERENCES profile_role (id) ON DELETE SET NULL;
+
+-- Бан удаляется вместе с профилем, бан от удалённого профиля остаётся
+ALTER TABLE ban
+    DROP CONSTRAINT fk_ban_profile,
+    DROP CONSTRAINT fk_ban_banned_by,
+    ADD CONSTRAINT fk_ban_profile FOREIGN KEY (profile_id) REFERENCES profile (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_ban_banned_by FOREIGN KEY (banned_by) REFERENCES profile (id) ON DELETE SET NULL;
+
+ALTER TABLE role_permission
+    DROP CONSTRAINT fk_role,
+    DROP CONSTRAINT fk_permission,
+    ADD CONSTRAINT fk_role FOREIGN KEY (role_id) REFERENCES role (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_permission FOREIGN KEY (permission_id) REFERENCES permission (id) ON DELETE CASCADE;
+
+-- Индексы для соединений по профилю и для проверок внешних ключей
+CREATE INDEX IF NOT EXISTS profile_role_profile_id_idx ON profile_role (profile_id);
+CREATE INDEX IF NOT EXISTS profile_role_role_id_idx ON profile_role (role_id);
+CREATE INDEX IF NOT EXISTS profile_password_id_idx ON profile (password_id);
+CREATE INDEX IF NOT EXISTS profile_profile_role_id_idx ON profile (profile_role_id);
+CREATE INDEX IF NOT EXISTS role_permission_permission_id_idx ON role_permission (permission_id);
+CREATE INDEX IF NOT EXISTS ban_banned_by_idx ON ban (banned_by);
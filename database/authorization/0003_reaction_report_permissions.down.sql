@@ -0,0 +1 @@
+DELETE FROM permission WHERE value IN ('reaction:create', 'content:report');
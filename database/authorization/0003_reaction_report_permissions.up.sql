@@ -0,0 +1,8 @@
+-- Реакции и жалобы требуют прав, которые бан отнимает
+INSERT INTO permission(value) VALUES ('reaction:create'), ('content:report')
+ON CONFLICT (value) DO NOTHING;
+
+INSERT INTO role_permission(role_id, permission_id)
+SELECT role.id, permission.id FROM role, permission
+WHERE role.value IN ('user', 'moderator', 'admin') AND permission.value IN ('reaction:create', 'content:report')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// The migrations of each service, applied with `<service> migrate up`.
+var (
+	//go:embed posts/*.sql
+	posts embed.FS
+	//go:embed authorization/*.sql
+	authorization embed.FS
+)
+
+func PostsMigrations() fs.FS {
+	files, _ := fs.Sub(posts, "posts")
+	return files
+}
+
+func AuthorizationMigrations() fs.FS {
+	files, _ := fs.Sub(authorization, "authorization")
+	return files
+}
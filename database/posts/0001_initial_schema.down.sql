@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS moderation_queue;
+DROP TABLE IF EXISTS reaction_counts;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
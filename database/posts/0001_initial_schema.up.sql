@@ -0,0 +1,102 @@
+CREATE TABLE IF NOT EXISTS posts (
+                                     id SERIAL PRIMARY KEY,
+                                     user_id INT NOT NULL DEFAULT 0,
+                                     content TEXT NOT NULL DEFAULT '',
+                                     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                     comments_allowed bool NOT NULL DEFAULT true,
+                                     comments_toggled_by INT,
+                                     comments_toggled_at TIMESTAMP,
+                                     comments_count INT NOT NULL DEFAULT 0,
+                                     trending_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+                                     moderation_status VARCHAR(16) NOT NULL DEFAULT 'APPROVED',
+                                     search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+                                        id SERIAL PRIMARY KEY,
+                                        user_id INT NOT NULL DEFAULT 0,
+                                        post_id INT NOT NULL DEFAULT 0,
+                                        parent_id INT NOT NULL DEFAULT 0,
+                                        content TEXT NOT NULL DEFAULT '',
+                                        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                        deleted BOOLEAN NOT NULL DEFAULT false,
+                                        moderation_status VARCHAR(16) NOT NULL DEFAULT 'APPROVED',
+                                        search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED
+);
+
+CREATE TABLE IF NOT EXISTS reactions (
+                                         target_type VARCHAR(16) NOT NULL,
+                                         target_id INT NOT NULL,
+                                         user_id INT NOT NULL,
+                                         kind VARCHAR(16) NOT NULL,
+                                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                         PRIMARY KEY (target_type, target_id, user_id, kind)
+);
+
+CREATE TABLE IF NOT EXISTS reaction_counts (
+                                               target_type VARCHAR(16) NOT NULL,
+                                               target_id INT NOT NULL,
+                                               kind VARCHAR(16) NOT NULL,
+                                               count INT NOT NULL DEFAULT 0,
+                                               PRIMARY KEY (target_type, target_id, kind)
+);
+
+CREATE TABLE IF NOT EXISTS moderation_queue (
+                                                id SERIAL PRIMARY KEY,
+                                                target_type VARCHAR(16) NOT NULL,
+                                                target_id INT NOT NULL,
+                                                queued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                                UNIQUE (target_type, target_id)
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+                                       target_type VARCHAR(16) NOT NULL,
+                                       target_id INT NOT NULL,
+                                       user_id INT NOT NULL,
+                                       reason TEXT NOT NULL DEFAULT '',
+                                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                       PRIMARY KEY (target_type, target_id, user_id)
+);
+
+-- Databases created by the old posts_service_migrations.sql already have
+-- posts and comments with their first columns, CREATE TABLE IF NOT EXISTS
+-- leaves them as they are. Bring them to the layout above.
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS comments_toggled_by INT,
+    ADD COLUMN IF NOT EXISTS comments_toggled_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS comments_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS trending_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(16) NOT NULL DEFAULT 'APPROVED',
+    ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS deleted BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(16) NOT NULL DEFAULT 'APPROVED',
+    ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+-- Counters of the existing posts. The trending score is ln of the sum of
+-- e^weight over the post and its comments, weight as in util.TrendingWeight,
+-- shifted by the largest weight so EXP doesn't overflow.
+WITH activity AS (
+    SELECT id AS post_id, created_at FROM posts
+    UNION ALL
+    SELECT post_id, created_at FROM comments WHERE NOT deleted AND moderation_status = 'APPROVED'
+), weights AS (
+    SELECT post_id, EXTRACT(EPOCH FROM created_at)::DOUBLE PRECISION / 86400 * LN(2) AS weight FROM activity
+), scores AS (
+    SELECT post_id, COUNT(*) - 1 AS comments_count, MAX(weight) AS top FROM weights GROUP BY post_id
+)
+UPDATE posts SET comments_count = scores.comments_count,
+                 trending_score = scores.top + (SELECT LN(SUM(EXP(weights.weight - scores.top))) FROM weights WHERE weights.post_id = scores.post_id)
+FROM scores
+WHERE posts.id = scores.post_id;
+
+CREATE INDEX IF NOT EXISTS posts_created_at_id_idx ON posts (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS posts_comments_count_id_idx ON posts (comments_count DESC, id DESC);
+CREATE INDEX IF NOT EXISTS posts_trending_score_id_idx ON posts (trending_score DESC, id DESC);
+CREATE INDEX IF NOT EXISTS posts_user_id_created_at_id_idx ON posts (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS comments_user_id_created_at_id_idx ON comments (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS comments_post_id_parent_id_created_at_id_idx ON comments (post_id, parent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS posts_search_vector_idx ON posts USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS comments_search_vector_idx ON comments USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS moderation_queue_queued_at_id_idx ON moderation_queue (queued_at, id);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS comments_parent_id_created_at_id_idx;
+
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS comments_parent_id_fkey,
+    DROP CONSTRAINT IF EXISTS comments_post_id_fkey;
+
+UPDATE comments SET parent_id = 0 WHERE parent_id IS NULL;
+
+ALTER TABLE comments
+    ALTER COLUMN parent_id SET NOT NULL,
+    ALTER COLUMN parent_id SET DEFAULT 0,
+    ALTER COLUMN post_id SET DEFAULT 0;
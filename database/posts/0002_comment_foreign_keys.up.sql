@@ -0,0 +1,27 @@
+-- Comments of posts deleted before the foreign key existed can't be reached
+-- anymore.
+DELETE FROM comments WHERE NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = comments.post_id);
+
+-- Top-level comments had parent 0, a reference needs NULL instead.
+ALTER TABLE comments
+    ALTER COLUMN post_id DROP DEFAULT,
+    ALTER COLUMN parent_id DROP DEFAULT,
+    ALTER COLUMN parent_id DROP NOT NULL;
+
+UPDATE comments SET parent_id = NULL WHERE parent_id = 0;
+
+-- Deleting a post takes its comments along. Comments themselves are only
+-- marked deleted, so the cascade on the parent only runs with the post.
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS comments_post_id_fkey,
+    DROP CONSTRAINT IF EXISTS comments_parent_id_fkey,
+    ADD CONSTRAINT comments_post_id_fkey FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    ADD CONSTRAINT comments_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+-- Replies of a comment, also the lookup behind the cascade of the parent.
+-- The post side is served by comments_post_id_parent_id_created_at_id_idx.
+CREATE INDEX IF NOT EXISTS comments_parent_id_created_at_id_idx ON comments (parent_id, created_at, id);
+
+-- Reactions, reports and the moderation queue point at a post or a comment
+-- by target_type, they can't have a foreign key and are still removed by
+-- the repository.
@@ -2,18 +2,32 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"ozon-task/pkg/models"
 	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
+	"strings"
+	"time"
 )
 
-type ICore interface {
-	GetUserId(ctx context.Context, sid string) (int64, error)
+type IRoleCore interface {
 	GetUserRole(ctx context.Context, id int64) (string, error)
 }
 
+type IRateLimitCore interface {
+	CheckRateLimit(ctx context.Context, scope string, ip string, userId int64) (time.Duration, error)
+}
+
+type ICore interface {
+	IRoleCore
+	GetUserId(ctx context.Context, sid string) (int64, *models.Session, error)
+	GetTokenUserId(ctx context.Context, token string) (int64, error)
+}
+
 func PanicMiddleware(next http.Handler, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -44,25 +58,192 @@ func MethodMiddleware(next http.Handler, methods []string, logger *slog.Logger)
 	})
 }
 
-func AuthorizationMiddleware(next http.Handler, core ICore, logger *slog.Logger) http.Handler {
+// RateLimitMiddleware turns away requests over the limits of the client IP
+// and of the signed in user with 429 and Retry-After. Every path has limits
+// of its own. Requests pass when the limits can not be checked.
+func RateLimitMiddleware(next http.Handler, core IRateLimitCore, trustedProxies []*net.IPNet, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, _ := r.Context().Value(variables.UserIDKey).(int64)
+		retryAfter, err := core.CheckRateLimit(r.Context(), r.URL.Path, util.ClientIP(r, trustedProxies), userId)
+		if err != nil {
+			logger.Error(variables.RateLimitError, "error", err.Error())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if retryAfter > 0 {
+			util.SetRetryAfter(w, retryAfter)
+			util.SendResponse(w, r, http.StatusTooManyRequests, nil, variables.TooManyRequestsError, nil, logger)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ResponseContextMiddleware keeps the client IP and, unless the request
+// upgrades to a websocket, the response writer in the context. Handlers that
+// only get the context, like gqlgen interceptors, can then set headers and
+// the status of the response.
+func ResponseContextMiddleware(next http.Handler, trustedProxies []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), variables.ClientIPKey, util.ClientIP(r, trustedProxies))
+		if r.Header.Get("Upgrade") == "" {
+			ctx = context.WithValue(ctx, variables.ResponseWriterKey, w)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CSRFMiddleware checks the double submitted token of requests that change
+// state with the session cookie: the X-CSRF-Token header has to match the
+// csrf_token cookie, which other sites can neither read nor set. Requests
+// with a bearer token carry no ambient credentials and pass as they are.
+func CSRFMiddleware(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, ok := bearerToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, err := r.Cookie(variables.SessionCookieName); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		csrfCookie, err := r.Cookie(variables.CSRFCookieName)
+		header := r.Header.Get(variables.CSRFHeader)
+		if err != nil || header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(csrfCookie.Value)) != 1 {
+			util.SendResponse(w, r, http.StatusForbidden, nil, variables.InvalidCSRFTokenError, nil, logger)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken returns the token of the Authorization header, if any.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get(variables.AuthorizationHeader)
+	if !strings.HasPrefix(header, variables.BearerPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, variables.BearerPrefix)), true
+}
+
+// AuthorizationMiddleware accepts a bearer access token or the session
+// cookie, the token wins when both are sent. secureCookies is the Secure
+// attribute of the cookie of a rotated session.
+func AuthorizationMiddleware(next http.Handler, core ICore, secureCookies bool, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			userId, err := core.GetTokenUserId(r.Context(), token)
+			if err != nil || userId == 0 {
+				util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.InvalidTokenError, err, logger)
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), variables.UserIDKey, userId))
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		session, err := r.Cookie(variables.SessionCookieName)
 		if err != nil {
 			util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.StatusUnauthorizedError, nil, logger)
 			return
 		}
 
-		userId, err := core.GetUserId(r.Context(), session.Value)
+		userId, rotated, err := core.GetUserId(r.Context(), session.Value)
 		if err != nil || userId == 0 {
 			util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.StatusUnauthorizedError, nil, logger)
 			return
 		}
+		setRotatedCookie(w, rotated, secureCookies)
 
-		r = r.WithContext(context.WithValue(r.Context(), variables.UserIDKey, userId))
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withSession(r, userId, session.Value, rotated))
+	})
+}
+
+// OptionalAuthorizationMiddleware attaches the user of a valid session to
+// the request like AuthorizationMiddleware, but lets requests without one
+// through anonymously. An invalid bearer token is still rejected, so the
+// client knows it has to refresh it.
+func OptionalAuthorizationMiddleware(next http.Handler, core ICore, secureCookies bool, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			userId, err := core.GetTokenUserId(r.Context(), token)
+			if err != nil || userId == 0 {
+				util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.InvalidTokenError, err, logger)
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), variables.UserIDKey, userId))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, err := r.Cookie(variables.SessionCookieName)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userId, rotated, err := core.GetUserId(r.Context(), session.Value)
+		if err != nil || userId == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		setRotatedCookie(w, rotated, secureCookies)
+
+		next.ServeHTTP(w, withSession(r, userId, session.Value, rotated))
 	})
 }
 
+// withSession attaches the user and the id of the session behind the
+// request, the new one when the session has just been rotated.
+func withSession(r *http.Request, userId int64, sid string, rotated *models.Session) *http.Request {
+	if rotated != nil {
+		sid = rotated.SID
+	}
+
+	ctx := context.WithValue(r.Context(), variables.UserIDKey, userId)
+	return r.WithContext(context.WithValue(ctx, variables.SessionIDKey, sid))
+}
+
+// setRotatedCookie hands the new id of a rotated session to the client.
+func setRotatedCookie(w http.ResponseWriter, rotated *models.Session, secure bool) {
+	if rotated == nil {
+		return
+	}
+
+	http.SetCookie(w, util.GetCookie(variables.SessionCookieName, rotated.SID, "/", variables.HttpOnly, secure, rotated.ExpiresAt))
+}
+
+// CheckRole tells whether the role of the user is one of roles. The role
+// itself is returned as well, so it can be kept in the context.
+func CheckRole(ctx context.Context, core IRoleCore, userId int64, roles []string) (string, bool, error) {
+	userRole, err := core.GetUserRole(ctx, userId)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, val := range roles {
+		if userRole == val {
+			return userRole, true, nil
+		}
+	}
+
+	return userRole, false, nil
+}
+
 func PermissionsMiddleware(next http.Handler, core ICore, roles []string, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userId, isAuth := r.Context().Value(variables.UserIDKey).(int64)
@@ -71,21 +252,13 @@ func PermissionsMiddleware(next http.Handler, core ICore, roles []string, logger
 			return
 		}
 
-		userRole, err := core.GetUserRole(r.Context(), userId)
+		userRole, isPermitted, err := CheckRole(r.Context(), core, userId, roles)
 		if err != nil {
 			util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.StatusInternalServerError, err, logger)
 			return
 		}
 		r = r.WithContext(context.WithValue(r.Context(), variables.RoleKey, userRole))
 
-		isPermitted := false
-		for _, val := range roles {
-			if userRole == val {
-				isPermitted = true
-				break
-			}
-		}
-
 		if !isPermitted {
 			util.SendResponse(w, r, http.StatusForbidden, nil, variables.StatusForbiddenError, nil, logger)
 			return
@@ -0,0 +1,61 @@
+package middleware_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"ozon-task/pkg/middleware"
+	"ozon-task/pkg/variables"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		session bool
+		cookie  string
+		header  string
+		bearer  bool
+		want    int
+	}{
+		{name: "safe method", method: http.MethodGet, session: true, want: http.StatusOK},
+		{name: "no session", method: http.MethodPost, want: http.StatusOK},
+		{name: "bearer token", method: http.MethodPost, session: true, bearer: true, want: http.StatusOK},
+		{name: "matching token", method: http.MethodPost, session: true, cookie: "token", header: "token", want: http.StatusOK},
+		{name: "missing header", method: http.MethodPost, session: true, cookie: "token", want: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodDelete, session: true, header: "token", want: http.StatusForbidden},
+		{name: "mismatched token", method: http.MethodPost, session: true, cookie: "token", header: "other", want: http.StatusForbidden},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.CSRFMiddleware(next, logger)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "/logout", nil)
+			if test.session {
+				r.AddCookie(&http.Cookie{Name: variables.SessionCookieName, Value: "sid"})
+			}
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: variables.CSRFCookieName, Value: test.cookie})
+			}
+			if test.header != "" {
+				r.Header.Set(variables.CSRFHeader, test.header)
+			}
+			if test.bearer {
+				r.Header.Set(variables.AuthorizationHeader, variables.BearerPrefix+"token")
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.want {
+				t.Errorf("status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"ozon-task/pkg/variables"
+	"time"
+)
+
+// Command runs `migrate up`, `migrate down [-steps N]` or `migrate status`
+// against the database of configDatabase and reports to out.
+func Command(configDatabase *variables.RelationalDataBaseConfig, files fs.FS, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf(variables.MigrateUsageError)
+	}
+
+	switch args[0] {
+	case "up", "down", "status":
+	default:
+		return fmt.Errorf(variables.MigrateUsageError)
+	}
+
+	flags := flag.NewFlagSet(variables.MigrateCommand+" "+args[0], flag.ContinueOnError)
+	steps := 1
+	if args[0] == "down" {
+		flags.IntVar(&steps, "steps", 1, "number of migrations to roll back")
+	}
+
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	db, err := Open(configDatabase)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := GetMigrator(db, files)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		report(out, "applied", done)
+		return err
+	case "down":
+		if steps < 1 {
+			return fmt.Errorf(variables.MigrateUsageError)
+		}
+		done, err := migrator.Down(ctx, steps)
+		report(out, "rolled back", done)
+		return err
+	case "status":
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf(variables.MigrateUsageError)
+}
+
+func report(out io.Writer, action string, done []Migration) {
+	if len(done) == 0 {
+		fmt.Fprintln(out, "nothing "+action)
+		return
+	}
+
+	for _, migration := range done {
+		fmt.Fprintf(out, "%s %04d_%s\n", action, migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1,304 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"ozon-task/pkg/variables"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+// Migration is one schema change, read from a pair of files named like
+// 0001_initial_schema.up.sql and 0001_initial_schema.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State is a migration with the time it was applied, nil while pending.
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the migrations of one database. Runs are serialized
+// with an advisory lock, so replicas starting together don't race.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations at the root of files in version order. Every
+// migration needs both scripts.
+func Load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf(variables.MigrationFileNameError+": %s", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(variables.MigrationFileNameError+": %s", entry.Name())
+		}
+
+		script, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf(variables.MigrationVersionTakenError+": %d", version)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf(variables.MigrationScriptMissingError+": %d_%s", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func GetMigrator(db *sql.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := Load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Open connects to the database the way the repositories do.
+func Open(configDatabase *variables.RelationalDataBaseConfig) (*sql.DB, error) {
+	dsn := fmt.Sprintf("user=%s dbname=%s password=%s host=%s port=%d sslmode=%s",
+		configDatabase.User, configDatabase.DbName, configDatabase.Password, configDatabase.Host, configDatabase.Port, configDatabase.Sslmode)
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// locked runs fn on a connection holding the migrations lock, with the
+// schema_migrations table in place. The lock is a session one, it is taken
+// and released on the same connection.
+func (migrator *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", variables.MigrationsLockKey)
+	if err != nil {
+		return fmt.Errorf(variables.MigrationLockError+": %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", variables.MigrationsLockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+// run applies one script and records it in the same transaction, so a
+// failed migration leaves nothing behind.
+func run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return fmt.Errorf(variables.MigrationApplyError+" %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up applies the pending migrations in version order and returns them.
+func (migrator *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := migrator.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			err = run(ctx, conn, migration, true)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns them.
+func (migrator *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := migrator.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		known := make(map[int64]Migration, len(migrator.migrations))
+		for _, migration := range migrator.migrations {
+			known[migration.Version] = migration
+		}
+
+		newest := make([]int64, 0, len(versions))
+		for version := range versions {
+			newest = append(newest, version)
+		}
+		sort.Slice(newest, func(i, j int) bool {
+			return newest[i] > newest[j]
+		})
+
+		for _, version := range newest {
+			if len(done) == steps {
+				break
+			}
+
+			migration, ok := known[version]
+			if !ok {
+				return fmt.Errorf(variables.MigrationUnknownError+": %d", version)
+			}
+
+			err = run(ctx, conn, migration, false)
+			if err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status lists the known migrations with the time each was applied.
+func (migrator *Migrator) Status(ctx context.Context) ([]State, error) {
+	var states []State
+	err := migrator.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.migrations {
+			state := State{Migration: migration}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				state.AppliedAt = &appliedAt
+			}
+			states = append(states, state)
+		}
+
+		return nil
+	})
+
+	return states, err
+}
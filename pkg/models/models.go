@@ -4,13 +4,43 @@ import "time"
 
 type (
 	Session struct {
-		Login     string
-		SID       string
+		Login string
+		SID   string
+		// ID is the hash of the SID the session is stored under. Listings
+		// show it, the SID itself is only known to the client.
+		ID        string
 		ExpiresAt time.Time
+		CreatedAt time.Time
+		LastSeen  time.Time
+		UserAgent string
+		IP        string
+		RotatedAt time.Time
+		// RotatedTo is the id that replaced this one during the grace
+		// period after a rotation.
+		RotatedTo string
+	}
+
+	// TokenPair is a signed access token together with the refresh token
+	// that renews it.
+	TokenPair struct {
+		AccessToken  string
+		ExpiresAt    time.Time
+		RefreshToken string
 	}
 
 	UserItem struct {
+		Id    int64  `json:"id"`
 		Login string `json:"login"`
+		Role  string `json:"role,omitempty"`
+	}
+
+	// Ban keeps a user out until Until, for good when it is nil.
+	Ban struct {
+		UserId    int64      `json:"user_id"`
+		Until     *time.Time `json:"until,omitempty"`
+		Reason    string     `json:"reason"`
+		BannedBy  int64      `json:"banned_by"`
+		CreatedAt time.Time  `json:"created_at"`
 	}
 
 	PostItem struct {
@@ -27,6 +57,17 @@ type (
 		CommentsAllowed bool      `json:"comments_allowed"`
 	}
 
+	UserActivity struct {
+		PostCount    int
+		CommentCount int
+	}
+
+	Cursor struct {
+		CreatedAt time.Time
+		ID        int
+		Score     float64
+	}
+
 	Comment struct {
 		ID        int       `json:"id"`
 		UserID    int       `json:"user_id"`
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"math/rand"
+	"ozon-task/pkg/variables"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Limiter counts requests in Redis, so the limits hold across all replicas
+// of a service.
+type Limiter struct {
+	client *redis.Client
+	config variables.RateLimitConfig
+}
+
+// LockedError tells how long a locked login stays locked.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (err *LockedError) Error() string {
+	return variables.AccountLockedError
+}
+
+func (err *LockedError) Unwrap() error {
+	return variables.ErrLocked
+}
+
+func GetLimiter(cacheConfig *variables.CacheDataBaseConfig, config *variables.RateLimitConfig) (*Limiter, error) {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cacheConfig.Host,
+		Password: cacheConfig.Password,
+		DB:       cacheConfig.DbNumber,
+	})
+
+	_, err := redisClient.Ping(context.Background()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{client: redisClient, config: *config}, nil
+}
+
+func ipKey(scope string, ip string) string {
+	return "ratelimit:" + scope + ":ip:" + ip
+}
+
+func userKey(scope string, userId int64) string {
+	return "ratelimit:" + scope + ":user:" + strconv.FormatInt(userId, 10)
+}
+
+func failuresKey(login string) string {
+	return "lockout:" + login + ":failures"
+}
+
+func lockedKey(login string) string {
+	return "lockout:" + login
+}
+
+// slidingWindowScript keeps the times of the requests of the window in a
+// sorted set. A request over the limit is not recorded and gets the time
+// until the oldest one leaves the window, in milliseconds.
+var slidingWindowScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1] - ARGV[2])
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return math.max(oldest[2] + ARGV[2] - ARGV[1], 1)
+`)
+
+// failureScript counts a failed password within the window and locks the
+// login once the count reaches the limit, returning the lock in milliseconds.
+var failureScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+if failures == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+if failures < tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], 1, 'PX', ARGV[3])
+return tonumber(ARGV[3])
+`)
+
+// Allow records a request of the ip and of the user, zero for guests, in
+// the scope. It returns how long the client has to wait when a limit is
+// reached and zero otherwise.
+func (limiter *Limiter) Allow(ctx context.Context, scope string, ip string, userId int64) (time.Duration, error) {
+	retryAfter, err := limiter.allow(ctx, ipKey(scope, ip), limiter.config.PerIP)
+	if err != nil || retryAfter > 0 {
+		return retryAfter, err
+	}
+
+	if userId == 0 {
+		return 0, nil
+	}
+
+	return limiter.allow(ctx, userKey(scope, userId), limiter.config.PerUser)
+}
+
+func (limiter *Limiter) allow(ctx context.Context, key string, rule variables.RateLimitRule) (time.Duration, error) {
+	if rule.Limit <= 0 || rule.Window <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	// The member only has to be unique, the score keeps the time.
+	member := strconv.FormatInt(now.UnixNano(), 10) + ":" + strconv.FormatInt(rand.Int63(), 10)
+	retryAfter, err := slidingWindowScript.Run(ctx, limiter.client, []string{key},
+		now.UnixMilli(), rule.Window.Milliseconds(), rule.Limit, member).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(retryAfter) * time.Millisecond, nil
+}
+
+// LockedFor returns how long the login stays locked, zero if it is not.
+func (limiter *Limiter) LockedFor(ctx context.Context, login string) (time.Duration, error) {
+	if limiter.config.Lockout.MaxFailures <= 0 {
+		return 0, nil
+	}
+
+	ttl, err := limiter.client.PTTL(ctx, lockedKey(login)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// AddFailure counts a failed password for the login. It returns the lock
+// when this failure locks the login and zero otherwise.
+func (limiter *Limiter) AddFailure(ctx context.Context, login string) (time.Duration, error) {
+	lockout := limiter.config.Lockout
+	if lockout.MaxFailures <= 0 || lockout.Window <= 0 || lockout.Duration <= 0 {
+		return 0, nil
+	}
+
+	locked, err := failureScript.Run(ctx, limiter.client, []string{failuresKey(login), lockedKey(login)},
+		lockout.Window.Milliseconds(), lockout.MaxFailures, lockout.Duration.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(locked) * time.Millisecond, nil
+}
+
+// ResetFailures forgets the failed passwords of the login after a
+// successful signin.
+func (limiter *Limiter) ResetFailures(ctx context.Context, login string) error {
+	if limiter.config.Lockout.MaxFailures <= 0 {
+		return nil
+	}
+
+	return limiter.client.Del(ctx, failuresKey(login)).Err()
+}
@@ -0,0 +1,181 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"ozon-task/pkg/ratelimit"
+	"ozon-task/pkg/variables"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func limiter(t *testing.T, config variables.RateLimitConfig) (*ratelimit.Limiter, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	limiter, err := ratelimit.GetLimiter(&variables.CacheDataBaseConfig{Host: server.Addr()}, &config)
+	if err != nil {
+		t.Fatalf("GetLimiter: %v", err)
+	}
+	return limiter, server
+}
+
+type request struct {
+	ip      string
+	userId  int64
+	limited bool
+}
+
+func TestAllow(t *testing.T) {
+	window := time.Minute
+	tests := []struct {
+		name     string
+		config   variables.RateLimitConfig
+		requests []request
+	}{
+		{
+			name:   "per ip",
+			config: variables.RateLimitConfig{PerIP: variables.RateLimitRule{Limit: 2, Window: window}},
+			requests: []request{
+				{ip: "10.0.0.1"},
+				{ip: "10.0.0.1"},
+				{ip: "10.0.0.1", limited: true},
+				{ip: "10.0.0.2"},
+			},
+		},
+		{
+			name: "per user",
+			config: variables.RateLimitConfig{
+				PerIP:   variables.RateLimitRule{Limit: 10, Window: window},
+				PerUser: variables.RateLimitRule{Limit: 1, Window: window},
+			},
+			requests: []request{
+				{ip: "10.0.0.1", userId: 1},
+				{ip: "10.0.0.2", userId: 1, limited: true},
+				{ip: "10.0.0.2", userId: 2},
+			},
+		},
+		{
+			name: "guests only per ip",
+			config: variables.RateLimitConfig{
+				PerIP:   variables.RateLimitRule{Limit: 10, Window: window},
+				PerUser: variables.RateLimitRule{Limit: 1, Window: window},
+			},
+			requests: []request{
+				{ip: "10.0.0.1"},
+				{ip: "10.0.0.1"},
+			},
+		},
+		{
+			name:   "disabled",
+			config: variables.RateLimitConfig{},
+			requests: []request{
+				{ip: "10.0.0.1", userId: 1},
+				{ip: "10.0.0.1", userId: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter, _ := limiter(t, test.config)
+			for i, request := range test.requests {
+				retryAfter, err := limiter.Allow(context.Background(), "/signin", request.ip, request.userId)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				if limited := retryAfter > 0; limited != request.limited {
+					t.Errorf("request %d limited %v, want %v", i, limited, request.limited)
+				}
+				if retryAfter > window {
+					t.Errorf("request %d retry after %v, longer than the window", i, retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowScopes(t *testing.T) {
+	limiter, _ := limiter(t, variables.RateLimitConfig{PerIP: variables.RateLimitRule{Limit: 1, Window: time.Minute}})
+	for _, scope := range []string{"/signin", "/signup"} {
+		retryAfter, err := limiter.Allow(context.Background(), scope, "10.0.0.1", 0)
+		if err != nil || retryAfter != 0 {
+			t.Errorf("first request of %s: %v, %v", scope, retryAfter, err)
+		}
+	}
+}
+
+func TestAllowWindowSlides(t *testing.T) {
+	window := 100 * time.Millisecond
+	limiter, _ := limiter(t, variables.RateLimitConfig{PerIP: variables.RateLimitRule{Limit: 1, Window: window}})
+
+	retryAfter, err := limiter.Allow(context.Background(), "/signin", "10.0.0.1", 0)
+	if err != nil || retryAfter != 0 {
+		t.Fatalf("first request: %v, %v", retryAfter, err)
+	}
+
+	retryAfter, err = limiter.Allow(context.Background(), "/signin", "10.0.0.1", 0)
+	if err != nil || retryAfter == 0 {
+		t.Fatalf("second request: %v, %v", retryAfter, err)
+	}
+
+	time.Sleep(window + 50*time.Millisecond)
+	retryAfter, err = limiter.Allow(context.Background(), "/signin", "10.0.0.1", 0)
+	if err != nil || retryAfter != 0 {
+		t.Errorf("request after the window: %v, %v", retryAfter, err)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	lockout := variables.LockoutConfig{MaxFailures: 3, Window: time.Minute, Duration: 10 * time.Minute}
+	limiter, server := limiter(t, variables.RateLimitConfig{Lockout: lockout})
+
+	for i := 1; i < lockout.MaxFailures; i++ {
+		locked, err := limiter.AddFailure(ctx, "alice")
+		if err != nil || locked != 0 {
+			t.Fatalf("failure %d: %v, %v", i, locked, err)
+		}
+	}
+
+	// A successful signin starts the count over.
+	err := limiter.ResetFailures(ctx, "alice")
+	if err != nil {
+		t.Fatalf("ResetFailures: %v", err)
+	}
+
+	var locked time.Duration
+	for i := 1; i <= lockout.MaxFailures; i++ {
+		locked, err = limiter.AddFailure(ctx, "alice")
+		if err != nil {
+			t.Fatalf("AddFailure: %v", err)
+		}
+	}
+	if locked != lockout.Duration {
+		t.Errorf("locked for %v, want %v", locked, lockout.Duration)
+	}
+
+	lockedFor, err := limiter.LockedFor(ctx, "alice")
+	if err != nil || lockedFor <= 0 || lockedFor > lockout.Duration {
+		t.Errorf("LockedFor = %v, %v", lockedFor, err)
+	}
+
+	lockedFor, err = limiter.LockedFor(ctx, "bob")
+	if err != nil || lockedFor != 0 {
+		t.Errorf("LockedFor of another login = %v, %v", lockedFor, err)
+	}
+
+	server.FastForward(lockout.Duration)
+	lockedFor, err = limiter.LockedFor(ctx, "alice")
+	if err != nil || lockedFor != 0 {
+		t.Errorf("LockedFor after the lock = %v, %v", lockedFor, err)
+	}
+}
+
+func TestLockedError(t *testing.T) {
+	var err error = &ratelimit.LockedError{RetryAfter: time.Minute}
+	if !errors.Is(err, variables.ErrLocked) {
+		t.Errorf("LockedError does not unwrap to ErrLocked")
+	}
+}
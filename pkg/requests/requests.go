@@ -1,5 +1,7 @@
 package communication
 
+import "time"
+
 type (
 	SigninRequest struct {
 		Login    string `json:"login"`
@@ -11,6 +13,23 @@ type (
 		Password string `json:"password"`
 	}
 
+	TokenRequest struct {
+		GrantType    string `json:"grant_type"`
+		Login        string `json:"login"`
+		Password     string `json:"password"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	SetRoleRequest struct {
+		Role string `json:"role"`
+	}
+
+	// BanRequest bans until the time, for good without it.
+	BanRequest struct {
+		Until  *time.Time `json:"until"`
+		Reason string     `json:"reason"`
+	}
+
 	BannerRequest struct {
 		TagIds    []int64 `json:"tag_ids"`
 		FeatureId int64   `json:"feature_id"`
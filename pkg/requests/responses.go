@@ -1,7 +1,40 @@
 package communication
 
+import (
+	"ozon-task/pkg/models"
+	"time"
+)
+
 type (
 	SignupResponse struct {
 		Login string `json:"login"`
 	}
+
+	TokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	SessionResponse struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		LastSeen  time.Time `json:"last_seen"`
+		ExpiresAt time.Time `json:"expires_at"`
+		UserAgent string    `json:"user_agent"`
+		IP        string    `json:"ip"`
+		Current   bool      `json:"current"`
+	}
+
+	UsersResponse struct {
+		Users    []*models.UserItem `json:"users"`
+		Total    int64              `json:"total"`
+		Page     uint64             `json:"page"`
+		PageSize uint64             `json:"page_size"`
+	}
+
+	LogoutAllResponse struct {
+		Revoked int64 `json:"revoked"`
+	}
 )
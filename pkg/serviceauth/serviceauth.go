@@ -0,0 +1,68 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"ozon-task/pkg/variables"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// CheckSecret refuses secrets anyone could guess, the secret is all that
+// stands between a caller and the privileged RPCs.
+func CheckSecret(secret string) error {
+	if len(secret) < variables.MinServiceSecretBytes {
+		return fmt.Errorf(variables.ServiceSecretError+": shorter than %d bytes, set $%s", variables.MinServiceSecretBytes, variables.ServiceSecretEnv)
+	}
+	return nil
+}
+
+// ServerInterceptor lets through only the calls that carry the shared
+// service secret.
+func ServerInterceptor(secret string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(variables.ServiceSecretMetadata)
+		if len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(secret)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, variables.ServiceUnauthenticatedError)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// WithActingUser names the user a call is made for. Only callers holding
+// the service secret get through, so the server can trust it where it
+// can't trust the request body.
+func WithActingUser(ctx context.Context, userId int64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, variables.ActingUserMetadata, strconv.FormatInt(userId, 10))
+}
+
+// ActingUser returns the user named with WithActingUser, false when the
+// call names none or more than one.
+func ActingUser(ctx context.Context) (int64, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(variables.ActingUserMetadata)
+	if len(values) != 1 {
+		return 0, false
+	}
+
+	userId, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || userId <= 0 {
+		return 0, false
+	}
+	return userId, true
+}
+
+// ClientInterceptor adds the shared service secret to every call.
+func ClientInterceptor(secret string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, variables.ServiceSecretMetadata, secret)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
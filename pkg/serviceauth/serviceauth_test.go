@@ -0,0 +1,174 @@
+package serviceauth_test
+
+import (
+	"context"
+	"net"
+	"ozon-task/pkg/serviceauth"
+	"ozon-task/pkg/variables"
+	"ozon-task/services/authorization/proto/authorization"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var secret = strings.Repeat("s", variables.MinServiceSecretBytes)
+
+func TestCheckSecret(t *testing.T) {
+	if err := serviceauth.CheckSecret(secret); err != nil {
+		t.Errorf("CheckSecret: %v", err)
+	}
+	if err := serviceauth.CheckSecret(secret[1:]); err == nil {
+		t.Errorf("CheckSecret accepted a short secret")
+	}
+	if err := serviceauth.CheckSecret(""); err == nil {
+		t.Errorf("CheckSecret accepted no secret")
+	}
+}
+
+func TestServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		want    codes.Code
+	}{
+		{name: "secret", secrets: []string{secret}, want: codes.OK},
+		{name: "no secret", want: codes.Unauthenticated},
+		{name: "wrong secret", secrets: []string{strings.Repeat("x", len(secret))}, want: codes.Unauthenticated},
+		{name: "prefix of the secret", secrets: []string{secret[1:]}, want: codes.Unauthenticated},
+		{name: "two secrets", secrets: []string{"guess", secret}, want: codes.Unauthenticated},
+	}
+
+	interceptor := serviceauth.ServerInterceptor(secret)
+	info := &grpc.UnaryServerInfo{FullMethod: "/authorization.Authorization/SetRole"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "handled", nil
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			md := metadata.MD{}
+			for _, value := range test.secrets {
+				md.Append(variables.ServiceSecretMetadata, value)
+			}
+
+			reply, err := interceptor(metadata.NewIncomingContext(context.Background(), md), nil, info, handler)
+			if code := status.Code(err); code != test.want {
+				t.Fatalf("code %v, want %v", code, test.want)
+			}
+			if test.want == codes.OK && reply != "handled" {
+				t.Errorf("reply %v, the handler didn't run", reply)
+			}
+		})
+	}
+}
+
+func TestClientInterceptor(t *testing.T) {
+	interceptor := serviceauth.ClientInterceptor(secret)
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		values := md.Get(variables.ServiceSecretMetadata)
+		if len(values) != 1 || values[0] != secret {
+			t.Errorf("outgoing secret %v", values)
+		}
+		return nil
+	}
+
+	err := interceptor(context.Background(), "/authorization.Authorization/GetId", nil, nil, nil, invoker)
+	if err != nil {
+		t.Errorf("interceptor: %v", err)
+	}
+}
+
+func TestActingUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   int64
+		wantOk bool
+	}{
+		{name: "user", values: []string{"42"}, want: 42, wantOk: true},
+		{name: "no user"},
+		{name: "two users", values: []string{"42", "7"}},
+		{name: "not a number", values: []string{"admin"}},
+		{name: "zero", values: []string{"0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			md := metadata.MD{}
+			for _, value := range test.values {
+				md.Append(variables.ActingUserMetadata, value)
+			}
+
+			userId, ok := serviceauth.ActingUser(metadata.NewIncomingContext(context.Background(), md))
+			if userId != test.want || ok != test.wantOk {
+				t.Errorf("ActingUser = %d, %v, want %d, %v", userId, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestWithActingUser(t *testing.T) {
+	ctx := serviceauth.WithActingUser(context.Background(), 42)
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	userId, ok := serviceauth.ActingUser(metadata.NewIncomingContext(context.Background(), md))
+	if userId != 42 || !ok {
+		t.Errorf("ActingUser = %d, %v, want 42, true", userId, ok)
+	}
+}
+
+type revokeStub struct {
+	authorization.UnimplementedAuthorizationServer
+}
+
+func (revokeStub) RevokeUserSessions(ctx context.Context, req *authorization.RevokeSessionsRequest) (*authorization.RevokeSessionsResponse, error) {
+	return &authorization.RevokeSessionsResponse{Revoked: 1}, nil
+}
+
+// TestRevokeUserSessions runs the interceptors over a connection, a caller
+// without the secret must not log anyone out.
+func TestRevokeUserSessions(t *testing.T) {
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer(grpc.UnaryInterceptor(serviceauth.ServerInterceptor(secret)))
+	authorization.RegisterAuthorizationServer(server, revokeStub{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	dial := func(opts ...grpc.DialOption) authorization.AuthorizationClient {
+		opts = append(opts,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}))
+		conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return authorization.NewAuthorizationClient(conn)
+	}
+
+	request := &authorization.RevokeSessionsRequest{Id: 1}
+	_, err := dial().RevokeUserSessions(context.Background(), request)
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("call without the secret: code %v, want %v", code, codes.Unauthenticated)
+	}
+
+	other := strings.Repeat("x", len(secret))
+	_, err = dial(grpc.WithUnaryInterceptor(serviceauth.ClientInterceptor(other))).RevokeUserSessions(context.Background(), request)
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("call with another secret: code %v, want %v", code, codes.Unauthenticated)
+	}
+
+	response, err := dial(grpc.WithUnaryInterceptor(serviceauth.ClientInterceptor(secret))).RevokeUserSessions(context.Background(), request)
+	if err != nil || response.GetRevoked() != 1 {
+		t.Errorf("call with the secret = %v, %v", response, err)
+	}
+}
@@ -0,0 +1,139 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"ozon-task/pkg/variables"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Manager signs and checks the access tokens. The user id is kept in the
+// subject, so a token can be checked without asking the authorization
+// service.
+type Manager struct {
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	issuer    string
+	accessTTL time.Duration
+}
+
+func GetManager(config *variables.TokenConfig) (*Manager, error) {
+	manager := &Manager{
+		issuer:    variables.TokenIssuer,
+		accessTTL: variables.AccessTokenTTL,
+	}
+	if config.Issuer != "" {
+		manager.issuer = config.Issuer
+	}
+	if config.AccessTTL > 0 {
+		manager.accessTTL = config.AccessTTL
+	}
+
+	switch config.Algorithm {
+	case "", variables.TokenAlgorithmHS256:
+		// A known or short secret lets anyone sign tokens, so the service
+		// refuses to start with one.
+		if config.Secret == variables.PlaceholderTokenSecret {
+			return nil, fmt.Errorf(variables.TokenConfigError+": placeholder secret, set $%s", variables.TokenSecretEnv)
+		}
+		if len(config.Secret) < variables.MinTokenSecretBytes {
+			return nil, fmt.Errorf(variables.TokenConfigError+": secret shorter than %d bytes, set $%s", variables.MinTokenSecretBytes, variables.TokenSecretEnv)
+		}
+		manager.method = jwt.SigningMethodHS256
+		manager.signKey = []byte(config.Secret)
+		manager.verifyKey = []byte(config.Secret)
+	case variables.TokenAlgorithmEdDSA:
+		manager.method = jwt.SigningMethodEdDSA
+		err := manager.readEdKeys(config)
+		if err != nil {
+			return nil, fmt.Errorf(variables.TokenConfigError+": %w", err)
+		}
+	default:
+		return nil, fmt.Errorf(variables.TokenConfigError+": unknown algorithm %s", config.Algorithm)
+	}
+
+	return manager, nil
+}
+
+// readEdKeys loads the configured keys. The public key can be left out when
+// the private one is set.
+func (manager *Manager) readEdKeys(config *variables.TokenConfig) error {
+	if config.PrivateKeyFile != "" {
+		data, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		key, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return err
+		}
+		manager.signKey = key
+		manager.verifyKey = key.(ed25519.PrivateKey).Public()
+	}
+
+	if config.PublicKeyFile != "" {
+		data, err := os.ReadFile(config.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+
+		key, err := jwt.ParseEdPublicKeyFromPEM(data)
+		if err != nil {
+			return err
+		}
+		manager.verifyKey = key
+	}
+
+	if manager.verifyKey == nil {
+		return fmt.Errorf("no key files")
+	}
+	return nil
+}
+
+// Sign issues an access token of the user and returns its expiry.
+func (manager *Manager) Sign(userId int64) (string, time.Time, error) {
+	if manager.signKey == nil {
+		return "", time.Time{}, fmt.Errorf(variables.TokenSignError + ": no private key")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(manager.accessTTL)
+	claims := jwt.RegisteredClaims{
+		Issuer:    manager.issuer,
+		Subject:   strconv.FormatInt(userId, 10),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	signed, err := jwt.NewWithClaims(manager.method, claims).SignedString(manager.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf(variables.TokenSignError+": %w", err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// Verify checks the signature and the expiry of the token and returns the
+// id of its user.
+func (manager *Manager) Verify(token string) (int64, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return manager.verifyKey, nil
+	}, jwt.WithValidMethods([]string{manager.method.Alg()}), jwt.WithIssuer(manager.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, fmt.Errorf(variables.InvalidTokenError+": %w", err)
+	}
+
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf(variables.InvalidTokenError+": %w", err)
+	}
+
+	return userId, nil
+}
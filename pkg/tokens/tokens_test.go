@@ -0,0 +1,164 @@
+package tokens_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"ozon-task/pkg/tokens"
+	"ozon-task/pkg/variables"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var secret = strings.Repeat("s", variables.MinTokenSecretBytes)
+
+func manager(t *testing.T, config *variables.TokenConfig) *tokens.Manager {
+	t.Helper()
+	manager, err := tokens.GetManager(config)
+	if err != nil {
+		t.Fatalf("GetManager: %v", err)
+	}
+	return manager
+}
+
+// sign makes a token the way a forger or a misconfigured issuer would.
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return token
+}
+
+func claims(subject string, expiresAt time.Time) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    variables.TokenIssuer,
+		Subject:   subject,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+}
+
+func TestGetManager(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  variables.TokenConfig
+		wantErr bool
+	}{
+		{name: "secret", config: variables.TokenConfig{Secret: secret}},
+		{name: "placeholder secret", config: variables.TokenConfig{Secret: variables.PlaceholderTokenSecret}, wantErr: true},
+		{name: "short secret", config: variables.TokenConfig{Secret: secret[1:]}, wantErr: true},
+		{name: "no secret", config: variables.TokenConfig{}, wantErr: true},
+		{name: "unknown algorithm", config: variables.TokenConfig{Algorithm: "RS256", Secret: secret}, wantErr: true},
+		{name: "EdDSA without keys", config: variables.TokenConfig{Algorithm: variables.TokenAlgorithmEdDSA}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := tokens.GetManager(&test.config)
+			if (err != nil) != test.wantErr {
+				t.Errorf("GetManager error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hmac := manager(t, &variables.TokenConfig{Secret: secret})
+	valid, _, err := hmac.Sign(42)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	now := time.Now()
+	otherIssuer := claims("42", now.Add(time.Minute))
+	otherIssuer.Issuer = "someone-else"
+	noExpiry := claims("42", now)
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name    string
+		token   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "valid", token: valid, want: 42},
+		{name: "expired", token: sign(t, jwt.SigningMethodHS256, []byte(secret), claims("42", now.Add(-time.Minute))), wantErr: true},
+		{name: "bad signature", token: sign(t, jwt.SigningMethodHS256, []byte(strings.Repeat("x", len(secret))), claims("42", now.Add(time.Minute))), wantErr: true},
+		{name: "tampered", token: valid[:len(valid)-2] + "AA", wantErr: true},
+		{name: "wrong alg", token: sign(t, jwt.SigningMethodHS512, []byte(secret), claims("42", now.Add(time.Minute))), wantErr: true},
+		{name: "other key type", token: sign(t, jwt.SigningMethodEdDSA, edKey, claims("42", now.Add(time.Minute))), wantErr: true},
+		{name: "alg none", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims("42", now.Add(time.Minute))), wantErr: true},
+		{name: "other issuer", token: sign(t, jwt.SigningMethodHS256, []byte(secret), otherIssuer), wantErr: true},
+		{name: "no expiry", token: sign(t, jwt.SigningMethodHS256, []byte(secret), noExpiry), wantErr: true},
+		{name: "bad subject", token: sign(t, jwt.SigningMethodHS256, []byte(secret), claims("alice", now.Add(time.Minute))), wantErr: true},
+		{name: "garbage", token: "not.a.token", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userId, err := hmac.Verify(test.token)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Verify error %v, want error %v", err, test.wantErr)
+			}
+			if userId != test.want {
+				t.Errorf("Verify = %d, want %d", userId, test.want)
+			}
+		})
+	}
+}
+
+func TestEdDSA(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "token.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	signer := manager(t, &variables.TokenConfig{Algorithm: variables.TokenAlgorithmEdDSA, PrivateKeyFile: keyFile})
+	token, expiresAt, err := signer.Sign(7)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !expiresAt.After(time.Now()) {
+		t.Errorf("token expires at %v", expiresAt)
+	}
+
+	userId, err := signer.Verify(token)
+	if err != nil || userId != 7 {
+		t.Errorf("Verify = %d, %v", userId, err)
+	}
+
+	// An HMAC token signed with the public key must not pass as EdDSA.
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	forged := sign(t, jwt.SigningMethodHS256, public, claims("7", time.Now().Add(time.Minute)))
+	_, err = signer.Verify(forged)
+	if err == nil {
+		t.Errorf("Verify accepted an HMAC token")
+	}
+}
@@ -1,17 +1,29 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log/slog"
-	"math/rand"
+	"math"
+	"net"
 	"net/http"
+	"ozon-task/pkg/models"
 	"ozon-task/pkg/variables"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
 )
 
 func SendResponse(w http.ResponseWriter, r *http.Request, status int, body any, errorMessage string, handlerError error, logger *slog.Logger) {
@@ -53,46 +65,403 @@ func GetRequestBody(w http.ResponseWriter, r *http.Request, requestObject any, l
 	return nil
 }
 
-func GetCookie(name string, value string, path string, httpOnly bool, expires time.Time) *http.Cookie {
+func GetCookie(name string, value string, path string, httpOnly bool, secure bool, expires time.Time) *http.Cookie {
 	return &http.Cookie{
 		Name:     name,
 		Value:    value,
 		Path:     path,
 		Expires:  expires,
 		HttpOnly: httpOnly,
+		Secure:   secure,
+		SameSite: variables.CookieSameSite,
+	}
+}
+
+// ParseTrustedProxies reads the addresses of the proxies allowed to name
+// the client, single IPs or CIDR ranges.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		// A single address is a range of one.
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf(variables.InvalidTrustedProxyError+": %s", proxy)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// ClientIP returns the address of the client. Behind nginx it is taken
+// from the X-Real-IP header the proxy sets, but only when the request comes
+// from one of the trusted proxies: anyone else could rotate the header to
+// get past the rate limits.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ip := r.Header.Get(variables.RealIPHeader); ip != "" && isTrustedProxy(host, trustedProxies) {
+		return ip
 	}
+	return host
 }
 
-func RandStringRunes(seed int) string {
-	symbols := make([]rune, seed)
-	for i := range symbols {
-		symbols[i] = variables.LetterRunes[rand.Intn(len(variables.LetterRunes))]
+func isTrustedProxy(host string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
 	}
-	return string(symbols)
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
-func RandInt() int {
-	rand.Seed(time.Now().UnixNano())
-	return rand.Intn(1000000000)
+// RetryAfterSeconds rounds the wait up to whole seconds, as Retry-After
+// takes them.
+func RetryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Max(1, math.Ceil(retryAfter.Seconds())))
 }
 
-func HashPassword(password string) []byte {
-	hashPassword := sha512.Sum512([]byte(password))
-	passwordByteSlice := hashPassword[:]
-	return passwordByteSlice
+func SetRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set(variables.RetryAfterHeader, strconv.Itoa(RetryAfterSeconds(retryAfter)))
+}
+
+// RandomToken returns size bytes from crypto/rand, URL safe base64 encoded.
+func RandomToken(size int) (string, error) {
+	token := make([]byte, size)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// HashSessionID is the form session ids are stored in, so whoever reads the
+// store can not take over the sessions.
+func HashSessionID(sid string) string {
+	hash := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(hash[:])
+}
+
+const argon2Prefix = "$argon2id$"
+
+func passwordHashParams(config *variables.PasswordHashConfig) variables.PasswordHashConfig {
+	params := variables.PasswordHashConfig{
+		Time:       variables.Argon2Time,
+		Memory:     variables.Argon2Memory,
+		Threads:    variables.Argon2Threads,
+		KeyLength:  variables.Argon2KeyLength,
+		SaltLength: variables.Argon2SaltLength,
+	}
+	if config == nil {
+		return params
+	}
+
+	if config.Time != 0 {
+		params.Time = config.Time
+	}
+	if config.Memory != 0 {
+		params.Memory = config.Memory
+	}
+	if config.Threads != 0 {
+		params.Threads = config.Threads
+	}
+	if config.KeyLength != 0 {
+		params.KeyLength = config.KeyLength
+	}
+	if config.SaltLength != 0 {
+		params.SaltLength = config.SaltLength
+	}
+	return params
 }
 
+// SessionParams applies the defaults to the session config. Without an idle
+// timeout sessions only expire at the absolute one.
+func SessionParams(config *variables.SessionConfig) variables.SessionConfig {
+	params := variables.SessionConfig{
+		AbsoluteTimeout: variables.SessionAbsoluteTimeout,
+	}
+	if config == nil {
+		params.IdleTimeout = params.AbsoluteTimeout
+		return params
+	}
+
+	if config.AbsoluteTimeout > 0 {
+		params.AbsoluteTimeout = config.AbsoluteTimeout
+	}
+	params.IdleTimeout = params.AbsoluteTimeout
+	if config.IdleTimeout > 0 && config.IdleTimeout < params.AbsoluteTimeout {
+		params.IdleTimeout = config.IdleTimeout
+	}
+	if config.RotationInterval > 0 {
+		params.RotationInterval = config.RotationInterval
+	}
+	return params
+}
+
+// HashPassword hashes the password with argon2id and a random salt. The
+// parameters are kept next to the hash in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>.
+func HashPassword(password string, config *variables.PasswordHashConfig) ([]byte, error) {
+	params := passwordHashParams(config)
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	encoded := fmt.Sprintf(argon2Prefix+"v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+// VerifyPassword checks the password against a stored hash. needsRehash
+// tells that the hash is a legacy unsalted SHA-512 one or was made with
+// other parameters than the configured ones.
+func VerifyPassword(password string, hash []byte, config *variables.PasswordHashConfig) (bool, bool, error) {
+	if !strings.HasPrefix(string(hash), argon2Prefix) {
+		legacyHash := sha512.Sum512([]byte(password))
+		return subtle.ConstantTimeCompare(legacyHash[:], hash) == 1, true, nil
+	}
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return false, false, fmt.Errorf(variables.InvalidPasswordHashError)
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return false, false, fmt.Errorf(variables.InvalidPasswordHashError+": %w", err)
+	}
+
+	var stored variables.PasswordHashConfig
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &stored.Memory, &stored.Time, &stored.Threads)
+	if err != nil {
+		return false, false, fmt.Errorf(variables.InvalidPasswordHashError+": %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf(variables.InvalidPasswordHashError+": %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf(variables.InvalidPasswordHashError+": %w", err)
+	}
+
+	stored.KeyLength = uint32(len(key))
+	stored.SaltLength = uint32(len(salt))
+	passwordKey := argon2.IDKey([]byte(password), salt, stored.Time, stored.Memory, stored.Threads, stored.KeyLength)
+	if subtle.ConstantTimeCompare(passwordKey, key) != 1 {
+		return false, false, nil
+	}
+
+	return true, version != argon2.Version || stored != passwordHashParams(config), nil
+}
+
+// Pagination reads the page number and size of the request. Pages start at
+// 1, the size is capped by MaxPageSize.
 func Pagination(r *http.Request) (uint64, uint64) {
 	page, err := strconv.ParseUint(r.URL.Query().Get(variables.PaginationPageNumber), 10, 64)
-	if err != nil {
-		page = 12
+	if err != nil || page == 0 {
+		page = 1
 	}
 	pageSize, err := strconv.ParseUint(r.URL.Query().Get(variables.PaginationPageSize), 10, 64)
+	if err != nil || pageSize == 0 {
+		pageSize = variables.PageSize
+	}
+	if pageSize > variables.MaxPageSize {
+		pageSize = variables.MaxPageSize
+	}
+
+	return page, pageSize
+}
+
+// EncodeCursor packs the keyset position of a row into an opaque string.
+func EncodeCursor(cursor models.Cursor) string {
+	var createdAt int64
+	if !cursor.CreatedAt.IsZero() {
+		createdAt = cursor.CreatedAt.UnixNano()
+	}
+
+	raw := strconv.FormatInt(createdAt, 10) + ":" + strconv.Itoa(cursor.ID) + ":" + strconv.FormatFloat(cursor.Score, 'g', -1, 64)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor is the reverse of EncodeCursor. An empty string means
+// "from the beginning" and decodes to nil.
+func DecodeCursor(encoded string) (*models.Cursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf(variables.InvalidCursor+": %w", err)
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf(variables.InvalidCursor)
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf(variables.InvalidCursor+": %w", err)
+	}
+
+	cursorId, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf(variables.InvalidCursor+": %w", err)
+	}
+
+	score, err := strconv.ParseFloat(parts[2], 64)
 	if err != nil {
-		pageSize = 1
+		return nil, fmt.Errorf(variables.InvalidCursor+": %w", err)
+	}
+
+	cursor := &models.Cursor{ID: cursorId, Score: score}
+	if nanos != 0 {
+		cursor.CreatedAt = time.Unix(0, nanos).UTC()
+	}
+
+	return cursor, nil
+}
+
+// NodeCursor builds the cursor of a graph node from its id and created_at.
+func NodeCursor(id string, createdAt string) (string, error) {
+	nodeId, err := strconv.Atoi(id)
+	if err != nil {
+		return "", fmt.Errorf(variables.InvalidCursor+": %w", err)
+	}
+
+	nodeCreatedAt, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return "", fmt.Errorf(variables.InvalidCursor+": %w", err)
+	}
+
+	return EncodeCursor(models.Cursor{CreatedAt: nodeCreatedAt, ID: nodeId}), nil
+}
+
+// TrendingWeight is the logarithm of the weight of an activity at t in the
+// trending score. The weight doubles every TrendingHalfLife seconds, which
+// ranks the same as halving every older activity, so stored scores never
+// need to be decayed.
+func TrendingWeight(t time.Time) float64 {
+	return float64(t.Unix()) / variables.TrendingHalfLife * math.Ln2
+}
+
+// Tokenize splits text into lower-cased words for the search indexes.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Highlight returns a fragment of text around the first word matching one
+// of tokens, with every matching word wrapped into <b></b>. The text is
+// escaped, the only markup in the fragment is the highlighting.
+func Highlight(text string, tokens []string) string {
+	matches := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		matches[token] = true
+	}
+
+	words := strings.Fields(text)
+	first := -1
+	for i, word := range words {
+		words[i] = html.EscapeString(word)
+		if !matchesAny(word, matches) {
+			continue
+		}
+
+		if first < 0 {
+			first = i
+		}
+		words[i] = "<b>" + words[i] + "</b>"
+	}
+
+	if first < 0 {
+		first = 0
+	}
+
+	begin := first - variables.SnippetWords/2
+	if begin < 0 {
+		begin = 0
+	}
+	end := begin + variables.SnippetWords
+	if end > len(words) {
+		end = len(words)
+	}
+
+	return strings.Join(words[begin:end], " ")
+}
+
+// matchesAny tells whether any token of word, "foo-bar" has two, is one of
+// matches.
+func matchesAny(word string, matches map[string]bool) bool {
+	for _, token := range Tokenize(word) {
+		if matches[token] {
+			return true
+		}
+	}
+	return false
+}
+
+// UniqueTokens returns the distinct words of text.
+func UniqueTokens(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, token := range Tokenize(text) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
+
+// SearchRank is the share of the words of content matching the query.
+func SearchRank(content string, tokens []string) float64 {
+	words := Tokenize(content)
+	if len(words) == 0 {
+		return 0
+	}
+
+	matches := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		matches[token] = true
+	}
+
+	var matched int
+	for _, word := range words {
+		if matches[word] {
+			matched++
+		}
 	}
 
-	return pageSize, page
+	return float64(matched) / float64(len(words))
 }
 
 func ValidateStringSize(validatedString string, begin int, end int, validateError string, logger *slog.Logger) error {
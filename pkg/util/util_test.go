@@ -0,0 +1,185 @@
+package util_test
+
+import (
+	"crypto/sha512"
+	"net"
+	"net/http/httptest"
+	"ozon-task/pkg/util"
+	"ozon-task/pkg/variables"
+	"testing"
+)
+
+// Small argon2 parameters keep the tests fast.
+var (
+	cheapHash = &variables.PasswordHashConfig{Time: 1, Memory: 64, Threads: 1, KeyLength: 16, SaltLength: 8}
+	otherHash = &variables.PasswordHashConfig{Time: 2, Memory: 64, Threads: 1, KeyLength: 16, SaltLength: 8}
+)
+
+func hash(t *testing.T, password string, config *variables.PasswordHashConfig) []byte {
+	t.Helper()
+	hashed, err := util.HashPassword(password, config)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	return hashed
+}
+
+func legacyHash(password string) []byte {
+	sum := sha512.Sum512([]byte(password))
+	return sum[:]
+}
+
+func TestVerifyPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		hash       []byte
+		wantMatch  bool
+		wantRehash bool
+		wantErr    bool
+	}{
+		{name: "matching", password: "secret", hash: hash(t, "secret", cheapHash), wantMatch: true},
+		{name: "wrong password", password: "guess", hash: hash(t, "secret", cheapHash)},
+		{name: "other parameters", password: "secret", hash: hash(t, "secret", otherHash), wantMatch: true, wantRehash: true},
+		{name: "legacy matching", password: "secret", hash: legacyHash("secret"), wantMatch: true, wantRehash: true},
+		{name: "legacy wrong password", password: "guess", hash: legacyHash("secret"), wantRehash: true},
+		{name: "malformed", password: "secret", hash: []byte("$argon2id$v=19$m=64"), wantErr: true},
+		{name: "bad salt", password: "secret", hash: []byte("$argon2id$v=19$m=64,t=1,p=1$!!$AAAA"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, rehash, err := util.VerifyPassword(test.password, test.hash, cheapHash)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("VerifyPassword error %v, want error %v", err, test.wantErr)
+			}
+			if match != test.wantMatch || rehash != test.wantRehash {
+				t.Errorf("VerifyPassword = %v, %v, want %v, %v", match, rehash, test.wantMatch, test.wantRehash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSalts(t *testing.T) {
+	first := hash(t, "secret", cheapHash)
+	second := hash(t, "secret", cheapHash)
+	if string(first) == string(second) {
+		t.Errorf("two hashes of a password are equal: %s", first)
+	}
+}
+
+// TestRehash follows a legacy hash through the upgrade done at signin.
+func TestRehash(t *testing.T) {
+	stored := legacyHash("secret")
+	match, rehash, err := util.VerifyPassword("secret", stored, cheapHash)
+	if err != nil || !match || !rehash {
+		t.Fatalf("VerifyPassword of the legacy hash = %v, %v, %v", match, rehash, err)
+	}
+
+	stored = hash(t, "secret", cheapHash)
+	match, rehash, err = util.VerifyPassword("secret", stored, cheapHash)
+	if err != nil || !match || rehash {
+		t.Errorf("VerifyPassword of the new hash = %v, %v, %v", match, rehash, err)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", want: []string{}},
+		{name: "single addresses", proxies: []string{"127.0.0.1", "::1"}, want: []string{"127.0.0.1/32", "::1/128"}},
+		{name: "ranges", proxies: []string{"10.0.0.0/8", "fd00::/8"}, want: []string{"10.0.0.0/8", "fd00::/8"}},
+		{name: "invalid", proxies: []string{"localhost"}, wantErr: true},
+		{name: "invalid range", proxies: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			networks, err := util.ParseTrustedProxies(test.proxies)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseTrustedProxies error %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			got := make([]string, 0, len(networks))
+			for _, network := range networks {
+				got = append(got, network.String())
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("ParseTrustedProxies = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("ParseTrustedProxies = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := util.ParseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		proxies    []*net.IPNet
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", proxies: trusted, want: "203.0.113.7"},
+		{name: "header from a stranger", remoteAddr: "203.0.113.7:5000", realIP: "198.51.100.1", proxies: trusted, want: "203.0.113.7"},
+		{name: "header from the proxy", remoteAddr: "127.0.0.1:5000", realIP: "198.51.100.1", proxies: trusted, want: "198.51.100.1"},
+		{name: "header from a proxy range", remoteAddr: "10.1.2.3:5000", realIP: "198.51.100.1", proxies: trusted, want: "198.51.100.1"},
+		{name: "proxy without the header", remoteAddr: "127.0.0.1:5000", proxies: trusted, want: "127.0.0.1"},
+		{name: "no trusted proxies", remoteAddr: "127.0.0.1:5000", realIP: "198.51.100.1", want: "127.0.0.1"},
+		{name: "address without a port", remoteAddr: "203.0.113.7", realIP: "198.51.100.1", proxies: trusted, want: "203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.realIP != "" {
+				r.Header.Set(variables.RealIPHeader, test.realIP)
+			}
+
+			if got := util.ClientIP(r, test.proxies); got != test.want {
+				t.Errorf("ClientIP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		tokens []string
+		want   string
+	}{
+		{name: "match", text: "learning golang today", tokens: []string{"golang"}, want: "learning <b>golang</b> today"},
+		{name: "no match", text: "learning golang today", tokens: []string{"redis"}, want: "learning golang today"},
+		{name: "punctuation", text: "Golang, again", tokens: []string{"golang"}, want: "<b>Golang,</b> again"},
+		{name: "second token of a word", text: "foo-bar baz", tokens: []string{"bar"}, want: "<b>foo-bar</b> baz"},
+		{name: "markup", text: "<script>alert(1)</script> golang", tokens: []string{"golang"}, want: "&lt;script&gt;alert(1)&lt;/script&gt; <b>golang</b>"},
+		{name: "markup in a match", text: `<i>golang</i> & "go"`, tokens: []string{"golang", "go"}, want: "<b>&lt;i&gt;golang&lt;/i&gt;</b> &amp; <b>&#34;go&#34;</b>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := util.Highlight(test.text, test.tokens); got != test.want {
+				t.Errorf("Highlight = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
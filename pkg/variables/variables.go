@@ -1,6 +1,10 @@
 package variables
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+	"time"
+)
 
 // Server Errors
 const (
@@ -36,25 +40,157 @@ const (
 	BannerNotFoundError         = "Banner not found"
 	InvalidLimit                = "Limit must be a positive number"
 	InvalidOffset               = "Offset must be non-negative"
+	InvalidFirst                = "First must be between 1 and 100"
+	InvalidCursor               = "Invalid cursor"
+	InvalidDepth                = "Depth must be between 0 and 5"
+	InvalidPostOrder            = "Unknown posts order"
+	EmptySearchQuery            = "Search query is empty"
+	InvalidReactionTarget       = "Unknown reaction target"
+	ReactionError               = "Reaction error"
+	UserActivityError           = "User activity error"
+	UnsupportedGrantTypeError   = "Unsupported grant type"
+	InvalidTokenError           = "Invalid token"
+	TokenSignError              = "Token sign failed"
+	TokenConfigError            = "Invalid token config"
+	ServiceSecretError          = "Invalid service secret"
+	ServiceUnauthenticatedError = "Service secret missing or wrong"
+	ActingUserMissingError      = "Acting user missing"
+	UnknownRoleError            = "Unknown role"
+	OwnRoleChangeError          = "Can not change own role"
+	InvalidUserIdError          = "Invalid user id"
+	UserBannedError             = "User is banned"
+	BanNotFoundError            = "Ban not found"
+	InvalidBanUntilError        = "Ban must end in the future"
+	OwnBanError                 = "Can not ban yourself"
+	InvalidUntilError           = "Until must be an RFC 3339 time"
+	InvalidModerationStatus     = "Moderation status must be APPROVED or REJECTED"
+	ContentRejectedError        = "Content is rejected"
+	EmptyReportReason           = "Report reason is empty"
+	ModerationError             = "Moderation error"
+	ReportError                 = "Report error"
+	TooManyRequestsError        = "Too many requests"
+	AccountLockedError          = "Account is locked, try again later"
+	InvalidCSRFTokenError       = "Invalid CSRF token"
+	InvalidTrustedProxyError    = "Invalid trusted proxy"
+	TooManyRequestsCode         = "TOO_MANY_REQUESTS"
 )
 
 // Middleware types
 type (
 	contextKey string
 	roleKey    string
+	loadersKey string
 )
 
 // Middleware keys constants
 const (
-	UserIDKey contextKey = "userId"
-	RoleKey   roleKey    = "role"
+	UserIDKey         contextKey = "userId"
+	SessionIDKey      contextKey = "sessionId"
+	ClientIPKey       contextKey = "clientIp"
+	ResponseWriterKey contextKey = "responseWriter"
+	RoleKey           roleKey    = "role"
+	LoadersKey        loadersKey = "loaders"
+)
+
+// Rate limit scopes besides the paths of the HTTP endpoints
+const (
+	MutationScope = "mutation"
 )
 
 // Configs types
 type (
 	AppConfig struct {
-		Address  string `yaml:"address"`
-		InMemory bool   `yaml:"inMemory"`
+		Address      string             `yaml:"address"`
+		InMemory     bool               `yaml:"inMemory"`
+		InProcess    bool               `yaml:"inProcess"`
+		InMemoryTTL  time.Duration      `yaml:"in_memory_ttl"`
+		PasswordHash PasswordHashConfig `yaml:"password_hash"`
+		Session      SessionConfig      `yaml:"session"`
+		Token        TokenConfig        `yaml:"token"`
+		Moderation   ModerationConfig   `yaml:"moderation"`
+		RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+		Cache        RepoCacheConfig    `yaml:"cache"`
+		Cookies      CookieConfig       `yaml:"cookies"`
+		// TrustedProxies are the addresses, single IPs or CIDR ranges, whose
+		// X-Real-IP header names the client.
+		TrustedProxies []string `yaml:"trusted_proxies"`
+	}
+
+	// CookieConfig sets the Secure attribute of the session and CSRF
+	// cookies. Browsers only keep secure cookies over HTTPS, so setups that
+	// serve plain HTTP turn it off.
+	CookieConfig struct {
+		Secure bool `yaml:"secure"`
+	}
+
+	// RepoCacheConfig puts a Redis cache of hot posts and first comment
+	// pages in front of Postgres when the service isn't in memory.
+	// The hits and misses are logged every StatsInterval, zero turns it off.
+	RepoCacheConfig struct {
+		Enabled       bool          `yaml:"enabled"`
+		TTL           time.Duration `yaml:"ttl"`
+		StatsInterval time.Duration `yaml:"stats_interval"`
+	}
+
+	// RateLimitConfig bounds the requests of a client IP and of a signed in
+	// user in a sliding window, a rule with a zero limit is off. Logins with
+	// too many failed passwords are locked for a while.
+	RateLimitConfig struct {
+		PerIP   RateLimitRule `yaml:"per_ip"`
+		PerUser RateLimitRule `yaml:"per_user"`
+		Lockout LockoutConfig `yaml:"lockout"`
+	}
+
+	RateLimitRule struct {
+		Limit  int           `yaml:"limit"`
+		Window time.Duration `yaml:"window"`
+	}
+
+	// LockoutConfig locks a login for Duration after MaxFailures failed
+	// passwords within Window, zero MaxFailures disables it.
+	LockoutConfig struct {
+		MaxFailures int           `yaml:"max_failures"`
+		Window      time.Duration `yaml:"window"`
+		Duration    time.Duration `yaml:"duration"`
+	}
+
+	// ModerationConfig enables premoderation: new posts and comments of users
+	// with fewer than TrustedContentCount approved ones wait as pending
+	// until a moderator approves them.
+	ModerationConfig struct {
+		Premoderation       bool `yaml:"premoderation"`
+		TrustedContentCount int  `yaml:"trusted_content_count"`
+	}
+
+	// PasswordHashConfig tunes argon2id, zero values fall back to the
+	// Argon2 defaults. Memory is in KiB.
+	PasswordHashConfig struct {
+		Time       uint32 `yaml:"time"`
+		Memory     uint32 `yaml:"memory"`
+		Threads    uint8  `yaml:"threads"`
+		KeyLength  uint32 `yaml:"key_length"`
+		SaltLength uint32 `yaml:"salt_length"`
+	}
+
+	// SessionConfig limits the life of a session. A session expires after
+	// IdleTimeout without requests and AbsoluteTimeout after signin at the
+	// latest. Its id is replaced every RotationInterval, zero disables it.
+	SessionConfig struct {
+		AbsoluteTimeout  time.Duration `yaml:"absolute_timeout"`
+		IdleTimeout      time.Duration `yaml:"idle_timeout"`
+		RotationInterval time.Duration `yaml:"rotation_interval"`
+	}
+
+	// TokenConfig describes the signed access tokens. HS256 uses Secret to
+	// sign and to check them, EdDSA reads PEM keys from the files. A service
+	// that only checks tokens needs no private key.
+	TokenConfig struct {
+		Algorithm      string        `yaml:"algorithm"`
+		Secret         string        `yaml:"secret"`
+		PrivateKeyFile string        `yaml:"private_key_file"`
+		PublicKeyFile  string        `yaml:"public_key_file"`
+		Issuer         string        `yaml:"issuer"`
+		AccessTTL      time.Duration `yaml:"access_ttl"`
 	}
 
 	CacheDataBaseConfig struct {
@@ -75,17 +211,68 @@ type (
 		Timer        uint32 `yaml:"timer"`
 	}
 
+	// GrpcConfig is shared by both ends of the authorization RPCs. Secret
+	// is read from $SERVICE_SECRET, callers without it are refused.
 	GrpcConfig struct {
 		Address        string `yaml:"address"`
 		Port           string `yaml:"port"`
 		ConnectionType string `yaml:"connection_type"`
+		Secret         string `yaml:"secret"`
 	}
 )
 
+// Password hashing defaults
+const (
+	Argon2Time       = 2
+	Argon2Memory     = 19 * 1024
+	Argon2Threads    = 1
+	Argon2KeyLength  = 32
+	Argon2SaltLength = 16
+)
+
+// Session defaults
+const (
+	// SessionIdBytes gives session ids 256 bits of entropy.
+	SessionIdBytes         = 32
+	CSRFTokenBytes         = 32
+	SessionAbsoluteTimeout = 24 * time.Hour
+	// SessionRotationGrace keeps a rotated session id valid for requests
+	// that were already in flight with it.
+	SessionRotationGrace = 30 * time.Second
+	// PermissionsCacheTTL bounds how long a changed role takes to apply in
+	// the posts service.
+	PermissionsCacheTTL = 30 * time.Second
+)
+
+// Token defaults
+const (
+	TokenAlgorithmHS256   = "HS256"
+	TokenAlgorithmEdDSA   = "EdDSA"
+	TokenIssuer           = "ozon-task-authorization"
+	AccessTokenTTL        = 5 * time.Minute
+	TokenTypeBearer       = "Bearer"
+	GrantTypePassword     = "password"
+	GrantTypeRefreshToken = "refresh_token"
+	// MinTokenSecretBytes is the shortest HS256 secret accepted, the size
+	// of the hash.
+	MinTokenSecretBytes = 32
+	// PlaceholderTokenSecret is the secret the configs used to ship with.
+	PlaceholderTokenSecret = "change-me-in-production"
+	// MinServiceSecretBytes is the shortest secret the services accept
+	// from each other.
+	MinServiceSecretBytes = 32
+	// ServiceSecretMetadata carries the service secret in a gRPC call.
+	ServiceSecretMetadata = "x-service-secret"
+	// ActingUserMetadata names the user a service call is made for.
+	ActingUserMetadata = "x-acting-user"
+)
+
 // Cookies data
 const (
 	SessionCookieName = "session_id"
+	CSRFCookieName    = "csrf_token"
 	HttpOnly          = true
+	CookieSameSite    = http.SameSiteLaxMode
 )
 
 // Repository messages
@@ -93,6 +280,8 @@ const (
 	AuthorizationCachePingRetryError      = "Authorization cache: ping failed"
 	AuthorizationCachePingMaxRetriesError = "Authorization cache: ping error. Maximum number of retries reached"
 	SessionRemoveError                    = "Delete session request could not be completed:"
+	SessionUpdateError                    = "Update session failed"
+	SessionListError                      = "List sessions failed"
 	SqlOpenError                          = "Open SQL connection failed:"
 	SqlPingError                          = "Ping SQL connection failed:"
 	SqlMaxPingRetriesError                = "Maximum number of retries reached:"
@@ -100,14 +289,34 @@ const (
 	FindProfileIdByLoginError             = "Find profile id by login failed:"
 	ProfileIdNotFoundByLoginError         = "Profile id not found:"
 	ProfileRoleNotFoundByLoginError       = "Profile role not found:"
+	InvalidPasswordHashError              = "Invalid password hash"
+	UpdatePasswordError                   = "Update password failed"
+	SetRoleError                          = "Set role failed"
+	GetPermissionsError                   = "Get permissions failed"
+	ListUsersError                        = "List users failed"
+	BanUserError                          = "Ban user failed"
+	UnbanUserError                        = "Unban user failed"
+	GetBanError                           = "Get ban failed"
+	RateLimitError                        = "Rate limit check failed"
+	LockoutError                          = "Login lockout check failed"
+	CacheReadError                        = "Read cache failed"
+	CacheWriteError                       = "Write cache failed"
+	CacheInvalidateError                  = "Invalidate cache failed"
+	CacheStatsMessage                     = "Cache stats"
 )
 
 // Repository constants
 const (
-	MaxRetries  = 5
-	UserRoleId  = 1
-	AdminRoleId = 2
-	PageSize    = 10
+	MaxRetries   = 5
+	UserRoleId   = 1
+	AdminRoleId  = 2
+	PageSize     = 10
+	MaxPageSize  = 100
+	MaxDepth     = 5
+	SnippetWords = 35
+	// TrendingHalfLife is the age at which a comment counts half as much
+	// towards the trending score of its post.
+	TrendingHalfLife = 24 * 60 * 60
 )
 
 // Core Messages
@@ -121,11 +330,20 @@ const (
 	GetProfileRoleError             = "Get profile role failed"
 	GrpcRecievError                 = "gRPC recieve error"
 	CannotCreateBanner              = "Can not create banner"
+	PostNotFoundError               = "Post not found"
+	CommentNotFoundError            = "Comment not found"
+	CommentDeletedError             = "Comment is deleted"
+	ParentCommentError              = "Parent comment belongs to another post"
 )
 
-// Core variables
+// Typed errors
 var (
-	LetterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	ErrLoginTaken   = errors.New(UserAlreadyExistsError)
+	ErrUnknownRole  = errors.New(UnknownRoleError)
+	ErrUserNotFound = errors.New(ProfileNotFoundError)
+	ErrUserBanned   = errors.New(UserBannedError)
+	ErrInvalidUntil = errors.New(InvalidBanUntilError)
+	ErrLocked       = errors.New(AccountLockedError)
 )
 
 // Logger constants
@@ -141,6 +359,51 @@ const (
 	ReadAuthCacheConfigError = "Read auth cache config failed"
 	ReadGrpcConfigError      = "Grpc config file error"
 	CoreInitializeError      = "Core initialize failed"
+	CreateAdminError         = "Create admin failed"
+	CreateAdminUsageError    = "login and password are required"
+	MigrateError             = "Migrate failed"
+	MigrateUsageError        = "usage: migrate up | down [-steps N] | status"
+)
+
+// Migrations messages
+const (
+	MigrationFileNameError      = "Invalid migration file name"
+	MigrationVersionTakenError  = "Migration version is used twice"
+	MigrationScriptMissingError = "Migration needs both up and down scripts"
+	MigrationUnknownError       = "Applied migration is missing from this build"
+	MigrationLockError          = "Take migrations lock failed"
+	MigrationApplyError         = "Apply migration failed:"
+)
+
+// Commands
+const (
+	CreateAdminCommand = "create-admin"
+	AdminPasswordEnv   = "ADMIN_PASSWORD"
+	MigrateCommand     = "migrate"
+	// MigrationsLockKey is the Postgres advisory lock held while migrating.
+	MigrationsLockKey = 7_160_512_024
+)
+
+// Environment overrides of the app configs, for the settings that differ
+// between deployments
+const (
+	CookiesSecureEnv = "COOKIES_SECURE"
+	TokenSecretEnv   = "TOKEN_SECRET"
+	ServiceSecretEnv = "SERVICE_SECRET"
+)
+
+// Postgres error codes
+const (
+	UniqueViolationCode = "23505"
+)
+
+// Headers
+const (
+	RealIPHeader        = "X-Real-IP"
+	AuthorizationHeader = "Authorization"
+	BearerPrefix        = "Bearer "
+	RetryAfterHeader    = "Retry-After"
+	CSRFHeader          = "X-CSRF-Token"
 )
 
 // Regexp
@@ -153,6 +416,8 @@ var (
 	MethodGet          = []string{http.MethodGet}
 	MethodPost         = []string{http.MethodPost}
 	MethodGetAndPost   = []string{http.MethodGet, http.MethodPost}
+	MethodDelete       = []string{http.MethodDelete}
+	MethodsAdminUser   = []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete}
 	MethodsDeletePatch = []string{http.MethodDelete, http.MethodPatch}
 )
 
@@ -163,10 +428,34 @@ var (
 	AdminAndUser = []string{"admin", "user"}
 )
 
+// Role names
+const (
+	UserRoleName      = "user"
+	AdminRoleName     = "admin"
+	ModeratorRoleName = "moderator"
+)
+
+// Permissions, granted to roles in the role_permission table
+const (
+	PermissionPostCreate       = "post:create"
+	PermissionPostUpdateAny    = "post:update:any"
+	PermissionPostDeleteAny    = "post:delete:any"
+	PermissionPostModerate     = "post:moderate"
+	PermissionCommentCreate    = "comment:create"
+	PermissionCommentUpdateAny = "comment:update:any"
+	PermissionCommentDeleteAny = "comment:delete:any"
+	PermissionCommentModerate  = "comment:moderate"
+	PermissionUserBan          = "user:ban"
+	PermissionUserManage       = "user:manage"
+	PermissionReactionCreate   = "reaction:create"
+	PermissionContentReport    = "content:report"
+)
+
 // Query params
 const (
 	PaginationPageNumber = "page"
 	PaginationPageSize   = "page_size"
+	RoleFilter           = "role"
 )
 
 // Validate params
@@ -2,20 +2,28 @@ package delivery_grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"ozon-task/configs"
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/serviceauth"
+	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	pbAuth "ozon-task/services/authorization/proto/authorization"
 	"ozon-task/services/authorization/repository/profile"
 	"ozon-task/services/authorization/repository/session"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type authorizationGrpc struct {
 	grpcServer *grpc.Server
+	grpcConfig *variables.GrpcConfig
 	logger     *slog.Logger
 }
 
@@ -23,10 +31,11 @@ type authorizationGrpcServer struct {
 	pbAuth.UnimplementedAuthorizationServer
 	profileRepository *profile.ProfileRelationalRepository
 	sessionRepository *session.SessionCacheRepository
+	sessionConfig     variables.SessionConfig
 	logger            *slog.Logger
 }
 
-func NewServer(configRelational *variables.RelationalDataBaseConfig, configSession *variables.CacheDataBaseConfig, logger *slog.Logger) (*authorizationGrpc, error) {
+func NewServer(configRelational *variables.RelationalDataBaseConfig, configSession *variables.CacheDataBaseConfig, sessionConfig *variables.SessionConfig, logger *slog.Logger) (*authorizationGrpc, error) {
 	session, err := session.GetSessionRepository(configSession, logger)
 
 	if err != nil {
@@ -40,24 +49,32 @@ func NewServer(configRelational *variables.RelationalDataBaseConfig, configSessi
 		return nil, fmt.Errorf(variables.GrpcListenAndServeError, ": %w", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcConfig, err := configs.ReadGrpcConfig()
+	if err != nil {
+		logger.Error(variables.ReadGrpcConfigError, "error", err.Error())
+		return nil, fmt.Errorf(variables.GrpcListenAndServeError+": %w", err)
+	}
+
+	// The RPCs change roles and bans and end sessions, only the posts
+	// service may call them.
+	err = serviceauth.CheckSecret(grpcConfig.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(serviceauth.ServerInterceptor(grpcConfig.Secret)))
 	pbAuth.RegisterAuthorizationServer(grpcServer, &authorizationGrpcServer{
 		logger:            logger,
 		sessionRepository: session,
+		sessionConfig:     util.SessionParams(sessionConfig),
 		profileRepository: users,
 	})
 
-	return &authorizationGrpc{grpcServer: grpcServer, logger: logger}, nil
+	return &authorizationGrpc{grpcServer: grpcServer, grpcConfig: grpcConfig, logger: logger}, nil
 }
 
 func (server *authorizationGrpc) ListenAndServeGrpc() error {
-	grpcConfig, err := configs.ReadGrpcConfig()
-	if err != nil {
-		server.logger.Error(variables.ReadGrpcConfigError, ": %v", err)
-		return fmt.Errorf(variables.GrpcListenAndServeError, ": %w", err)
-	}
-
-	lis, err := net.Listen(grpcConfig.ConnectionType, ":"+grpcConfig.Port)
+	lis, err := net.Listen(server.grpcConfig.ConnectionType, ":"+server.grpcConfig.Port)
 	if err != nil {
 		server.logger.Error(variables.GrpcListenAndServeError, ": %v", err)
 		return fmt.Errorf(variables.GrpcListenAndServeError, ": %w", err)
@@ -72,19 +89,35 @@ func (server *authorizationGrpc) ListenAndServeGrpc() error {
 }
 
 func (server *authorizationGrpcServer) GetId(ctx context.Context, req *pbAuth.FindIdRequest) (*pbAuth.FindIdResponse, error) {
-	login, err := server.sessionRepository.GetUserLogin(ctx, req.Sid, server.logger)
+	session, err := server.sessionRepository.RefreshSession(ctx, req.Sid, server.sessionConfig, server.logger)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := server.profileRepository.GetUserProfileId(login)
+	id, err := server.profileRepository.GetUserProfileId(session.Login)
 	if err != nil {
 		server.logger.Error(variables.ProfileNotFoundError, ": %v", err)
 		return nil, err
 	}
-	return &pbAuth.FindIdResponse{
+
+	ban, err := server.profileRepository.GetActiveBan(id)
+	if err != nil {
+		server.logger.Error(variables.GetBanError, "error", err.Error())
+		return nil, err
+	}
+
+	if ban != nil {
+		return nil, status.Error(codes.PermissionDenied, variables.UserBannedError)
+	}
+
+	response := &pbAuth.FindIdResponse{
 		Value: id,
-	}, nil
+	}
+	if session.SID != req.Sid {
+		response.Sid = session.SID
+		response.ExpiresAt = session.ExpiresAt.Unix()
+	}
+	return response, nil
 }
 
 func (server *authorizationGrpcServer) GetRole(ctx context.Context, req *pbAuth.RoleRequest) (*pbAuth.RoleResponse, error) {
@@ -98,3 +131,184 @@ func (server *authorizationGrpcServer) GetRole(ctx context.Context, req *pbAuth.
 		Role: role,
 	}, nil
 }
+
+func (server *authorizationGrpcServer) GetPermissions(ctx context.Context, req *pbAuth.PermissionsRequest) (*pbAuth.PermissionsResponse, error) {
+	permissions, err := server.profileRepository.GetUserPermissions(req.Id)
+	if err != nil {
+		server.logger.Error(variables.GetPermissionsError, "error", err.Error())
+		return nil, err
+	}
+
+	return &pbAuth.PermissionsResponse{
+		Permissions: permissions,
+	}, nil
+}
+
+func (server *authorizationGrpcServer) GetUsersByIds(ctx context.Context, req *pbAuth.UsersRequest) (*pbAuth.UsersResponse, error) {
+	users, err := server.profileRepository.GetUsersByIds(req.Ids)
+	if err != nil {
+		server.logger.Error(variables.GetProfileError, "error", err.Error())
+		return nil, err
+	}
+
+	response := &pbAuth.UsersResponse{Users: make([]*pbAuth.User, 0, len(users))}
+	for _, user := range users {
+		response.Users = append(response.Users, &pbAuth.User{Id: user.Id, Login: user.Login})
+	}
+
+	return response, nil
+}
+
+// RevokeUserSessions ends every session of the user, so an admin can force
+// a logout on all devices. Like every RPC here it needs the service secret.
+func (server *authorizationGrpcServer) RevokeUserSessions(ctx context.Context, req *pbAuth.RevokeSessionsRequest) (*pbAuth.RevokeSessionsResponse, error) {
+	users, err := server.profileRepository.GetUsersByIds([]int64{req.Id})
+	if err != nil {
+		server.logger.Error(variables.GetProfileError, "error", err.Error())
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, status.Error(codes.NotFound, variables.ProfileNotFoundError)
+	}
+
+	revoked, err := server.sessionRepository.DeleteUserSessions(ctx, users[0].Login, server.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbAuth.RevokeSessionsResponse{
+		Revoked: revoked,
+	}, nil
+}
+
+func (server *authorizationGrpcServer) GetUser(ctx context.Context, req *pbAuth.UserRequest) (*pbAuth.User, error) {
+	user, err := server.profileRepository.GetUser(req.Id)
+	if err != nil {
+		server.logger.Error(variables.GetProfileError, "error", err.Error())
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, status.Error(codes.NotFound, variables.ProfileNotFoundError)
+	}
+
+	return &pbAuth.User{Id: user.Id, Login: user.Login, Role: user.Role}, nil
+}
+
+func (server *authorizationGrpcServer) SetRole(ctx context.Context, req *pbAuth.SetRoleRequest) (*pbAuth.User, error) {
+	user, err := server.profileRepository.SetRole(req.Id, req.Role)
+	if errors.Is(err, variables.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, variables.ProfileNotFoundError)
+	}
+	if errors.Is(err, variables.ErrUnknownRole) {
+		return nil, status.Error(codes.InvalidArgument, variables.UnknownRoleError)
+	}
+	if err != nil {
+		server.logger.Error(variables.SetRoleError, "error", err.Error())
+		return nil, err
+	}
+
+	return &pbAuth.User{Id: user.Id, Login: user.Login, Role: user.Role}, nil
+}
+
+func (server *authorizationGrpcServer) ListUsers(ctx context.Context, req *pbAuth.ListUsersRequest) (*pbAuth.ListUsersResponse, error) {
+	page, pageSize := req.Page, req.PageSize
+	if page == 0 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = variables.PageSize
+	}
+	if pageSize > variables.MaxPageSize {
+		pageSize = variables.MaxPageSize
+	}
+
+	users, total, err := server.profileRepository.ListUsers(req.Role, page, pageSize)
+	if err != nil {
+		server.logger.Error(variables.ListUsersError, "error", err.Error())
+		return nil, err
+	}
+
+	response := &pbAuth.ListUsersResponse{Users: make([]*pbAuth.User, 0, len(users)), Total: total}
+	for _, user := range users {
+		response.Users = append(response.Users, &pbAuth.User{Id: user.Id, Login: user.Login, Role: user.Role})
+	}
+
+	return response, nil
+}
+
+// BanUser bans the user and ends all of its sessions, like the admin
+// endpoint of the service does. The ban is recorded as made by the acting
+// user of the call.
+func (server *authorizationGrpcServer) BanUser(ctx context.Context, req *pbAuth.BanRequest) (*pbAuth.Ban, error) {
+	bannedBy, ok := serviceauth.ActingUser(ctx)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, variables.ActingUserMissingError)
+	}
+
+	if req.Id == bannedBy {
+		return nil, status.Error(codes.InvalidArgument, variables.OwnBanError)
+	}
+
+	user, err := server.profileRepository.GetUser(req.Id)
+	if err != nil {
+		server.logger.Error(variables.GetProfileError, "error", err.Error())
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, status.Error(codes.NotFound, variables.ProfileNotFoundError)
+	}
+
+	var until *time.Time
+	if req.Until != 0 {
+		end := time.Unix(req.Until, 0)
+		until = &end
+	}
+
+	ban, err := server.profileRepository.BanUser(req.Id, until, req.Reason, bannedBy)
+	if errors.Is(err, variables.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, variables.ProfileNotFoundError)
+	}
+	if errors.Is(err, variables.ErrInvalidUntil) {
+		return nil, status.Error(codes.InvalidArgument, variables.InvalidBanUntilError)
+	}
+	if err != nil {
+		server.logger.Error(variables.BanUserError, "error", err.Error())
+		return nil, err
+	}
+
+	_, err = server.sessionRepository.DeleteUserSessions(ctx, user.Login, server.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return banResponse(ban), nil
+}
+
+func (server *authorizationGrpcServer) UnbanUser(ctx context.Context, req *pbAuth.UserRequest) (*pbAuth.UnbanResponse, error) {
+	unbanned, err := server.profileRepository.UnbanUser(req.Id)
+	if err != nil {
+		server.logger.Error(variables.UnbanUserError, "error", err.Error())
+		return nil, err
+	}
+
+	return &pbAuth.UnbanResponse{
+		Unbanned: unbanned,
+	}, nil
+}
+
+func banResponse(ban *models.Ban) *pbAuth.Ban {
+	response := &pbAuth.Ban{
+		UserId:    ban.UserId,
+		Reason:    ban.Reason,
+		BannedBy:  ban.BannedBy,
+		CreatedAt: ban.CreatedAt.Unix(),
+	}
+	if ban.Until != nil {
+		response.Until = ban.Until.Unix()
+	}
+
+	return response
+}
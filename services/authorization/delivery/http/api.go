@@ -2,14 +2,19 @@ package delivery
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"net"
 	"net/http"
 	"ozon-task/pkg/middleware"
 	"ozon-task/pkg/models"
+	"ozon-task/pkg/ratelimit"
 	communication "ozon-task/pkg/requests"
 	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/authorization/usecase"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,18 +22,31 @@ import (
 type ICore interface {
 	KillSession(ctx context.Context, sid string) error
 	FindActiveSession(ctx context.Context, sid string) (bool, error)
-	CreateSession(ctx context.Context, login string) (models.Session, error)
+	CreateSession(ctx context.Context, login string, userAgent string, ip string) (models.Session, error)
+	ListSessions(ctx context.Context, userId int64) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userId int64, target string) (bool, error)
+	RevokeAllSessions(ctx context.Context, userId int64) (int64, error)
 	CreateUserAccount(login string, password string) error
-	FindUserByLogin(login string) (bool, error)
-	FindUserAccount(login string, password string) (*models.UserItem, bool, error)
-	GetUserId(ctx context.Context, sid string) (int64, error)
+	FindUserAccount(ctx context.Context, login string, password string) (*models.UserItem, bool, error)
+	GetUserId(ctx context.Context, sid string) (int64, *models.Session, error)
+	GetTokenUserId(ctx context.Context, token string) (int64, error)
+	CreateTokens(ctx context.Context, login string, password string, userAgent string, ip string) (*models.TokenPair, bool, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+	GetUser(ctx context.Context, id int64) (*models.UserItem, error)
+	ListUsers(ctx context.Context, role string, page uint64, pageSize uint64) ([]*models.UserItem, int64, error)
+	SetRole(ctx context.Context, id int64, role string) (*models.UserItem, error)
+	BanUser(ctx context.Context, id int64, until *time.Time, reason string, bannedBy int64) (*models.Ban, error)
+	UnbanUser(ctx context.Context, id int64) (bool, error)
 	GetUserRole(ctx context.Context, id int64) (string, error)
+	CheckRateLimit(ctx context.Context, scope string, ip string, userId int64) (time.Duration, error)
 }
 
 type API struct {
-	core   ICore
-	logger *slog.Logger
-	mux    *http.ServeMux
+	core           ICore
+	logger         *slog.Logger
+	mux            http.Handler
+	secureCookies  bool
+	trustedProxies []*net.IPNet
 }
 
 func (api *API) ListenAndServe(appConfig *variables.AppConfig) error {
@@ -40,31 +58,46 @@ func (api *API) ListenAndServe(appConfig *variables.AppConfig) error {
 	return nil
 }
 
-func GetAuthorizationApi(authCore *usecase.Core, authLogger *slog.Logger) *API {
-	api := &API{
-		core:   authCore,
-		logger: authLogger,
-		mux:    http.NewServeMux(),
+func GetAuthorizationApi(authCore *usecase.Core, authAppConfig *variables.AppConfig, authLogger *slog.Logger) (*API, error) {
+	trustedProxies, err := util.ParseTrustedProxies(authAppConfig.TrustedProxies)
+	if err != nil {
+		return nil, err
 	}
 
-	api.mux.HandleFunc("/signin", api.Signin)
-	api.mux.HandleFunc("/signup", api.Signup)
+	api := &API{
+		core:           authCore,
+		logger:         authLogger,
+		mux:            http.NewServeMux(),
+		secureCookies:  authAppConfig.Cookies.Secure,
+		trustedProxies: trustedProxies,
+	}
 
-	signHandler := middleware.MethodMiddleware(api.mux, variables.MethodPost, api.logger)
+	authorized := func(handler http.Handler, methods []string) http.Handler {
+		return middleware.AuthorizationMiddleware(middleware.MethodMiddleware(middleware.CSRFMiddleware(handler, api.logger), methods, api.logger), api.core, api.secureCookies, api.logger)
+	}
 
-	logoutMux := http.NewServeMux()
-	logoutMux.Handle("/", signHandler)
-	logoutMux.HandleFunc("/logout", api.LogoutSession)
+	limited := func(handler http.HandlerFunc, methods []string) http.Handler {
+		return middleware.RateLimitMiddleware(middleware.MethodMiddleware(handler, methods, api.logger), api.core, api.trustedProxies, api.logger)
+	}
 
-	authHandler := middleware.AuthorizationMiddleware(logoutMux, api.core, api.logger)
-	authHandler = middleware.MethodMiddleware(logoutMux, variables.MethodPost, api.logger)
-	authHandler = middleware.PanicMiddleware(logoutMux, api.logger)
+	admin := func(handler http.HandlerFunc, methods []string) http.Handler {
+		return authorized(middleware.PermissionsMiddleware(handler, api.core, variables.AdminRole, api.logger), methods)
+	}
 
 	siteMux := http.NewServeMux()
-	siteMux.Handle("/", authHandler)
-	api.mux = siteMux
+	siteMux.Handle("/signin", limited(api.Signin, variables.MethodPost))
+	siteMux.Handle("/signup", limited(api.Signup, variables.MethodPost))
+	siteMux.Handle("/token", limited(api.Token, variables.MethodPost))
+	siteMux.Handle("/logout", middleware.MethodMiddleware(middleware.CSRFMiddleware(http.HandlerFunc(api.LogoutSession), api.logger), variables.MethodPost, api.logger))
+	siteMux.Handle("/logout-all", authorized(http.HandlerFunc(api.LogoutAllSessions), variables.MethodPost))
+	siteMux.Handle("/sessions", authorized(http.HandlerFunc(api.ListSessions), variables.MethodGet))
+	siteMux.Handle("/sessions/", authorized(http.HandlerFunc(api.RevokeSession), variables.MethodDelete))
+	siteMux.Handle("/admin/users", admin(api.ListUsers, variables.MethodGet))
+	siteMux.Handle("/admin/users/", admin(api.AdminUser, variables.MethodsAdminUser))
+
+	api.mux = middleware.PanicMiddleware(siteMux, api.logger)
 
-	return api
+	return api, nil
 }
 
 // @Summary SignIn
@@ -76,6 +109,8 @@ func GetAuthorizationApi(authCore *usecase.Core, authLogger *slog.Logger) *API {
 // @Param input body communication.SigninRequest true "login and password"
 // @Success 200 {string} string "Authentication token"
 // @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.UserBannedError
+// @Failure 429 {string} string variables.TooManyRequestsError
 // @Failure 500 {string} string variables.StatusInternalServerError
 // @Router /signin [post]
 func (api *API) Signin(w http.ResponseWriter, r *http.Request) {
@@ -86,7 +121,14 @@ func (api *API) Signin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, found, err := api.core.FindUserAccount(signinRequest.Login, signinRequest.Password)
+	user, found, err := api.core.FindUserAccount(r.Context(), signinRequest.Login, signinRequest.Password)
+	if api.sendLocked(w, r, err) {
+		return
+	}
+	if errors.Is(err, variables.ErrUserBanned) {
+		util.SendResponse(w, r, http.StatusForbidden, variables.UserBannedError, variables.UserBannedError, nil, api.logger)
+		return
+	}
 	if err != nil {
 		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.StatusInternalServerError, err, api.logger)
 		return
@@ -97,17 +139,103 @@ func (api *API) Signin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := api.core.CreateSession(r.Context(), user.Login)
+	session, err := api.core.CreateSession(r.Context(), user.Login, r.UserAgent(), util.ClientIP(r, api.trustedProxies))
 	if err != nil {
 		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.SessionCreateError, err, api.logger)
 		return
 	}
 
-	authorizationCookie := util.GetCookie(variables.SessionCookieName, session.SID, "/", variables.HttpOnly, session.ExpiresAt)
+	csrfToken, err := util.RandomToken(variables.CSRFTokenBytes)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.SessionCreateError, err, api.logger)
+		return
+	}
+
+	authorizationCookie := util.GetCookie(variables.SessionCookieName, session.SID, "/", variables.HttpOnly, api.secureCookies, session.ExpiresAt)
 	http.SetCookie(w, authorizationCookie)
+	// The CSRF cookie is readable by scripts of the site, which send it
+	// back in the X-CSRF-Token header.
+	http.SetCookie(w, util.GetCookie(variables.CSRFCookieName, csrfToken, "/", !variables.HttpOnly, api.secureCookies, session.ExpiresAt))
 	util.SendResponse(w, r, http.StatusOK, nil, variables.StatusOkMessage, nil, api.logger)
 }
 
+// @Summary Token
+// @Tags authentication
+// @Description Issue an access token for the password or refresh_token grant
+// @ID issue-token
+// @Accept json
+// @Produce json
+// @Param input body communication.TokenRequest true "grant"
+// @Success 200 {object} communication.TokenResponse
+// @Failure 400 {string} string variables.UnsupportedGrantTypeError
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.UserBannedError
+// @Failure 429 {string} string variables.TooManyRequestsError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /token [post]
+func (api *API) Token(w http.ResponseWriter, r *http.Request) {
+	var tokenRequest communication.TokenRequest
+
+	err := util.GetRequestBody(w, r, &tokenRequest, api.logger)
+	if err != nil {
+		return
+	}
+
+	var tokenPair *models.TokenPair
+	switch tokenRequest.GrantType {
+	case variables.GrantTypePassword:
+		var found bool
+		tokenPair, found, err = api.core.CreateTokens(r.Context(), tokenRequest.Login, tokenRequest.Password, r.UserAgent(), util.ClientIP(r, api.trustedProxies))
+		if api.sendLocked(w, r, err) {
+			return
+		}
+		if errors.Is(err, variables.ErrUserBanned) {
+			util.SendResponse(w, r, http.StatusForbidden, variables.UserBannedError, variables.UserBannedError, nil, api.logger)
+			return
+		}
+		if err != nil {
+			util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.StatusInternalServerError, err, api.logger)
+			return
+		}
+
+		if !found {
+			util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.StatusUnauthorizedError, nil, api.logger)
+			return
+		}
+	case variables.GrantTypeRefreshToken:
+		tokenPair, err = api.core.RefreshTokens(r.Context(), tokenRequest.RefreshToken)
+		if err != nil {
+			util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.StatusUnauthorizedError, err, api.logger)
+			return
+		}
+	default:
+		util.SendResponse(w, r, http.StatusBadRequest, variables.UnsupportedGrantTypeError, variables.UnsupportedGrantTypeError, nil, api.logger)
+		return
+	}
+
+	response := communication.TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		TokenType:    variables.TokenTypeBearer,
+		ExpiresIn:    int64(time.Until(tokenPair.ExpiresAt).Seconds()),
+		RefreshToken: tokenPair.RefreshToken,
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	util.SendResponse(w, r, http.StatusOK, response, variables.StatusOkMessage, nil, api.logger)
+}
+
+// sendLocked answers 429 with Retry-After when the login is locked after
+// failed passwords.
+func (api *API) sendLocked(w http.ResponseWriter, r *http.Request, err error) bool {
+	var locked *ratelimit.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+
+	util.SetRetryAfter(w, locked.RetryAfter)
+	util.SendResponse(w, r, http.StatusTooManyRequests, variables.AccountLockedError, variables.AccountLockedError, nil, api.logger)
+	return true
+}
+
 // @Summary SignUp
 // @Tags registration
 // @Desription Create account
@@ -117,7 +245,8 @@ func (api *API) Signin(w http.ResponseWriter, r *http.Request) {
 // @Param input body communication.SignupRequest true "account information"
 // @Success 200 {integer} object communication.SignupResponse
 // @Failure 400 {string} string variables.InvalidLoginOrPasswordError
-// @Failure 401 {string} string variables.InvalidLoginOrPasswordError
+// @Failure 409 {string} string variables.UserAlreadyExistsError
+// @Failure 429 {string} string variables.TooManyRequestsError
 // @Failure 500 {string} string variables.StatusInternalServerError
 // @Router /signup [post]
 func (api *API) Signup(w http.ResponseWriter, r *http.Request) {
@@ -128,24 +257,17 @@ func (api *API) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	found, err := api.core.FindUserByLogin(signupRequest.Login)
-	if err != nil {
-		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.StatusInternalServerError, err, api.logger)
-		return
-	}
-
-	if found {
-		util.SendResponse(w, r, http.StatusUnauthorized, nil, variables.UserAlreadyExistsError, nil, api.logger)
-		return
-	}
-
 	err = api.core.CreateUserAccount(signupRequest.Login, signupRequest.Password)
 	if err != nil && err.Error() == variables.InvalidLoginOrPasswordError {
 		util.SendResponse(w, r, http.StatusBadRequest, variables.InvalidLoginOrPasswordError, variables.InvalidLoginOrPasswordError, err, api.logger)
 		return
 	}
+	if errors.Is(err, variables.ErrLoginTaken) {
+		util.SendResponse(w, r, http.StatusConflict, nil, variables.UserAlreadyExistsError, nil, api.logger)
+		return
+	}
 	if err != nil {
-		util.SendResponse(w, r, http.StatusUnauthorized, variables.InvalidLoginOrPasswordError, variables.UserAlreadyExistsError, err, api.logger)
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.StatusInternalServerError, err, api.logger)
 		return
 	}
 
@@ -160,8 +282,10 @@ func (api *API) Signup(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Header 200 {integer} 1
+// @Param X-CSRF-Token header string true "value of the csrf_token cookie"
 // @Success 200 {string} string "Session ended successfully."
 // @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.InvalidCSRFTokenError
 // @Failure 500 {string} string variables.StatusInternalServerError
 // @Router /logout [post]
 func (api *API) LogoutSession(w http.ResponseWriter, r *http.Request) {
@@ -188,7 +312,324 @@ func (api *API) LogoutSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session.Expires = time.Now().AddDate(0, 0, -1)
-	http.SetCookie(w, session)
+	api.clearCookies(w)
+	util.SendResponse(w, r, http.StatusOK, nil, variables.StatusOkMessage, nil, api.logger)
+}
+
+// clearCookies drops the session and CSRF cookies of the client.
+func (api *API) clearCookies(w http.ResponseWriter) {
+	expired := time.Now().AddDate(0, 0, -1)
+	http.SetCookie(w, util.GetCookie(variables.SessionCookieName, "", "/", variables.HttpOnly, api.secureCookies, expired))
+	http.SetCookie(w, util.GetCookie(variables.CSRFCookieName, "", "/", !variables.HttpOnly, api.secureCookies, expired))
+}
+
+// currentSessionId is the id, as listed, of the session the request came
+// with. Requests with a bearer token have none.
+func currentSessionId(r *http.Request) string {
+	sid, ok := r.Context().Value(variables.SessionIDKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return util.HashSessionID(sid)
+}
+
+// @Summary List sessions
+// @Tags sessions
+// @Description Active sessions of the current user, most recently used first
+// @ID list-sessions
+// @Produce json
+// @Success 200 {array} communication.SessionResponse
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /sessions [get]
+func (api *API) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value(variables.UserIDKey).(int64)
+	sessions, err := api.core.ListSessions(r.Context(), userId)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.SessionListError, err, api.logger)
+		return
+	}
+
+	currentId := currentSessionId(r)
+	response := make([]communication.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, communication.SessionResponse{
+			ID:        session.ID,
+			CreatedAt: session.CreatedAt,
+			LastSeen:  session.LastSeen,
+			ExpiresAt: session.ExpiresAt,
+			UserAgent: session.UserAgent,
+			IP:        session.IP,
+			Current:   currentId != "" && session.ID == currentId,
+		})
+	}
+
+	util.SendResponse(w, r, http.StatusOK, response, variables.StatusOkMessage, nil, api.logger)
+}
+
+// @Summary Revoke session
+// @Tags sessions
+// @Description End one of the current user's sessions
+// @ID revoke-session
+// @Produce json
+// @Param id path string true "session id from the list of sessions"
+// @Param X-CSRF-Token header string true "value of the csrf_token cookie"
+// @Success 200 {string} string "Session ended successfully."
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.InvalidCSRFTokenError
+// @Failure 404 {string} string variables.SessionNotFoundError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /sessions/{id} [delete]
+func (api *API) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimPrefix(r.URL.Path, "/sessions/")
+	if target == "" || strings.Contains(target, "/") {
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.SessionNotFoundError, nil, api.logger)
+		return
+	}
+
+	userId, _ := r.Context().Value(variables.UserIDKey).(int64)
+	revoked, err := api.core.RevokeSession(r.Context(), userId, target)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.SessionKilledError, err, api.logger)
+		return
+	}
+
+	if !revoked {
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.SessionNotFoundError, nil, api.logger)
+		return
+	}
+
+	if target == currentSessionId(r) {
+		api.clearCookies(w)
+	}
+	util.SendResponse(w, r, http.StatusOK, nil, variables.StatusOkMessage, nil, api.logger)
+}
+
+// @Summary Logout everywhere
+// @Tags sessions
+// @Description End all sessions of the current user, this one included
+// @ID end-all-sessions
+// @Produce json
+// @Param X-CSRF-Token header string true "value of the csrf_token cookie"
+// @Success 200 {object} communication.LogoutAllResponse
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.InvalidCSRFTokenError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /logout-all [post]
+func (api *API) LogoutAllSessions(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value(variables.UserIDKey).(int64)
+	revoked, err := api.core.RevokeAllSessions(r.Context(), userId)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.SessionKilledError, err, api.logger)
+		return
+	}
+
+	api.clearCookies(w)
+	util.SendResponse(w, r, http.StatusOK, communication.LogoutAllResponse{Revoked: revoked}, variables.StatusOkMessage, nil, api.logger)
+}
+
+// @Summary List users
+// @Tags admin
+// @Description Users ordered by id, optionally only the ones with the role
+// @ID list-users
+// @Produce json
+// @Param role query string false "role"
+// @Param page query int false "page number, from 1"
+// @Param page_size query int false "page size"
+// @Success 200 {object} communication.UsersResponse
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.StatusForbiddenError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /admin/users [get]
+func (api *API) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := util.Pagination(r)
+	role := r.URL.Query().Get(variables.RoleFilter)
+
+	users, total, err := api.core.ListUsers(r.Context(), role, page, pageSize)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.ListUsersError, err, api.logger)
+		return
+	}
+
+	response := communication.UsersResponse{
+		Users:    users,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	util.SendResponse(w, r, http.StatusOK, response, variables.StatusOkMessage, nil, api.logger)
+}
+
+// AdminUser serves GET /admin/users/{id}, PUT /admin/users/{id}/role and
+// POST and DELETE /admin/users/{id}/ban.
+func (api *API) AdminUser(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/")
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusBadRequest, variables.InvalidUserIdError, variables.InvalidUserIdError, err, api.logger)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		api.GetUser(w, r, id)
+	case len(parts) == 2 && parts[1] == "role" && r.Method == http.MethodPut:
+		api.SetRole(w, r, id)
+	case len(parts) == 2 && parts[1] == "ban" && r.Method == http.MethodPost:
+		api.BanUser(w, r, id)
+	case len(parts) == 2 && parts[1] == "ban" && r.Method == http.MethodDelete:
+		api.UnbanUser(w, r, id)
+	case len(parts) <= 2:
+		util.SendResponse(w, r, http.StatusMethodNotAllowed, nil, variables.StatusMethodNotAllowedError, nil, api.logger)
+	default:
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.ProfileNotFoundError, nil, api.logger)
+	}
+}
+
+// @Summary Get user
+// @Tags admin
+// @Description User with its role
+// @ID get-user
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} models.UserItem
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.StatusForbiddenError
+// @Failure 404 {string} string variables.ProfileNotFoundError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /admin/users/{id} [get]
+func (api *API) GetUser(w http.ResponseWriter, r *http.Request, id int64) {
+	user, err := api.core.GetUser(r.Context(), id)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.GetProfileError, err, api.logger)
+		return
+	}
+
+	if user == nil {
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.ProfileNotFoundError, nil, api.logger)
+		return
+	}
+
+	util.SendResponse(w, r, http.StatusOK, user, variables.StatusOkMessage, nil, api.logger)
+}
+
+// @Summary Set role
+// @Tags admin
+// @Description Give the user another role
+// @ID set-role
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param input body communication.SetRoleRequest true "role"
+// @Success 200 {object} models.UserItem
+// @Failure 400 {string} string variables.UnknownRoleError
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.StatusForbiddenError
+// @Failure 404 {string} string variables.ProfileNotFoundError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /admin/users/{id}/role [put]
+func (api *API) SetRole(w http.ResponseWriter, r *http.Request, id int64) {
+	var setRoleRequest communication.SetRoleRequest
+
+	err := util.GetRequestBody(w, r, &setRoleRequest, api.logger)
+	if err != nil {
+		return
+	}
+
+	// An admin demoting themselves could leave nobody to undo it.
+	if userId, _ := r.Context().Value(variables.UserIDKey).(int64); userId == id {
+		util.SendResponse(w, r, http.StatusBadRequest, variables.OwnRoleChangeError, variables.OwnRoleChangeError, nil, api.logger)
+		return
+	}
+
+	user, err := api.core.SetRole(r.Context(), id, setRoleRequest.Role)
+	if errors.Is(err, variables.ErrUnknownRole) {
+		util.SendResponse(w, r, http.StatusBadRequest, variables.UnknownRoleError, variables.UnknownRoleError, nil, api.logger)
+		return
+	}
+	if errors.Is(err, variables.ErrUserNotFound) {
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.ProfileNotFoundError, nil, api.logger)
+		return
+	}
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.SetRoleError, err, api.logger)
+		return
+	}
+
+	util.SendResponse(w, r, http.StatusOK, user, variables.StatusOkMessage, nil, api.logger)
+}
+
+// @Summary Ban user
+// @Tags admin
+// @Description Ban the user until the time, for good without it, and end its sessions
+// @ID ban-user
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param input body communication.BanRequest true "ban"
+// @Success 200 {object} models.Ban
+// @Failure 400 {string} string variables.InvalidBanUntilError
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.StatusForbiddenError
+// @Failure 404 {string} string variables.ProfileNotFoundError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /admin/users/{id}/ban [post]
+func (api *API) BanUser(w http.ResponseWriter, r *http.Request, id int64) {
+	var banRequest communication.BanRequest
+
+	err := util.GetRequestBody(w, r, &banRequest, api.logger)
+	if err != nil {
+		return
+	}
+
+	userId, _ := r.Context().Value(variables.UserIDKey).(int64)
+	if userId == id {
+		util.SendResponse(w, r, http.StatusBadRequest, variables.OwnBanError, variables.OwnBanError, nil, api.logger)
+		return
+	}
+
+	ban, err := api.core.BanUser(r.Context(), id, banRequest.Until, banRequest.Reason, userId)
+	if errors.Is(err, variables.ErrInvalidUntil) {
+		util.SendResponse(w, r, http.StatusBadRequest, variables.InvalidBanUntilError, variables.InvalidBanUntilError, nil, api.logger)
+		return
+	}
+	if errors.Is(err, variables.ErrUserNotFound) {
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.ProfileNotFoundError, nil, api.logger)
+		return
+	}
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.BanUserError, err, api.logger)
+		return
+	}
+
+	util.SendResponse(w, r, http.StatusOK, ban, variables.StatusOkMessage, nil, api.logger)
+}
+
+// @Summary Unban user
+// @Tags admin
+// @Description Lift the ban of the user
+// @ID unban-user
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {string} string "Ban lifted."
+// @Failure 401 {string} string variables.StatusUnauthorizedError
+// @Failure 403 {string} string variables.StatusForbiddenError
+// @Failure 404 {string} string variables.BanNotFoundError
+// @Failure 500 {string} string variables.StatusInternalServerError
+// @Router /admin/users/{id}/ban [delete]
+func (api *API) UnbanUser(w http.ResponseWriter, r *http.Request, id int64) {
+	unbanned, err := api.core.UnbanUser(r.Context(), id)
+	if err != nil {
+		util.SendResponse(w, r, http.StatusInternalServerError, nil, variables.UnbanUserError, err, api.logger)
+		return
+	}
+
+	if !unbanned {
+		util.SendResponse(w, r, http.StatusNotFound, nil, variables.BanNotFoundError, nil, api.logger)
+		return
+	}
+
 	util.SendResponse(w, r, http.StatusOK, nil, variables.StatusOkMessage, nil, api.logger)
 }
@@ -19,8 +19,16 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Authorization_GetId_FullMethodName   = "/authorization.Authorization/GetId"
-	Authorization_GetRole_FullMethodName = "/authorization.Authorization/GetRole"
+	Authorization_GetId_FullMethodName              = "/authorization.Authorization/GetId"
+	Authorization_GetRole_FullMethodName            = "/authorization.Authorization/GetRole"
+	Authorization_GetUsersByIds_FullMethodName      = "/authorization.Authorization/GetUsersByIds"
+	Authorization_RevokeUserSessions_FullMethodName = "/authorization.Authorization/RevokeUserSessions"
+	Authorization_GetUser_FullMethodName            = "/authorization.Authorization/GetUser"
+	Authorization_SetRole_FullMethodName            = "/authorization.Authorization/SetRole"
+	Authorization_ListUsers_FullMethodName          = "/authorization.Authorization/ListUsers"
+	Authorization_GetPermissions_FullMethodName     = "/authorization.Authorization/GetPermissions"
+	Authorization_BanUser_FullMethodName            = "/authorization.Authorization/BanUser"
+	Authorization_UnbanUser_FullMethodName          = "/authorization.Authorization/UnbanUser"
 )
 
 // AuthorizationClient is the client API for Authorization service.
@@ -29,6 +37,14 @@ const (
 type AuthorizationClient interface {
 	GetId(ctx context.Context, in *FindIdRequest, opts ...grpc.CallOption) (*FindIdResponse, error)
 	GetRole(ctx context.Context, in *RoleRequest, opts ...grpc.CallOption) (*RoleResponse, error)
+	GetUsersByIds(ctx context.Context, in *UsersRequest, opts ...grpc.CallOption) (*UsersResponse, error)
+	RevokeUserSessions(ctx context.Context, in *RevokeSessionsRequest, opts ...grpc.CallOption) (*RevokeSessionsResponse, error)
+	GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error)
+	SetRole(ctx context.Context, in *SetRoleRequest, opts ...grpc.CallOption) (*User, error)
+	ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error)
+	GetPermissions(ctx context.Context, in *PermissionsRequest, opts ...grpc.CallOption) (*PermissionsResponse, error)
+	BanUser(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Ban, error)
+	UnbanUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*UnbanResponse, error)
 }
 
 type authorizationClient struct {
@@ -57,12 +73,92 @@ func (c *authorizationClient) GetRole(ctx context.Context, in *RoleRequest, opts
 	return out, nil
 }
 
+func (c *authorizationClient) GetUsersByIds(ctx context.Context, in *UsersRequest, opts ...grpc.CallOption) (*UsersResponse, error) {
+	out := new(UsersResponse)
+	err := c.cc.Invoke(ctx, Authorization_GetUsersByIds_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) RevokeUserSessions(ctx context.Context, in *RevokeSessionsRequest, opts ...grpc.CallOption) (*RevokeSessionsResponse, error) {
+	out := new(RevokeSessionsResponse)
+	err := c.cc.Invoke(ctx, Authorization_RevokeUserSessions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, Authorization_GetUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) SetRole(ctx context.Context, in *SetRoleRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, Authorization_SetRole_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error) {
+	out := new(ListUsersResponse)
+	err := c.cc.Invoke(ctx, Authorization_ListUsers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) GetPermissions(ctx context.Context, in *PermissionsRequest, opts ...grpc.CallOption) (*PermissionsResponse, error) {
+	out := new(PermissionsResponse)
+	err := c.cc.Invoke(ctx, Authorization_GetPermissions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) BanUser(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Ban, error) {
+	out := new(Ban)
+	err := c.cc.Invoke(ctx, Authorization_BanUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authorizationClient) UnbanUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*UnbanResponse, error) {
+	out := new(UnbanResponse)
+	err := c.cc.Invoke(ctx, Authorization_UnbanUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AuthorizationServer is the server API for Authorization service.
 // All implementations must embed UnimplementedAuthorizationServer
 // for forward compatibility
 type AuthorizationServer interface {
 	GetId(context.Context, *FindIdRequest) (*FindIdResponse, error)
 	GetRole(context.Context, *RoleRequest) (*RoleResponse, error)
+	GetUsersByIds(context.Context, *UsersRequest) (*UsersResponse, error)
+	RevokeUserSessions(context.Context, *RevokeSessionsRequest) (*RevokeSessionsResponse, error)
+	GetUser(context.Context, *UserRequest) (*User, error)
+	SetRole(context.Context, *SetRoleRequest) (*User, error)
+	ListUsers(context.Context, *ListUsersRequest) (*ListUsersResponse, error)
+	GetPermissions(context.Context, *PermissionsRequest) (*PermissionsResponse, error)
+	BanUser(context.Context, *BanRequest) (*Ban, error)
+	UnbanUser(context.Context, *UserRequest) (*UnbanResponse, error)
 	mustEmbedUnimplementedAuthorizationServer()
 }
 
@@ -76,6 +172,30 @@ func (UnimplementedAuthorizationServer) GetId(context.Context, *FindIdRequest) (
 func (UnimplementedAuthorizationServer) GetRole(context.Context, *RoleRequest) (*RoleResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetRole not implemented")
 }
+func (UnimplementedAuthorizationServer) GetUsersByIds(context.Context, *UsersRequest) (*UsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsersByIds not implemented")
+}
+func (UnimplementedAuthorizationServer) RevokeUserSessions(context.Context, *RevokeSessionsRequest) (*RevokeSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeUserSessions not implemented")
+}
+func (UnimplementedAuthorizationServer) GetUser(context.Context, *UserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedAuthorizationServer) SetRole(context.Context, *SetRoleRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRole not implemented")
+}
+func (UnimplementedAuthorizationServer) ListUsers(context.Context, *ListUsersRequest) (*ListUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedAuthorizationServer) GetPermissions(context.Context, *PermissionsRequest) (*PermissionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPermissions not implemented")
+}
+func (UnimplementedAuthorizationServer) BanUser(context.Context, *BanRequest) (*Ban, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanUser not implemented")
+}
+func (UnimplementedAuthorizationServer) UnbanUser(context.Context, *UserRequest) (*UnbanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnbanUser not implemented")
+}
 func (UnimplementedAuthorizationServer) mustEmbedUnimplementedAuthorizationServer() {}
 
 // UnsafeAuthorizationServer may be embedded to opt out of forward compatibility for this service.
@@ -125,6 +245,150 @@ func _Authorization_GetRole_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Authorization_GetUsersByIds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).GetUsersByIds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_GetUsersByIds_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).GetUsersByIds(ctx, req.(*UsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_RevokeUserSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).RevokeUserSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_RevokeUserSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).RevokeUserSessions(ctx, req.(*RevokeSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).GetUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_SetRole_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRoleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).SetRole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_SetRole_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).SetRole(ctx, req.(*SetRoleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_ListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).ListUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_ListUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).ListUsers(ctx, req.(*ListUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_GetPermissions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PermissionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).GetPermissions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_GetPermissions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).GetPermissions(ctx, req.(*PermissionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_BanUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).BanUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_BanUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).BanUser(ctx, req.(*BanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Authorization_UnbanUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthorizationServer).UnbanUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Authorization_UnbanUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthorizationServer).UnbanUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Authorization_ServiceDesc is the grpc.ServiceDesc for Authorization service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -140,6 +404,38 @@ var Authorization_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetRole",
 			Handler:    _Authorization_GetRole_Handler,
 		},
+		{
+			MethodName: "GetUsersByIds",
+			Handler:    _Authorization_GetUsersByIds_Handler,
+		},
+		{
+			MethodName: "RevokeUserSessions",
+			Handler:    _Authorization_RevokeUserSessions_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Authorization_GetUser_Handler,
+		},
+		{
+			MethodName: "SetRole",
+			Handler:    _Authorization_SetRole_Handler,
+		},
+		{
+			MethodName: "ListUsers",
+			Handler:    _Authorization_ListUsers_Handler,
+		},
+		{
+			MethodName: "GetPermissions",
+			Handler:    _Authorization_GetPermissions_Handler,
+		},
+		{
+			MethodName: "BanUser",
+			Handler:    _Authorization_BanUser_Handler,
+		},
+		{
+			MethodName: "UnbanUser",
+			Handler:    _Authorization_UnbanUser_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "authorization.proto",
@@ -9,6 +9,8 @@ import (
 	"ozon-task/pkg/variables"
 	"time"
 
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
 	_ "github.com/jackc/pgx/stdlib"
 )
 
@@ -71,59 +73,75 @@ func (repository *ProfileRelationalRepository) pingDb(timer uint32, logger *slog
 }
 
 func (repository *ProfileRelationalRepository) CreateUser(login string, password []byte) error {
-	_, err := repository.db.Exec(
-		`INSERT INTO password(value)
-			   VALUES ($1)`, password)
+	tx, err := repository.db.Begin()
 	if err != nil {
-		return fmt.Errorf(variables.SqlProfileCreateError, err)
+		return fmt.Errorf(variables.SqlProfileCreateError+": %w", err)
 	}
+	defer tx.Rollback()
 
-	_, errProfile := repository.db.Exec(
-		`INSERT INTO profile(login, password_id)
-			   VALUES ($1, (SELECT id FROM password WHERE value = $2 LIMIT 1))`,
-		login, password)
-	if errProfile != nil {
-		return fmt.Errorf(variables.SqlProfileCreateError, err)
+	var passwordId int64
+	err = tx.QueryRow(`INSERT INTO password(value) VALUES ($1) RETURNING id`, password).Scan(&passwordId)
+	if err != nil {
+		return fmt.Errorf(variables.SqlProfileCreateError+": %w", err)
 	}
 
-	_, errRole := repository.db.Exec(`INSERT INTO profile_role(profile_id, role_id)
-                                             VALUES ((SELECT id FROM profile WHERE login = $1), $2)`, login, variables.UserRoleId)
-	if errRole != nil {
-		return fmt.Errorf(variables.SqlProfileCreateError, err)
+	var profileId int64
+	err = tx.QueryRow(`INSERT INTO profile(login, password_id) VALUES ($1, $2) RETURNING id`, login, passwordId).Scan(&profileId)
+	var pgErr pgx.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == variables.UniqueViolationCode {
+		return variables.ErrLoginTaken
+	}
+	if err != nil {
+		return fmt.Errorf(variables.SqlProfileCreateError+": %w", err)
 	}
-	return nil
-}
 
-func (repository *ProfileRelationalRepository) FindUser(login string) (bool, error) {
-	userItem := &models.UserItem{}
+	var profileRoleId int64
+	err = tx.QueryRow(`INSERT INTO profile_role(profile_id, role_id) VALUES ($1, $2) RETURNING id`, profileId, variables.UserRoleId).Scan(&profileRoleId)
+	if err != nil {
+		return fmt.Errorf(variables.SqlProfileCreateError+": %w", err)
+	}
 
-	err := repository.db.QueryRow(
-		`SELECT login FROM profile
-			   WHERE login = $1`, login).Scan(&userItem.Login)
+	_, err = tx.Exec(`UPDATE profile SET profile_role_id = $2 WHERE id = $1`, profileId, profileRoleId)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
-		return false, fmt.Errorf(variables.ProfileNotFoundError, err.Error())
+		return fmt.Errorf(variables.SqlProfileCreateError+": %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf(variables.SqlProfileCreateError+": %w", err)
 	}
-	return true, nil
+	return nil
 }
 
-func (repository *ProfileRelationalRepository) GetUser(login string, password []byte) (*models.UserItem, bool, error) {
+// GetUserCredentials returns the user with the stored password hash, nil
+// if there is no such login.
+func (repository *ProfileRelationalRepository) GetUserCredentials(login string) (*models.UserItem, []byte, error) {
 	userItem := &models.UserItem{}
+	var password []byte
 
 	err := repository.db.QueryRow(
-		`SELECT login FROM profile
+		`SELECT profile.id, profile.login, password.value FROM profile
 			JOIN password ON profile.password_id = password.id
-			WHERE profile.login = $1 AND password.value = $2`, login, password).Scan(&userItem.Login)
+			WHERE profile.login = $1`, login).Scan(&userItem.Id, &userItem.Login, &password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, false, fmt.Errorf(variables.InvalidLoginOrPasswordError, ": %w", err)
+			return nil, nil, nil
 		}
-		return nil, false, fmt.Errorf(variables.ProfileNotFoundError, ": %w", err)
+		return nil, nil, fmt.Errorf(variables.ProfileNotFoundError+": %w", err)
+	}
+
+	return userItem, password, nil
+}
+
+func (repository *ProfileRelationalRepository) UpdatePassword(id int64, password []byte) error {
+	_, err := repository.db.Exec(
+		`UPDATE password SET value = $2
+			WHERE id = (SELECT password_id FROM profile WHERE id = $1)`, id, password)
+	if err != nil {
+		return fmt.Errorf(variables.UpdatePasswordError+": %w", err)
 	}
 
-	return userItem, true, nil
+	return nil
 }
 
 func (repository *ProfileRelationalRepository) GetUserProfileId(login string) (int64, error) {
@@ -152,3 +170,220 @@ func (repository *ProfileRelationalRepository) GetUserRole(id int64) (string, er
 
 	return role, nil
 }
+
+// GetUserPermissions returns the permissions granted to the role of the
+// user. A banned user has none, whatever the role.
+func (repository *ProfileRelationalRepository) GetUserPermissions(id int64) ([]string, error) {
+	rows, err := repository.db.Query(`SELECT DISTINCT permission.value FROM profile_role
+		JOIN role_permission ON profile_role.role_id = role_permission.role_id
+		JOIN permission ON role_permission.permission_id = permission.id
+		WHERE profile_role.profile_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM ban WHERE ban.profile_id = $1 AND (ban.until IS NULL OR ban.until > now())
+		)
+		ORDER BY permission.value`, id)
+	if err != nil {
+		return nil, fmt.Errorf(variables.GetPermissionsError+": %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, fmt.Errorf(variables.GetPermissionsError+": %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (repository *ProfileRelationalRepository) GetUsersByIds(ids []int64) ([]*models.UserItem, error) {
+	profileIds := &pgtype.Int8Array{}
+	err := profileIds.Set(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repository.db.Query("SELECT id, login FROM profile WHERE id = ANY($1)", profileIds)
+	if err != nil {
+		return nil, fmt.Errorf(variables.ProfileNotFoundError+": %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.UserItem
+	for rows.Next() {
+		var user models.UserItem
+		err := rows.Scan(&user.Id, &user.Login)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// GetUser returns the user with its role, nil if there is no such user.
+func (repository *ProfileRelationalRepository) GetUser(id int64) (*models.UserItem, error) {
+	user := &models.UserItem{}
+
+	err := repository.db.QueryRow(`SELECT profile.id, profile.login, COALESCE(role.value, '') FROM profile
+		LEFT JOIN profile_role ON profile.id = profile_role.profile_id
+		LEFT JOIN role ON profile_role.role_id = role.id
+		WHERE profile.id = $1`, id).Scan(&user.Id, &user.Login, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(variables.GetProfileError+": %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns a page of users ordered by id together with the number
+// of all users. An empty role lists users of every role.
+func (repository *ProfileRelationalRepository) ListUsers(role string, page uint64, pageSize uint64) ([]*models.UserItem, int64, error) {
+	var total int64
+	err := repository.db.QueryRow(`SELECT count(*) FROM profile
+		LEFT JOIN profile_role ON profile.id = profile_role.profile_id
+		LEFT JOIN role ON profile_role.role_id = role.id
+		WHERE $1 = '' OR role.value = $1`, role).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf(variables.ListUsersError+": %w", err)
+	}
+
+	rows, err := repository.db.Query(`SELECT profile.id, profile.login, COALESCE(role.value, '') FROM profile
+		LEFT JOIN profile_role ON profile.id = profile_role.profile_id
+		LEFT JOIN role ON profile_role.role_id = role.id
+		WHERE $1 = '' OR role.value = $1
+		ORDER BY profile.id
+		LIMIT $2 OFFSET $3`, role, int64(pageSize), int64((page-1)*pageSize))
+	if err != nil {
+		return nil, 0, fmt.Errorf(variables.ListUsersError+": %w", err)
+	}
+	defer rows.Close()
+
+	users := []*models.UserItem{}
+	for rows.Next() {
+		var user models.UserItem
+		err := rows.Scan(&user.Id, &user.Login, &user.Role)
+		if err != nil {
+			return nil, 0, fmt.Errorf(variables.ListUsersError+": %w", err)
+		}
+		users = append(users, &user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// SetRole replaces the role of the user. Profiles created before
+// profile_role_id was filled in get it set on the way.
+func (repository *ProfileRelationalRepository) SetRole(id int64, role string) (*models.UserItem, error) {
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf(variables.SetRoleError+": %w", err)
+	}
+	defer tx.Rollback()
+
+	user := &models.UserItem{Id: id, Role: role}
+	err = tx.QueryRow(`SELECT login FROM profile WHERE id = $1 FOR UPDATE`, id).Scan(&user.Login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, variables.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf(variables.SetRoleError+": %w", err)
+	}
+
+	var roleId int64
+	err = tx.QueryRow(`SELECT id FROM role WHERE value = $1`, role).Scan(&roleId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, variables.ErrUnknownRole
+	}
+	if err != nil {
+		return nil, fmt.Errorf(variables.SetRoleError+": %w", err)
+	}
+
+	var profileRoleId int64
+	err = tx.QueryRow(`UPDATE profile_role SET role_id = $2 WHERE profile_id = $1 RETURNING id`, id, roleId).Scan(&profileRoleId)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow(`INSERT INTO profile_role(profile_id, role_id) VALUES ($1, $2) RETURNING id`, id, roleId).Scan(&profileRoleId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(variables.SetRoleError+": %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE profile SET profile_role_id = $2 WHERE id = $1`, id, profileRoleId)
+	if err != nil {
+		return nil, fmt.Errorf(variables.SetRoleError+": %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf(variables.SetRoleError+": %w", err)
+	}
+
+	return user, nil
+}
+
+// BanUser bans the user until the time, for good when until is nil. A new
+// ban replaces the previous one of the user.
+func (repository *ProfileRelationalRepository) BanUser(id int64, until *time.Time, reason string, bannedBy int64) (*models.Ban, error) {
+	if until != nil && !until.After(time.Now()) {
+		return nil, variables.ErrInvalidUntil
+	}
+
+	ban := &models.Ban{UserId: id, Until: until, Reason: reason, BannedBy: bannedBy}
+	err := repository.db.QueryRow(`INSERT INTO ban(profile_id, until, reason, banned_by)
+		SELECT id, $2::timestamptz, $3::text, NULLIF($4::int, 0) FROM profile WHERE id = $1
+		ON CONFLICT (profile_id) DO UPDATE SET until = EXCLUDED.until, reason = EXCLUDED.reason,
+			banned_by = EXCLUDED.banned_by, created_at = now()
+		RETURNING created_at`, id, until, reason, bannedBy).Scan(&ban.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, variables.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf(variables.BanUserError+": %w", err)
+	}
+
+	return ban, nil
+}
+
+// UnbanUser lifts the ban of the user and tells whether there was one.
+func (repository *ProfileRelationalRepository) UnbanUser(id int64) (bool, error) {
+	result, err := repository.db.Exec(`DELETE FROM ban WHERE profile_id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf(variables.UnbanUserError+": %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf(variables.UnbanUserError+": %w", err)
+	}
+
+	return deleted > 0, nil
+}
+
+// GetActiveBan returns the ban of the user that is still in force, nil if
+// there is none.
+func (repository *ProfileRelationalRepository) GetActiveBan(id int64) (*models.Ban, error) {
+	ban := &models.Ban{UserId: id}
+	var until sql.NullTime
+
+	err := repository.db.QueryRow(`SELECT until, reason, COALESCE(banned_by, 0), created_at FROM ban
+		WHERE profile_id = $1 AND (until IS NULL OR until > now())`, id).Scan(&until, &ban.Reason, &ban.BannedBy, &ban.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(variables.GetBanError+": %w", err)
+	}
+
+	if until.Valid {
+		ban.Until = &until.Time
+	}
+
+	return ban, nil
+}
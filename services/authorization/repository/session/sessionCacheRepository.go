@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log/slog"
 	"ozon-task/pkg/models"
+	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
+	"sort"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -89,8 +91,80 @@ func GetSessionRepository(sessionConfig *variables.CacheDataBaseConfig, logger *
 	return sessionCacheRepository, nil
 }
 
-func (sessionCacheRepository *SessionCacheRepository) SaveSessionCache(ctx context.Context, createdSessionObject models.Session, logger *slog.Logger) (bool, error) {
-	sessionCacheRepository.sessionRedisClient.Set(ctx, createdSessionObject.SID, createdSessionObject.Login, 24*time.Hour)
+// Sessions are kept as hashes with their metadata under the hash of their
+// id, every login also has a set with the hashed ids of its sessions.
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(login string) string {
+	return "user:" + login + ":sessions"
+}
+
+// sessionDeadline is the moment a session used at lastSeen expires: after
+// the idle timeout, but never past its absolute expiry.
+func sessionDeadline(lastSeen time.Time, idleTimeout time.Duration, expiresAt time.Time) time.Time {
+	deadline := lastSeen.Add(idleTimeout)
+	if !expiresAt.IsZero() && expiresAt.Before(deadline) {
+		return expiresAt
+	}
+	return deadline
+}
+
+// touchSessionScript slides a session only while it exists, so a session
+// deleted in between is not brought back as a partial hash.
+var touchSessionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'last_seen', ARGV[1])
+redis.call('PEXPIREAT', KEYS[1], ARGV[2])
+return 1
+`)
+
+// rotateSessionScript copies the session under a new id and leaves the old
+// one alive for the grace period. A session is rotated only once. The new
+// session remembers the old id in rotated_from, so revoking it ends the
+// grace period as well. The ids are hashed.
+var rotateSessionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('HEXISTS', KEYS[1], 'rotated_to') == 1 then
+	return 0
+end
+local fields = redis.call('HGETALL', KEYS[1])
+redis.call('HSET', KEYS[2], unpack(fields))
+redis.call('HSET', KEYS[2], 'rotated_at', ARGV[3], 'last_seen', ARGV[3], 'rotated_from', ARGV[1])
+redis.call('PEXPIREAT', KEYS[2], ARGV[4])
+redis.call('HSET', KEYS[1], 'rotated_to', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+redis.call('SREM', KEYS[3], ARGV[1])
+redis.call('SADD', KEYS[3], ARGV[2])
+return 1
+`)
+
+func (sessionCacheRepository *SessionCacheRepository) SaveSessionCache(ctx context.Context, createdSessionObject models.Session, idleTimeout time.Duration, logger *slog.Logger) (bool, error) {
+	id := util.HashSessionID(createdSessionObject.SID)
+	key := sessionKey(id)
+	usersKey := userSessionsKey(createdSessionObject.Login)
+
+	_, err := sessionCacheRepository.sessionRedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"login":      createdSessionObject.Login,
+			"created_at": createdSessionObject.CreatedAt.Format(time.RFC3339Nano),
+			"last_seen":  createdSessionObject.LastSeen.Format(time.RFC3339Nano),
+			"expires_at": createdSessionObject.ExpiresAt.Format(time.RFC3339Nano),
+			"user_agent": createdSessionObject.UserAgent,
+			"ip":         createdSessionObject.IP,
+		})
+		pipe.ExpireAt(ctx, key, sessionDeadline(createdSessionObject.LastSeen, idleTimeout, createdSessionObject.ExpiresAt))
+		pipe.SAdd(ctx, usersKey, id)
+		// The set lives as long as the newest session of the user.
+		pipe.ExpireAt(ctx, usersKey, createdSessionObject.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		logger.Error(variables.SessionCreateError, "error", err.Error())
+		return false, err
+	}
 
 	sessionAdded, errCheck := sessionCacheRepository.GetSessionCache(ctx, createdSessionObject.SID, logger)
 
@@ -102,24 +176,59 @@ func (sessionCacheRepository *SessionCacheRepository) SaveSessionCache(ctx conte
 }
 
 func (sessionCacheRepository *SessionCacheRepository) GetSessionCache(ctx context.Context, sid string, logger *slog.Logger) (bool, error) {
-	_, err := sessionCacheRepository.sessionRedisClient.Get(ctx, sid).Result()
-	if err == redis.Nil {
-		logger.Error(fmt.Sprintf(variables.SessionNotFoundError + sid))
-		return false, nil
-	}
-
+	id := util.HashSessionID(sid)
+	exists, err := sessionCacheRepository.sessionRedisClient.Exists(ctx, sessionKey(id)).Result()
 	if err != nil {
-		logger.Error(variables.StatusInternalServerError, err)
+		logger.Error(variables.StatusInternalServerError, "error", err.Error())
 		return false, err
 	}
 
+	if exists == 0 {
+		logger.Error(variables.SessionNotFoundError, "session", id)
+		return false, nil
+	}
+
 	return true, nil
 }
 
+// DeleteSessionCache removes the session. Deleting a rotated id removes its
+// replacement as well, deleting a replacement removes the id it rotated
+// from.
 func (sessionCacheRepository *SessionCacheRepository) DeleteSessionCache(ctx context.Context, sid string, logger *slog.Logger) (bool, error) {
-	_, err := sessionCacheRepository.sessionRedisClient.Del(ctx, sid).Result()
+	return sessionCacheRepository.deleteSession(ctx, util.HashSessionID(sid), logger)
+}
+
+// deleteSession removes the session with the hashed id.
+func (sessionCacheRepository *SessionCacheRepository) deleteSession(ctx context.Context, id string, logger *slog.Logger) (bool, error) {
+	key := sessionKey(id)
+
+	values, err := sessionCacheRepository.sessionRedisClient.HMGet(ctx, key, "login", "rotated_to", "rotated_from").Result()
 	if err != nil {
-		logger.Error(variables.SessionRemoveError, err)
+		logger.Error(variables.SessionRemoveError, "error", err.Error())
+		return false, err
+	}
+
+	login, ok := values[0].(string)
+	if !ok {
+		return false, nil
+	}
+
+	ids := []string{id}
+	for _, value := range values[1:] {
+		if related, ok := value.(string); ok && related != "" {
+			ids = append(ids, related)
+		}
+	}
+
+	_, err = sessionCacheRepository.sessionRedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, sessionKey(id))
+			pipe.SRem(ctx, userSessionsKey(login), id)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(variables.SessionRemoveError, "error", err.Error())
 		return false, err
 	}
 
@@ -127,11 +236,241 @@ func (sessionCacheRepository *SessionCacheRepository) DeleteSessionCache(ctx con
 }
 
 func (sessionCacheRepository *SessionCacheRepository) GetUserLogin(ctx context.Context, sid string, logger *slog.Logger) (string, error) {
-	value, err := sessionCacheRepository.sessionRedisClient.Get(ctx, sid).Result()
+	id := util.HashSessionID(sid)
+	value, err := sessionCacheRepository.sessionRedisClient.HGet(ctx, sessionKey(id), "login").Result()
 	if err != nil {
-		logger.Error(variables.SessionNotFoundError + sid)
+		logger.Error(variables.SessionNotFoundError, "session", id)
 		return "", err
 	}
 
 	return value, nil
 }
+
+// RefreshSession marks the session as used and slides its expiry. Once the
+// rotation interval has passed the session gets a new id, which is returned
+// in the SID of the result.
+func (sessionCacheRepository *SessionCacheRepository) RefreshSession(ctx context.Context, sid string, config variables.SessionConfig, logger *slog.Logger) (models.Session, error) {
+	id := util.HashSessionID(sid)
+	fields, err := sessionCacheRepository.sessionRedisClient.HGetAll(ctx, sessionKey(id)).Result()
+	if err != nil {
+		logger.Error(variables.SessionUpdateError, "error", err.Error())
+		return models.Session{}, err
+	}
+
+	if len(fields) == 0 {
+		logger.Error(variables.SessionNotFoundError, "session", id)
+		return models.Session{}, redis.Nil
+	}
+
+	session := parseSession(id, fields)
+	session.SID = sid
+	if session.RotatedTo != "" {
+		return session, nil
+	}
+
+	now := time.Now()
+	deadline := sessionDeadline(now, config.IdleTimeout, session.ExpiresAt)
+
+	rotatedAt := session.RotatedAt
+	if rotatedAt.IsZero() {
+		rotatedAt = session.CreatedAt
+	}
+
+	if config.RotationInterval > 0 && now.Sub(rotatedAt) >= config.RotationInterval {
+		newSid, err := util.RandomToken(variables.SessionIdBytes)
+		if err != nil {
+			logger.Error(variables.SessionUpdateError, "error", err.Error())
+			return models.Session{}, err
+		}
+
+		newId := util.HashSessionID(newSid)
+		rotated, err := rotateSessionScript.Run(ctx, sessionCacheRepository.sessionRedisClient,
+			[]string{sessionKey(id), sessionKey(newId), userSessionsKey(session.Login)},
+			id, newId, now.Format(time.RFC3339Nano), deadline.UnixMilli(), variables.SessionRotationGrace.Milliseconds()).Int()
+		if err != nil {
+			logger.Error(variables.SessionUpdateError, "error", err.Error())
+			return models.Session{}, err
+		}
+
+		// Zero means a concurrent request has rotated the session first, the
+		// old id stays usable for the grace period.
+		if rotated == 1 {
+			session.SID = newSid
+			session.ID = newId
+			session.RotatedAt = now
+			session.LastSeen = now
+		}
+		return session, nil
+	}
+
+	touched, err := touchSessionScript.Run(ctx, sessionCacheRepository.sessionRedisClient,
+		[]string{sessionKey(id)}, now.Format(time.RFC3339Nano), deadline.UnixMilli()).Int()
+	if err != nil {
+		logger.Error(variables.SessionUpdateError, "error", err.Error())
+		return models.Session{}, err
+	}
+
+	if touched == 0 {
+		return models.Session{}, redis.Nil
+	}
+
+	session.LastSeen = now
+	return session, nil
+}
+
+// GetUserSessions returns the active sessions of the login. Ids of expired
+// sessions are dropped from the set on the way.
+func (sessionCacheRepository *SessionCacheRepository) GetUserSessions(ctx context.Context, login string, logger *slog.Logger) ([]models.Session, error) {
+	usersKey := userSessionsKey(login)
+
+	ids, err := sessionCacheRepository.sessionRedisClient.SMembers(ctx, usersKey).Result()
+	if err != nil {
+		logger.Error(variables.SessionListError, "error", err.Error())
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return []models.Session{}, nil
+	}
+
+	pipe := sessionCacheRepository.sessionRedisClient.Pipeline()
+	commands := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		commands[i] = pipe.HGetAll(ctx, sessionKey(id))
+	}
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		logger.Error(variables.SessionListError, "error", err.Error())
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0, len(ids))
+	var expired []interface{}
+	for i, command := range commands {
+		fields := command.Val()
+		if len(fields) == 0 {
+			expired = append(expired, ids[i])
+			continue
+		}
+
+		sessions = append(sessions, parseSession(ids[i], fields))
+	}
+
+	if len(expired) > 0 {
+		err = sessionCacheRepository.sessionRedisClient.SRem(ctx, usersKey, expired...).Err()
+		if err != nil {
+			logger.Error(variables.SessionRemoveError, "error", err.Error())
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// DeleteUserSession removes the session with the hashed id only if it
+// belongs to the login.
+func (sessionCacheRepository *SessionCacheRepository) DeleteUserSession(ctx context.Context, login string, id string, logger *slog.Logger) (bool, error) {
+	owned, err := sessionCacheRepository.sessionRedisClient.SIsMember(ctx, userSessionsKey(login), id).Result()
+	if err != nil {
+		logger.Error(variables.SessionRemoveError, "error", err.Error())
+		return false, err
+	}
+
+	if !owned {
+		return false, nil
+	}
+
+	return sessionCacheRepository.deleteSession(ctx, id, logger)
+}
+
+// DeleteUserSessions removes every session of the login, the old ids of
+// rotated sessions still in their grace period included, and returns how
+// many of them were still active.
+func (sessionCacheRepository *SessionCacheRepository) DeleteUserSessions(ctx context.Context, login string, logger *slog.Logger) (int64, error) {
+	usersKey := userSessionsKey(login)
+
+	ids, err := sessionCacheRepository.sessionRedisClient.SMembers(ctx, usersKey).Result()
+	if err != nil {
+		logger.Error(variables.SessionRemoveError, "error", err.Error())
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+
+	rotatedFrom, err := sessionCacheRepository.rotatedFrom(ctx, keys)
+	if err != nil {
+		logger.Error(variables.SessionRemoveError, "error", err.Error())
+		return 0, err
+	}
+
+	var deleted *redis.IntCmd
+	_, err = sessionCacheRepository.sessionRedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(keys) > 0 {
+			deleted = pipe.Del(ctx, keys...)
+		}
+		if len(rotatedFrom) > 0 {
+			pipe.Del(ctx, rotatedFrom...)
+		}
+		pipe.Del(ctx, usersKey)
+		return nil
+	})
+	if err != nil {
+		logger.Error(variables.SessionRemoveError, "error", err.Error())
+		return 0, err
+	}
+
+	if deleted == nil {
+		return 0, nil
+	}
+
+	return deleted.Val(), nil
+}
+
+// rotatedFrom returns the keys of the old ids the sessions were rotated
+// from.
+func (sessionCacheRepository *SessionCacheRepository) rotatedFrom(ctx context.Context, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := sessionCacheRepository.sessionRedisClient.Pipeline()
+	commands := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		commands[i] = pipe.HGet(ctx, key, "rotated_from")
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var rotatedFrom []string
+	for _, command := range commands {
+		if id := command.Val(); id != "" {
+			rotatedFrom = append(rotatedFrom, sessionKey(id))
+		}
+	}
+	return rotatedFrom, nil
+}
+
+func parseSession(id string, fields map[string]string) models.Session {
+	session := models.Session{
+		Login:     fields["login"],
+		ID:        id,
+		UserAgent: fields["user_agent"],
+		IP:        fields["ip"],
+	}
+
+	session.CreatedAt, _ = time.Parse(time.RFC3339Nano, fields["created_at"])
+	session.LastSeen, _ = time.Parse(time.RFC3339Nano, fields["last_seen"])
+	session.ExpiresAt, _ = time.Parse(time.RFC3339Nano, fields["expires_at"])
+	session.RotatedAt, _ = time.Parse(time.RFC3339Nano, fields["rotated_at"])
+	session.RotatedTo = fields["rotated_to"]
+
+	return session
+}
@@ -2,9 +2,12 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"ozon-task/pkg/models"
+	"ozon-task/pkg/ratelimit"
+	"ozon-task/pkg/tokens"
 	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/authorization/repository/profile"
@@ -16,27 +19,44 @@ import (
 
 type IProfileRelationalRepository interface {
 	CreateUser(login string, password []byte) error
-	FindUser(login string) (bool, error)
-	GetUser(login string, password []byte) (*models.UserItem, bool, error)
+	GetUserCredentials(login string) (*models.UserItem, []byte, error)
+	UpdatePassword(id int64, password []byte) error
 	GetUserProfileId(login string) (int64, error)
 	GetUserRole(id int64) (string, error)
+	GetUser(id int64) (*models.UserItem, error)
+	ListUsers(role string, page uint64, pageSize uint64) ([]*models.UserItem, int64, error)
+	SetRole(id int64, role string) (*models.UserItem, error)
+	BanUser(id int64, until *time.Time, reason string, bannedBy int64) (*models.Ban, error)
+	UnbanUser(id int64) (bool, error)
+	GetActiveBan(id int64) (*models.Ban, error)
 }
 
 type ISessionCacheRepository interface {
-	SaveSessionCache(ctx context.Context, createdSessionObject models.Session, logger *slog.Logger) (bool, error)
+	SaveSessionCache(ctx context.Context, createdSessionObject models.Session, idleTimeout time.Duration, logger *slog.Logger) (bool, error)
 	GetSessionCache(ctx context.Context, sid string, logger *slog.Logger) (bool, error)
 	DeleteSessionCache(ctx context.Context, sid string, logger *slog.Logger) (bool, error)
 	GetUserLogin(ctx context.Context, sid string, logger *slog.Logger) (string, error)
+	RefreshSession(ctx context.Context, sid string, config variables.SessionConfig, logger *slog.Logger) (models.Session, error)
+	GetUserSessions(ctx context.Context, login string, logger *slog.Logger) ([]models.Session, error)
+	DeleteUserSession(ctx context.Context, login string, sid string, logger *slog.Logger) (bool, error)
+	DeleteUserSessions(ctx context.Context, login string, logger *slog.Logger) (int64, error)
 }
 
 type Core struct {
-	sessions ISessionCacheRepository
-	logger   *slog.Logger
-	mutex    sync.RWMutex
-	profiles IProfileRelationalRepository
+	sessions     ISessionCacheRepository
+	logger       *slog.Logger
+	mutex        sync.RWMutex
+	profiles     IProfileRelationalRepository
+	passwordHash *variables.PasswordHashConfig
+	session      variables.SessionConfig
+	tokens       *tokens.Manager
+	limiter      *ratelimit.Limiter
+	// dummyHash is checked against for unknown logins, so they cost as much
+	// as known ones and the response time doesn't tell them apart.
+	dummyHash []byte
 }
 
-func GetCore(profileConfig *variables.RelationalDataBaseConfig, sessionConfig *variables.CacheDataBaseConfig, logger *slog.Logger) (*Core, error) {
+func GetCore(profileConfig *variables.RelationalDataBaseConfig, sessionConfig *variables.CacheDataBaseConfig, appConfig *variables.AppConfig, logger *slog.Logger) (*Core, error) {
 	sessionRepository, err := session.GetSessionRepository(sessionConfig, logger)
 	if err != nil {
 		logger.Error(variables.SessionRepositoryNotActiveError)
@@ -49,25 +69,62 @@ func GetCore(profileConfig *variables.RelationalDataBaseConfig, sessionConfig *v
 		return nil, err
 	}
 
+	tokenManager, err := tokens.GetManager(&appConfig.Token)
+	if err != nil {
+		logger.Error(variables.TokenConfigError, "error", err.Error())
+		return nil, err
+	}
+
+	limiter, err := ratelimit.GetLimiter(sessionConfig, &appConfig.RateLimit)
+	if err != nil {
+		logger.Error(variables.RateLimitError, "error", err.Error())
+		return nil, err
+	}
+
+	dummyPassword, err := util.RandomToken(variables.SessionIdBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	dummyHash, err := util.HashPassword(dummyPassword, &appConfig.PasswordHash)
+	if err != nil {
+		logger.Error(variables.InvalidPasswordHashError, "error", err.Error())
+		return nil, err
+	}
+
 	core := Core{
-		sessions: sessionRepository,
-		logger:   logger.With(variables.ModuleLogger, variables.CoreModuleLogger),
-		profiles: profileRepository,
+		sessions:     sessionRepository,
+		logger:       logger.With(variables.ModuleLogger, variables.CoreModuleLogger),
+		profiles:     profileRepository,
+		passwordHash: &appConfig.PasswordHash,
+		session:      util.SessionParams(&appConfig.Session),
+		tokens:       tokenManager,
+		limiter:      limiter,
+		dummyHash:    dummyHash,
 	}
 
 	return &core, nil
 }
 
-func (core *Core) CreateSession(ctx context.Context, login string) (models.Session, error) {
-	sid := util.RandStringRunes(32)
+func (core *Core) CreateSession(ctx context.Context, login string, userAgent string, ip string) (models.Session, error) {
+	sid, err := util.RandomToken(variables.SessionIdBytes)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	now := time.Now()
 
 	newSession := models.Session{
 		Login:     login,
 		SID:       sid,
-		ExpiresAt: time.Now().Add(time.Hour * 24),
+		ExpiresAt: now.Add(core.session.AbsoluteTimeout),
+		CreatedAt: now,
+		LastSeen:  now,
+		UserAgent: userAgent,
+		IP:        ip,
 	}
 	core.mutex.Lock()
-	sessionAdded, err := core.sessions.SaveSessionCache(ctx, newSession, core.logger)
+	sessionAdded, err := core.sessions.SaveSessionCache(ctx, newSession, core.session.IdleTimeout, core.logger)
 	defer core.mutex.Unlock()
 
 	if !sessionAdded && err != nil {
@@ -105,6 +162,54 @@ func (core *Core) FindActiveSession(ctx context.Context, sid string) (bool, erro
 	return found, nil
 }
 
+// userLogin returns the login of the user, sessions are kept by login.
+func (core *Core) userLogin(id int64) (string, error) {
+	user, err := core.profiles.GetUser(id)
+	if err != nil {
+		core.logger.Error(variables.GetProfileError, "error", err.Error())
+		return "", err
+	}
+
+	return user.Login, nil
+}
+
+// ListSessions returns the active sessions of the user.
+func (core *Core) ListSessions(ctx context.Context, userId int64) ([]models.Session, error) {
+	login, err := core.userLogin(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.sessions.GetUserSessions(ctx, login, core.logger)
+}
+
+// RevokeSession ends a session of the user, target is its id from the list
+// of sessions. Sessions of other users are reported as not found.
+func (core *Core) RevokeSession(ctx context.Context, userId int64, target string) (bool, error) {
+	login, err := core.userLogin(userId)
+	if err != nil {
+		return false, err
+	}
+
+	core.mutex.Lock()
+	defer core.mutex.Unlock()
+
+	return core.sessions.DeleteUserSession(ctx, login, target, core.logger)
+}
+
+// RevokeAllSessions ends every session of the user.
+func (core *Core) RevokeAllSessions(ctx context.Context, userId int64) (int64, error) {
+	login, err := core.userLogin(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	core.mutex.Lock()
+	defer core.mutex.Unlock()
+
+	return core.sessions.DeleteUserSessions(ctx, login, core.logger)
+}
+
 func (core *Core) CreateUserAccount(login string, password string) error {
 	matched, err := regexp.MatchString(variables.LoginRegexp, login)
 	if err != nil {
@@ -117,48 +222,197 @@ func (core *Core) CreateUserAccount(login string, password string) error {
 		return fmt.Errorf(fmt.Sprintf(variables.InvalidLoginOrPasswordError))
 	}
 
-	hashPassword := util.HashPassword(password)
+	hashPassword, err := util.HashPassword(password, core.passwordHash)
+	if err != nil {
+		core.logger.Error(variables.CreateProfileError, "error", err.Error())
+		return err
+	}
+
+	// A taken login is only detected by the unique constraint, checking it
+	// up front would race with concurrent registrations.
 	err = core.profiles.CreateUser(login, hashPassword)
 	if err != nil {
-		core.logger.Error(variables.CreateProfileError+" %w", "core", "err", err)
+		core.logger.Error(variables.CreateProfileError, "error", err.Error())
 		return err
 	}
 
 	return nil
 }
 
-func (core *Core) FindUserByLogin(login string) (bool, error) {
-	found, err := core.profiles.FindUser(login)
+// FindUserAccount checks the credentials of the user. Hashes in a legacy
+// format or with outdated parameters are replaced on a successful check.
+// A login locked after too many failed passwords gets a LockedError without
+// a check.
+func (core *Core) FindUserAccount(ctx context.Context, login string, password string) (*models.UserItem, bool, error) {
+	lockedFor, err := core.limiter.LockedFor(ctx, login)
 	if err != nil {
-		core.logger.Error(variables.ProfileNotFoundError+" %w", err)
-		return false, err
+		core.logger.Error(variables.LockoutError, "error", err.Error())
+		return nil, false, err
 	}
 
-	return found, nil
+	if lockedFor > 0 {
+		return nil, false, &ratelimit.LockedError{RetryAfter: lockedFor}
+	}
+
+	user, hashPassword, err := core.profiles.GetUserCredentials(login)
+	if err != nil {
+		core.logger.Error(variables.ProfileNotFoundError, "error", err.Error())
+		return nil, false, err
+	}
+
+	if user == nil {
+		_, _, err = util.VerifyPassword(password, core.dummyHash, core.passwordHash)
+		if err != nil {
+			core.logger.Error(variables.InvalidPasswordHashError, "error", err.Error())
+		}
+		core.addLoginFailure(ctx, login)
+		return nil, false, nil
+	}
+
+	matched, needsRehash, err := util.VerifyPassword(password, hashPassword, core.passwordHash)
+	if err != nil {
+		core.logger.Error(variables.InvalidPasswordHashError, "error", err.Error())
+		return nil, false, err
+	}
+
+	if !matched {
+		core.addLoginFailure(ctx, login)
+		return nil, false, nil
+	}
+
+	err = core.limiter.ResetFailures(ctx, login)
+	if err != nil {
+		core.logger.Error(variables.LockoutError, "error", err.Error())
+	}
+
+	if needsRehash {
+		rehashed, err := util.HashPassword(password, core.passwordHash)
+		if err == nil {
+			err = core.profiles.UpdatePassword(user.Id, rehashed)
+		}
+		if err != nil {
+			core.logger.Error(variables.UpdatePasswordError, "error", err.Error())
+		}
+	}
+
+	// The ban is only told after the password matched, so it does not
+	// leak to whoever guesses logins.
+	err = core.checkBan(user.Id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+// addLoginFailure counts a failed password, unknown logins included so the
+// lockout does not tell which logins exist.
+func (core *Core) addLoginFailure(ctx context.Context, login string) {
+	_, err := core.limiter.AddFailure(ctx, login)
+	if err != nil {
+		core.logger.Error(variables.LockoutError, "error", err.Error())
+	}
 }
 
-func (core *Core) FindUserAccount(login string, password string) (*models.UserItem, bool, error) {
-	hashPassword := util.HashPassword(password)
-	user, found, err := core.profiles.GetUser(login, hashPassword)
+// CheckRateLimit records a request of the ip and the user in the scope and
+// returns how long the client has to wait, zero while it is within limits.
+func (core *Core) CheckRateLimit(ctx context.Context, scope string, ip string, userId int64) (time.Duration, error) {
+	return core.limiter.Allow(ctx, scope, ip, userId)
+}
+
+// checkBan returns ErrUserBanned while a ban of the user is in force.
+func (core *Core) checkBan(id int64) error {
+	ban, err := core.profiles.GetActiveBan(id)
 	if err != nil {
-		core.logger.Error(variables.ProfileNotFoundError+" %w", "core", "err", err)
+		core.logger.Error(variables.GetBanError, "error", err.Error())
+		return err
+	}
+
+	if ban != nil {
+		return variables.ErrUserBanned
+	}
+	return nil
+}
+
+// GetUserId returns the owner of the session and extends it. The rotated
+// session is returned when the id has just been replaced, nil otherwise.
+func (core *Core) GetUserId(ctx context.Context, sid string) (int64, *models.Session, error) {
+	session, err := core.sessions.RefreshSession(ctx, sid, core.session, core.logger)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, err := core.profiles.GetUserProfileId(session.Login)
+	if err != nil {
+		core.logger.Error(variables.GetProfileError, "error", err.Error())
+		return 0, nil, err
+	}
+
+	err = core.checkBan(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if session.SID != sid {
+		return id, &session, nil
+	}
+	return id, nil, nil
+}
+
+// GetTokenUserId checks the access token locally, without the session
+// store.
+func (core *Core) GetTokenUserId(ctx context.Context, token string) (int64, error) {
+	return core.tokens.Verify(token)
+}
+
+// CreateTokens signs the user in like /signin does. The id of the new
+// session serves as the refresh token, so revoking the session revokes it.
+func (core *Core) CreateTokens(ctx context.Context, login string, password string, userAgent string, ip string) (*models.TokenPair, bool, error) {
+	user, found, err := core.FindUserAccount(ctx, login, password)
+	if err != nil || !found {
 		return nil, false, err
 	}
-	return user, found, nil
+
+	session, err := core.CreateSession(ctx, user.Login, userAgent, ip)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if session.SID == "" {
+		return nil, true, fmt.Errorf(variables.SessionCreateError)
+	}
+
+	tokenPair, err := core.signTokens(user.Id, session.SID)
+	return tokenPair, true, err
 }
 
-func (core *Core) GetUserId(ctx context.Context, sid string) (int64, error) {
-	login, err := core.sessions.GetUserLogin(ctx, sid, core.logger)
+// RefreshTokens issues a new access token for the session of the refresh
+// token. The session slides and rotates as on any other use.
+func (core *Core) RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	userId, rotated, err := core.GetUserId(ctx, refreshToken)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	id, err := core.profiles.GetUserProfileId(login)
+	if rotated != nil {
+		refreshToken = rotated.SID
+	}
+
+	return core.signTokens(userId, refreshToken)
+}
+
+func (core *Core) signTokens(userId int64, sid string) (*models.TokenPair, error) {
+	accessToken, expiresAt, err := core.tokens.Sign(userId)
 	if err != nil {
-		core.logger.Error(variables.GetProfileError, " id: %v", err)
-		return 0, err
+		core.logger.Error(variables.TokenSignError, "error", err.Error())
+		return nil, err
 	}
-	return id, nil
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		ExpiresAt:    expiresAt,
+		RefreshToken: sid,
+	}, nil
 }
 
 func (core *Core) GetUserRole(ctx context.Context, id int64) (string, error) {
@@ -170,3 +424,92 @@ func (core *Core) GetUserRole(ctx context.Context, id int64) (string, error) {
 
 	return role, nil
 }
+
+func (core *Core) GetUser(ctx context.Context, id int64) (*models.UserItem, error) {
+	user, err := core.profiles.GetUser(id)
+	if err != nil {
+		core.logger.Error(variables.GetProfileError, "error", err.Error())
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (core *Core) ListUsers(ctx context.Context, role string, page uint64, pageSize uint64) ([]*models.UserItem, int64, error) {
+	users, total, err := core.profiles.ListUsers(role, page, pageSize)
+	if err != nil {
+		core.logger.Error(variables.ListUsersError, "error", err.Error())
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// SetRole gives the user another role. ErrUserNotFound and ErrUnknownRole
+// are returned as is.
+func (core *Core) SetRole(ctx context.Context, id int64, role string) (*models.UserItem, error) {
+	user, err := core.profiles.SetRole(id, role)
+	if err != nil && !errors.Is(err, variables.ErrUserNotFound) && !errors.Is(err, variables.ErrUnknownRole) {
+		core.logger.Error(variables.SetRoleError, "error", err.Error())
+	}
+
+	return user, err
+}
+
+// BootstrapAdmin makes the login an admin, creating the account first if
+// it does not exist yet. The password of an existing account is kept.
+func (core *Core) BootstrapAdmin(ctx context.Context, login string, password string) (*models.UserItem, error) {
+	err := core.CreateUserAccount(login, password)
+	if err != nil && !errors.Is(err, variables.ErrLoginTaken) {
+		return nil, err
+	}
+
+	id, err := core.profiles.GetUserProfileId(login)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.SetRole(ctx, id, variables.AdminRoleName)
+}
+
+// BanUser bans the user and ends all of its sessions. Access tokens already
+// issued stay valid until they expire, but lose every permission.
+func (core *Core) BanUser(ctx context.Context, id int64, until *time.Time, reason string, bannedBy int64) (*models.Ban, error) {
+	user, err := core.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, variables.ErrUserNotFound
+	}
+
+	ban, err := core.profiles.BanUser(id, until, reason, bannedBy)
+	if err != nil {
+		if !errors.Is(err, variables.ErrUserNotFound) && !errors.Is(err, variables.ErrInvalidUntil) {
+			core.logger.Error(variables.BanUserError, "error", err.Error())
+		}
+		return nil, err
+	}
+
+	core.mutex.Lock()
+	defer core.mutex.Unlock()
+
+	_, err = core.sessions.DeleteUserSessions(ctx, user.Login, core.logger)
+	if err != nil {
+		core.logger.Error(variables.SessionKilledError, "error", err.Error())
+		return nil, err
+	}
+
+	return ban, nil
+}
+
+func (core *Core) UnbanUser(ctx context.Context, id int64) (bool, error) {
+	unbanned, err := core.profiles.UnbanUser(id)
+	if err != nil {
+		core.logger.Error(variables.UnbanUserError, "error", err.Error())
+		return false, err
+	}
+
+	return unbanned, nil
+}
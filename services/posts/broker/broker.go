@@ -0,0 +1,138 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"ozon-task/pkg/variables"
+	"ozon-task/services/posts/delivery/graph/model"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	commentsChannelPrefix  = "comments:"
+	commentsChannelPattern = commentsChannelPrefix + "*"
+	subscriberBufferSize   = 16
+)
+
+// CommentsBroker fans new comments out to the subscribers of a post.
+// Without a redis client it works purely in-process, with one every
+// published comment goes through redis pub/sub first, so all service
+// instances sharing the redis see it.
+type CommentsBroker struct {
+	mutex       sync.RWMutex
+	subscribers map[int]map[chan *model.Comment]struct{}
+	redisClient *redis.Client
+	logger      *slog.Logger
+}
+
+func GetCommentsBroker(logger *slog.Logger) *CommentsBroker {
+	return &CommentsBroker{
+		subscribers: make(map[int]map[chan *model.Comment]struct{}),
+		logger:      logger,
+	}
+}
+
+func GetRedisCommentsBroker(brokerConfig *variables.CacheDataBaseConfig, logger *slog.Logger) (*CommentsBroker, error) {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     brokerConfig.Host,
+		Password: brokerConfig.Password,
+		DB:       brokerConfig.DbNumber,
+	})
+
+	_, err := redisClient.Ping().Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pubSub := redisClient.PSubscribe(commentsChannelPattern)
+	_, err = pubSub.Receive()
+	if err != nil {
+		return nil, fmt.Errorf("comments broker subscribe error: %w", err)
+	}
+
+	commentsBroker := GetCommentsBroker(logger)
+	commentsBroker.redisClient = redisClient
+	go commentsBroker.listenRedis(pubSub)
+
+	return commentsBroker, nil
+}
+
+func (commentsBroker *CommentsBroker) listenRedis(pubSub *redis.PubSub) {
+	for message := range pubSub.Channel() {
+		postID, err := strconv.Atoi(strings.TrimPrefix(message.Channel, commentsChannelPrefix))
+		if err != nil {
+			commentsBroker.logger.Error("comments broker channel error:", "error", err.Error())
+			continue
+		}
+
+		var comment model.Comment
+		err = json.Unmarshal([]byte(message.Payload), &comment)
+		if err != nil {
+			commentsBroker.logger.Error("comments broker payload error:", "error", err.Error())
+			continue
+		}
+
+		commentsBroker.dispatch(postID, &comment)
+	}
+}
+
+func (commentsBroker *CommentsBroker) Publish(ctx context.Context, postID int, comment *model.Comment) error {
+	if commentsBroker.redisClient == nil {
+		commentsBroker.dispatch(postID, comment)
+		return nil
+	}
+
+	commentBytes, err := json.Marshal(comment)
+	if err != nil {
+		return err
+	}
+
+	return commentsBroker.redisClient.Publish(commentsChannelPrefix+strconv.Itoa(postID), commentBytes).Err()
+}
+
+// Subscribe returns a channel with the comments added to the post. The
+// subscription is dropped and the channel closed once ctx is done.
+func (commentsBroker *CommentsBroker) Subscribe(ctx context.Context, postID int) <-chan *model.Comment {
+	comments := make(chan *model.Comment, subscriberBufferSize)
+
+	commentsBroker.mutex.Lock()
+	if commentsBroker.subscribers[postID] == nil {
+		commentsBroker.subscribers[postID] = make(map[chan *model.Comment]struct{})
+	}
+	commentsBroker.subscribers[postID][comments] = struct{}{}
+	commentsBroker.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		commentsBroker.mutex.Lock()
+		delete(commentsBroker.subscribers[postID], comments)
+		if len(commentsBroker.subscribers[postID]) == 0 {
+			delete(commentsBroker.subscribers, postID)
+		}
+		commentsBroker.mutex.Unlock()
+
+		close(comments)
+	}()
+
+	return comments
+}
+
+func (commentsBroker *CommentsBroker) dispatch(postID int, comment *model.Comment) {
+	commentsBroker.mutex.RLock()
+	defer commentsBroker.mutex.RUnlock()
+
+	for subscriber := range commentsBroker.subscribers[postID] {
+		select {
+		case subscriber <- comment:
+		default:
+			commentsBroker.logger.Error("comments broker subscriber is full:", "post", postID)
+		}
+	}
+}
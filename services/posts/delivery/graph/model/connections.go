@@ -0,0 +1,128 @@
+package model
+
+import (
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/util"
+	"strconv"
+)
+
+// NewPostConnection wraps a page of posts into a relay connection. The
+// cursors keep the position of every post in the given order.
+func NewPostConnection(posts []*Post, hasNextPage bool, order PostOrder) (*PostConnection, error) {
+	connection := &PostConnection{
+		Edges:    make([]*PostEdge, 0, len(posts)),
+		PageInfo: &PageInfo{HasNextPage: hasNextPage},
+	}
+	for _, post := range posts {
+		cursor, err := postCursor(post, order)
+		if err != nil {
+			return nil, err
+		}
+		connection.Edges = append(connection.Edges, &PostEdge{Cursor: cursor, Node: post})
+		connection.PageInfo.EndCursor = &cursor
+	}
+
+	return connection, nil
+}
+
+func postCursor(post *Post, order PostOrder) (string, error) {
+	id, err := strconv.Atoi(post.ID)
+	if err != nil {
+		return "", err
+	}
+
+	switch order {
+	case PostOrderMostCommented:
+		return util.EncodeCursor(models.Cursor{ID: id, Score: float64(post.CommentsCount)}), nil
+	case PostOrderTrending:
+		return util.EncodeCursor(models.Cursor{ID: id, Score: post.TrendingScore}), nil
+	}
+
+	return util.NodeCursor(post.ID, post.CreatedAt)
+}
+
+// NewCommentConnection wraps a page of comments into a relay connection.
+func NewCommentConnection(comments []*Comment, hasNextPage bool) (*CommentConnection, error) {
+	connection := &CommentConnection{
+		Edges:    make([]*CommentEdge, 0, len(comments)),
+		PageInfo: &PageInfo{HasNextPage: hasNextPage},
+	}
+	for _, comment := range comments {
+		cursor, err := util.NodeCursor(comment.ID, comment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		connection.Edges = append(connection.Edges, &CommentEdge{Cursor: cursor, Node: comment})
+		connection.PageInfo.EndCursor = &cursor
+	}
+
+	return connection, nil
+}
+
+// NewPostSearchConnection wraps a page of ranked posts into a relay
+// connection. Search results are ordered by rank, so the rank goes into
+// the cursor instead of the creation time.
+func NewPostSearchConnection(edges []*PostSearchEdge, hasNextPage bool) (*PostSearchConnection, error) {
+	connection := &PostSearchConnection{
+		Edges:    edges,
+		PageInfo: &PageInfo{HasNextPage: hasNextPage},
+	}
+	for _, edge := range edges {
+		id, err := strconv.Atoi(edge.Node.ID)
+		if err != nil {
+			return nil, err
+		}
+		edge.Cursor = util.EncodeCursor(models.Cursor{ID: id, Score: edge.Rank})
+		connection.PageInfo.EndCursor = &edge.Cursor
+	}
+
+	return connection, nil
+}
+
+// BuildCommentTree fills Replies of comments from the preloaded children,
+// levels deep. children maps a parent id to up to first+1 of its replies in
+// display order, the extra one only tells that there is a next page.
+func BuildCommentTree(comments []*Comment, children map[string][]*Comment, first int, levels int) error {
+	if levels <= 0 {
+		return nil
+	}
+
+	for _, comment := range comments {
+		replies := children[comment.ID]
+		hasNextPage := len(replies) > first
+		if hasNextPage {
+			replies = replies[:first]
+		}
+
+		err := BuildCommentTree(replies, children, first, levels-1)
+		if err != nil {
+			return err
+		}
+
+		comment.Replies, err = NewCommentConnection(replies, hasNextPage)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewModerationConnection wraps a page of the moderation queue into a relay
+// connection. The queue is ordered by the time the items entered it.
+func NewModerationConnection(items []*ModerationItem, hasNextPage bool) (*ModerationConnection, error) {
+	connection := &ModerationConnection{
+		Edges:    make([]*ModerationEdge, 0, len(items)),
+		PageInfo: &PageInfo{HasNextPage: hasNextPage},
+	}
+	for _, item := range items {
+		cursor, err := util.NodeCursor(item.ID, item.QueuedAt)
+		if err != nil {
+			return nil, err
+		}
+		connection.Edges = append(connection.Edges, &ModerationEdge{Cursor: cursor, Node: item})
+		connection.PageInfo.EndCursor = &cursor
+	}
+
+	return connection, nil
+}
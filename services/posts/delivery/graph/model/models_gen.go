@@ -2,30 +2,311 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type Ban struct {
+	UserID    string  `json:"userId"`
+	Until     *string `json:"until,omitempty"`
+	Reason    string  `json:"reason"`
+	CreatedAt string  `json:"createdAt"`
+}
+
 type Comment struct {
-	ID        string `json:"id"`
-	Content   string `json:"content"`
-	Author    *User  `json:"author"`
-	Post      *Post  `json:"post"`
-	ParentID  string `json:"parent_id"`
-	CreatedAt string `json:"created_at"`
+	ID               string             `json:"id"`
+	Content          string             `json:"content"`
+	Author           *User              `json:"author"`
+	Post             *Post              `json:"post"`
+	ParentID         string             `json:"parent_id"`
+	CreatedAt        string             `json:"created_at"`
+	IsDeleted        bool               `json:"isDeleted"`
+	Replies          *CommentConnection `json:"replies"`
+	ReactionCounts   []*ReactionCount   `json:"reactionCounts"`
+	ViewerReaction   []ReactionKind     `json:"viewerReaction"`
+	ModerationStatus ModerationStatus   `json:"moderationStatus"`
+}
+
+type CommentConnection struct {
+	Edges    []*CommentEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type CommentEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Comment `json:"node"`
+}
+
+type CommentSearchResult struct {
+	Comment *Comment `json:"comment"`
+	Rank    float64  `json:"rank"`
+	Snippet string   `json:"snippet"`
+}
+
+type ModerationConnection struct {
+	Edges    []*ModerationEdge `json:"edges"`
+	PageInfo *PageInfo         `json:"pageInfo"`
+}
+
+type ModerationEdge struct {
+	Cursor string          `json:"cursor"`
+	Node   *ModerationItem `json:"node"`
+}
+
+type ModerationItem struct {
+	ID          string           `json:"id"`
+	TargetType  ReactionTarget   `json:"targetType"`
+	Post        *Post            `json:"post,omitempty"`
+	Comment     *Comment         `json:"comment,omitempty"`
+	Status      ModerationStatus `json:"status"`
+	ReportCount int              `json:"reportCount"`
+	Reasons     []string         `json:"reasons"`
+	QueuedAt    string           `json:"queuedAt"`
 }
 
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
 type Post struct {
-	ID          string `json:"id"`
-	Content     string `json:"content"`
-	CreatedAt   string `json:"created_at"`
-	Author      *User  `json:"author,omitempty"`
-	IsCommented *bool  `json:"isCommented,omitempty"`
+	ID                string           `json:"id"`
+	Content           string           `json:"content"`
+	CreatedAt         string           `json:"created_at"`
+	Author            *User            `json:"author,omitempty"`
+	IsCommented       *bool            `json:"isCommented,omitempty"`
+	CommentsToggledBy *User            `json:"commentsToggledBy,omitempty"`
+	CommentsToggledAt *string          `json:"commentsToggledAt,omitempty"`
+	CommentsCount     int              `json:"commentsCount"`
+	TrendingScore     float64          `json:"trendingScore"`
+	ReactionCounts    []*ReactionCount `json:"reactionCounts"`
+	ViewerReaction    []ReactionKind   `json:"viewerReaction"`
+	ModerationStatus  ModerationStatus `json:"moderationStatus"`
+}
+
+type PostConnection struct {
+	Edges    []*PostEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type PostEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Post  `json:"node"`
+}
+
+type PostSearchConnection struct {
+	Edges    []*PostSearchEdge `json:"edges"`
+	PageInfo *PageInfo         `json:"pageInfo"`
+}
+
+type PostSearchEdge struct {
+	Cursor  string  `json:"cursor"`
+	Node    *Post   `json:"node"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
 }
 
 type Query struct {
 }
 
+type ReactionCount struct {
+	Kind  ReactionKind `json:"kind"`
+	Count int          `json:"count"`
+}
+
+type Subscription struct {
+}
+
 type User struct {
-	ID    string `json:"id"`
-	Login string `json:"login"`
+	ID           string             `json:"id"`
+	Login        string             `json:"login"`
+	Posts        *PostConnection    `json:"posts"`
+	Comments     *CommentConnection `json:"comments"`
+	PostCount    int                `json:"postCount"`
+	CommentCount int                `json:"commentCount"`
+}
+
+type ModerationStatus string
+
+const (
+	ModerationStatusPending  ModerationStatus = "PENDING"
+	ModerationStatusApproved ModerationStatus = "APPROVED"
+	ModerationStatusRejected ModerationStatus = "REJECTED"
+)
+
+var AllModerationStatus = []ModerationStatus{
+	ModerationStatusPending,
+	ModerationStatusApproved,
+	ModerationStatusRejected,
+}
+
+func (e ModerationStatus) IsValid() bool {
+	switch e {
+	case ModerationStatusPending, ModerationStatusApproved, ModerationStatusRejected:
+		return true
+	}
+	return false
+}
+
+func (e ModerationStatus) String() string {
+	return string(e)
+}
+
+func (e *ModerationStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ModerationStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ModerationStatus", str)
+	}
+	return nil
+}
+
+func (e ModerationStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PostOrder string
+
+const (
+	PostOrderNewest        PostOrder = "NEWEST"
+	PostOrderOldest        PostOrder = "OLDEST"
+	PostOrderMostCommented PostOrder = "MOST_COMMENTED"
+	PostOrderTrending      PostOrder = "TRENDING"
+)
+
+var AllPostOrder = []PostOrder{
+	PostOrderNewest,
+	PostOrderOldest,
+	PostOrderMostCommented,
+	PostOrderTrending,
+}
+
+func (e PostOrder) IsValid() bool {
+	switch e {
+	case PostOrderNewest, PostOrderOldest, PostOrderMostCommented, PostOrderTrending:
+		return true
+	}
+	return false
+}
+
+func (e PostOrder) String() string {
+	return string(e)
+}
+
+func (e *PostOrder) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PostOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PostOrder", str)
+	}
+	return nil
+}
+
+func (e PostOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReactionKind string
+
+const (
+	ReactionKindLike    ReactionKind = "LIKE"
+	ReactionKindDislike ReactionKind = "DISLIKE"
+	ReactionKindHeart   ReactionKind = "HEART"
+	ReactionKindLaugh   ReactionKind = "LAUGH"
+	ReactionKindWow     ReactionKind = "WOW"
+	ReactionKindSad     ReactionKind = "SAD"
+	ReactionKindAngry   ReactionKind = "ANGRY"
+)
+
+var AllReactionKind = []ReactionKind{
+	ReactionKindLike,
+	ReactionKindDislike,
+	ReactionKindHeart,
+	ReactionKindLaugh,
+	ReactionKindWow,
+	ReactionKindSad,
+	ReactionKindAngry,
+}
+
+func (e ReactionKind) IsValid() bool {
+	switch e {
+	case ReactionKindLike, ReactionKindDislike, ReactionKindHeart, ReactionKindLaugh, ReactionKindWow, ReactionKindSad, ReactionKindAngry:
+		return true
+	}
+	return false
+}
+
+func (e ReactionKind) String() string {
+	return string(e)
+}
+
+func (e *ReactionKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReactionKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReactionKind", str)
+	}
+	return nil
+}
+
+func (e ReactionKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReactionTarget string
+
+const (
+	ReactionTargetPost    ReactionTarget = "POST"
+	ReactionTargetComment ReactionTarget = "COMMENT"
+)
+
+var AllReactionTarget = []ReactionTarget{
+	ReactionTargetPost,
+	ReactionTargetComment,
+}
+
+func (e ReactionTarget) IsValid() bool {
+	switch e {
+	case ReactionTargetPost, ReactionTargetComment:
+		return true
+	}
+	return false
+}
+
+func (e ReactionTarget) String() string {
+	return string(e)
+}
+
+func (e *ReactionTarget) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReactionTarget(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReactionTarget", str)
+	}
+	return nil
+}
+
+func (e ReactionTarget) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
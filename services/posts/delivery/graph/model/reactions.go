@@ -0,0 +1,14 @@
+package model
+
+// NewReactionCounts lists the non-zero counts in the order of the
+// ReactionKind enum.
+func NewReactionCounts(counts map[ReactionKind]int) []*ReactionCount {
+	reactionCounts := make([]*ReactionCount, 0, len(counts))
+	for _, kind := range AllReactionKind {
+		if counts[kind] > 0 {
+			reactionCounts = append(reactionCounts, &ReactionCount{Kind: kind, Count: counts[kind]})
+		}
+	}
+
+	return reactionCounts
+}
@@ -4,9 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"ozon-task/pkg/middleware"
+	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/posts/delivery/graph/model"
+	"ozon-task/services/posts/delivery/loaders"
 	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 // This file will not be regenerated automatically.
@@ -14,11 +23,32 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type ICore interface {
-	GetPosts(ctx context.Context, limit int, offset int) ([]*model.Post, error)
-	GetPostByID(ctx context.Context, id int, limit int, offset int) (*model.Post, error)
-	GetCommentsByPostID(ctx context.Context, postID int, limit int, offset int) ([]*model.Comment, error)
+	GetPosts(ctx context.Context, first int, after string, order model.PostOrder) (*model.PostConnection, error)
+	GetPostByID(ctx context.Context, id int, viewerId int) (*model.Post, error)
+	GetCommentsByPostID(ctx context.Context, postID int, first int, after string, depth int) (*model.CommentConnection, error)
+	GetReplies(ctx context.Context, comment *model.Comment, first int, after string) (*model.CommentConnection, error)
 	AddPost(ctx context.Context, data string, userId int, isCommented bool) (*model.Post, error)
 	AddComment(ctx context.Context, postID int, userId int, data string, parentID int) (*model.Comment, error)
+	SubscribeComments(ctx context.Context, postID int) (<-chan *model.Comment, error)
+	UpdatePost(ctx context.Context, postID int, userId int, data string) (*model.Post, error)
+	DeletePost(ctx context.Context, postID int, userId int) error
+	SetPostCommentsEnabled(ctx context.Context, postID int, userId int, enabled bool) (*model.Post, error)
+	UpdateComment(ctx context.Context, commentID int, userId int, data string) (*model.Comment, error)
+	DeleteComment(ctx context.Context, commentID int, userId int) (*model.Comment, error)
+	SearchPosts(ctx context.Context, query string, first int, after string) (*model.PostSearchConnection, error)
+	SearchComments(ctx context.Context, postID int, query string) ([]*model.CommentSearchResult, error)
+	GetUserPosts(ctx context.Context, userId int, first int, after string) (*model.PostConnection, error)
+	GetUserComments(ctx context.Context, userId int, first int, after string) (*model.CommentConnection, error)
+	AddReaction(ctx context.Context, userId int, targetID int, target model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error)
+	RemoveReaction(ctx context.Context, userId int, targetID int, target model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error)
+	ReportContent(ctx context.Context, userId int, targetID int, target model.ReactionTarget, reason string) error
+	ModerateContent(ctx context.Context, userId int, targetID int, target model.ReactionTarget, status model.ModerationStatus) (model.ModerationStatus, error)
+	GetModerationQueue(ctx context.Context, userId int, first int, after string) (*model.ModerationConnection, error)
+	BanUser(ctx context.Context, userId int64, until string, reason string, bannedBy int64) (*model.Ban, error)
+	UnbanUser(ctx context.Context, userId int64) (bool, error)
+	GetUserRole(ctx context.Context, id int64) (string, error)
+	HasPermission(ctx context.Context, id int64, permission string) (bool, error)
+	CheckRateLimit(ctx context.Context, scope string, ip string, userId int64) (time.Duration, error)
 }
 
 type Resolver struct {
@@ -26,13 +56,130 @@ type Resolver struct {
 	Log  *slog.Logger
 }
 
-func (r *Resolver) GetPosts(ctx context.Context, limit, offset *int) ([]*model.Post, error) {
-	if limit == nil || offset == nil {
-		r.Log.Error("Paginator error:", "%s", "dont have limit or offset")
-		return nil, fmt.Errorf("dont have limit or offset")
+// Directives implements the schema directives. @auth requires a session,
+// @hasRole a session of a user with the given role and @hasPermission one
+// of a user whose role grants the permission.
+func (r *Resolver) Directives() DirectiveRoot {
+	return DirectiveRoot{
+		Auth:          r.authDirective,
+		HasRole:       r.hasRoleDirective,
+		HasPermission: r.hasPermissionDirective,
+	}
+}
+
+func (r *Resolver) authDirective(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	if ctx.Value(variables.UserIDKey) == nil {
+		return nil, fmt.Errorf(variables.StatusUnauthorizedError)
+	}
+
+	return next(ctx)
+}
+
+func (r *Resolver) hasRoleDirective(ctx context.Context, obj interface{}, next graphql.Resolver, role string) (interface{}, error) {
+	userId, isAuth := ctx.Value(variables.UserIDKey).(int64)
+	if !isAuth {
+		return nil, fmt.Errorf(variables.StatusUnauthorizedError)
+	}
+
+	userRole, isPermitted, err := middleware.CheckRole(ctx, r.Core, userId, []string{role})
+	if err != nil {
+		r.Log.Error("get role error:", "error", err.Error())
+		return nil, fmt.Errorf(variables.StatusInternalServerError)
+	}
+
+	if !isPermitted {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return next(context.WithValue(ctx, variables.RoleKey, userRole))
+}
+
+func (r *Resolver) hasPermissionDirective(ctx context.Context, obj interface{}, next graphql.Resolver, permission string) (interface{}, error) {
+	userId, isAuth := ctx.Value(variables.UserIDKey).(int64)
+	if !isAuth {
+		return nil, fmt.Errorf(variables.StatusUnauthorizedError)
+	}
+
+	isPermitted, err := r.Core.HasPermission(ctx, userId, permission)
+	if err != nil {
+		r.Log.Error("get permissions error:", "error", err.Error())
+		return nil, fmt.Errorf(variables.StatusInternalServerError)
+	}
+
+	if !isPermitted {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return next(ctx)
+}
+
+// RateLimitOperations is the operation interceptor that applies the rate
+// limits to mutations. A limited mutation gets 429 with Retry-After, and the
+// error tells the wait in its extensions for clients on a websocket.
+func (r *Resolver) RateLimitOperations(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	operation := graphql.GetOperationContext(ctx).Operation
+	if operation == nil || operation.Operation != ast.Mutation {
+		return next(ctx)
+	}
+
+	ip, _ := ctx.Value(variables.ClientIPKey).(string)
+	userId, _ := ctx.Value(variables.UserIDKey).(int64)
+	retryAfter, err := r.Core.CheckRateLimit(ctx, variables.MutationScope, ip, userId)
+	if err != nil {
+		r.Log.Error(variables.RateLimitError, "error", err.Error())
+		return next(ctx)
+	}
+
+	if retryAfter == 0 {
+		return next(ctx)
+	}
+
+	if w, ok := ctx.Value(variables.ResponseWriterKey).(http.ResponseWriter); ok {
+		util.SetRetryAfter(w, retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+
+	return graphql.OneShot(&graphql.Response{Errors: gqlerror.List{{
+		Message: variables.TooManyRequestsError,
+		Extensions: map[string]interface{}{
+			"code":       variables.TooManyRequestsCode,
+			"retryAfter": util.RetryAfterSeconds(retryAfter),
+		},
+	}}})
+}
+
+// pageArgs applies the defaults and bounds of the relay first/after pair.
+func (r *Resolver) pageArgs(first *int, after *string) (int, string, error) {
+	pageSize := variables.PageSize
+	if first != nil {
+		pageSize = *first
+	}
+
+	if pageSize < 1 || pageSize > variables.MaxPageSize {
+		r.Log.Error("Paginator error:", "error", variables.InvalidFirst)
+		return 0, "", fmt.Errorf(variables.InvalidFirst)
+	}
+
+	var cursor string
+	if after != nil {
+		cursor = *after
+	}
+
+	return pageSize, cursor, nil
+}
+
+func (r *Resolver) GetPosts(ctx context.Context, first *int, after *string, orderBy *model.PostOrder) (*model.PostConnection, error) {
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
 	}
 
-	posts, err := r.Core.GetPosts(ctx, *limit, *offset)
+	order := model.PostOrderNewest
+	if orderBy != nil {
+		order = *orderBy
+	}
+
+	posts, err := r.Core.GetPosts(ctx, pageSize, cursor, order)
 	if err != nil {
 		r.Log.Error("get posts error:", "error", err.Error())
 		return nil, fmt.Errorf("get posts error:%w", err)
@@ -48,7 +195,8 @@ func (r *Resolver) GetPostByID(ctx context.Context, id string) (*model.Post, err
 		return nil, fmt.Errorf("Parse parent error:%w", err)
 	}
 
-	post, err := r.Core.GetPostByID(ctx, int(postId), 1, 1)
+	viewerId, _ := r.sessionUserID(ctx)
+	post, err := r.Core.GetPostByID(ctx, int(postId), viewerId)
 	if err != nil {
 		r.Log.Error("get post error:", "error", err.Error())
 		return nil, fmt.Errorf("get post error:%w", err)
@@ -57,10 +205,20 @@ func (r *Resolver) GetPostByID(ctx context.Context, id string) (*model.Post, err
 	return post, nil
 }
 
-func (r *Resolver) GetCommentsByPostID(ctx context.Context, postID string, limit, offset *int) ([]*model.Comment, error) {
-	if limit == nil || offset == nil {
-		r.Log.Error("Params error:", "%s", "%s", "dont have limit , offset ")
-		return nil, fmt.Errorf("dont have limit, offset")
+func (r *Resolver) GetCommentsByPostID(ctx context.Context, postID string, first *int, after *string, depth *int) (*model.CommentConnection, error) {
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var levels int
+	if depth != nil {
+		levels = *depth
+	}
+
+	if levels < 0 || levels > variables.MaxDepth {
+		r.Log.Error("Params error:", "error", variables.InvalidDepth)
+		return nil, fmt.Errorf(variables.InvalidDepth)
 	}
 
 	id, err := strconv.ParseInt(postID, 10, 64)
@@ -69,7 +227,7 @@ func (r *Resolver) GetCommentsByPostID(ctx context.Context, postID string, limit
 		return nil, fmt.Errorf("Parse id error:%w", err)
 	}
 
-	comments, err := r.Core.GetCommentsByPostID(ctx, int(id), *limit, *offset)
+	comments, err := r.Core.GetCommentsByPostID(ctx, int(id), pageSize, cursor, levels)
 	if err != nil {
 		r.Log.Error("get comments error:", "error", err.Error())
 		return nil, fmt.Errorf("get comments error:%w", err)
@@ -78,6 +236,67 @@ func (r *Resolver) GetCommentsByPostID(ctx context.Context, postID string, limit
 	return comments, nil
 }
 
+func (r *Resolver) GetReplies(ctx context.Context, comment *model.Comment, first *int, after *string) (*model.CommentConnection, error) {
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replies preloaded by queryGetComments(depth:) answer the first page
+	// as long as they hold enough of it.
+	preloaded := comment.Replies
+	if preloaded != nil && cursor == "" && (len(preloaded.Edges) >= pageSize || !preloaded.PageInfo.HasNextPage) {
+		if len(preloaded.Edges) <= pageSize {
+			return preloaded, nil
+		}
+
+		edges := preloaded.Edges[:pageSize]
+		return &model.CommentConnection{
+			Edges:    edges,
+			PageInfo: &model.PageInfo{HasNextPage: true, EndCursor: &edges[pageSize-1].Cursor},
+		}, nil
+	}
+
+	replies, err := r.Core.GetReplies(ctx, comment, pageSize, cursor)
+	if err != nil {
+		r.Log.Error("get replies error:", "error", err.Error())
+		return nil, fmt.Errorf("get replies error:%w", err)
+	}
+
+	return replies, nil
+}
+
+func (r *Resolver) FindPosts(ctx context.Context, query string, first *int, after *string) (*model.PostSearchConnection, error) {
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := r.Core.SearchPosts(ctx, query, pageSize, cursor)
+	if err != nil {
+		r.Log.Error("search posts error:", "error", err.Error())
+		return nil, fmt.Errorf("search posts error:%w", err)
+	}
+
+	return posts, nil
+}
+
+func (r *Resolver) FindComments(ctx context.Context, postID string, query string) ([]*model.CommentSearchResult, error) {
+	id, err := strconv.ParseInt(postID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	comments, err := r.Core.SearchComments(ctx, int(id), query)
+	if err != nil {
+		r.Log.Error("search comments error:", "error", err.Error())
+		return nil, fmt.Errorf("search comments error:%w", err)
+	}
+
+	return comments, nil
+}
+
 func (r *Resolver) AddPost(ctx context.Context, data string, isCommented bool) (*model.Post, error) {
 	session := ctx.Value(variables.UserIDKey)
 	if session == nil {
@@ -119,3 +338,405 @@ func (r *Resolver) AddComment(ctx context.Context, postID string, data string, p
 
 	return comment, nil
 }
+
+func (r *Resolver) SubscribeComments(ctx context.Context, postID string) (<-chan *model.Comment, error) {
+	id, err := strconv.ParseInt(postID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	comments, err := r.Core.SubscribeComments(ctx, int(id))
+	if err != nil {
+		r.Log.Error("subscribe comments error:", "error", err.Error())
+		return nil, fmt.Errorf("subscribe comments error:%w", err)
+	}
+
+	return comments, nil
+}
+
+func (r *Resolver) sessionUserID(ctx context.Context) (int, error) {
+	session := ctx.Value(variables.UserIDKey)
+	if session == nil {
+		return 0, fmt.Errorf("session is nil")
+	}
+
+	return int(session.(int64)), nil
+}
+
+func (r *Resolver) EditPost(ctx context.Context, id string, data string) (*model.Post, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	postId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	post, err := r.Core.UpdatePost(ctx, int(postId), userId, data)
+	if err != nil {
+		r.Log.Error("update post error:", "error", err.Error())
+		return nil, fmt.Errorf("update post error:%w", err)
+	}
+
+	return post, nil
+}
+
+func (r *Resolver) RemovePost(ctx context.Context, id string) (bool, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	postId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return false, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	err = r.Core.DeletePost(ctx, int(postId), userId)
+	if err != nil {
+		r.Log.Error("delete post error:", "error", err.Error())
+		return false, fmt.Errorf("delete post error:%w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Resolver) SetCommentsEnabled(ctx context.Context, id string, enabled bool) (*model.Post, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	postId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	post, err := r.Core.SetPostCommentsEnabled(ctx, int(postId), userId, enabled)
+	if err != nil {
+		r.Log.Error("set comments enabled error:", "error", err.Error())
+		return nil, fmt.Errorf("set comments enabled error:%w", err)
+	}
+
+	return post, nil
+}
+
+func (r *Resolver) EditComment(ctx context.Context, id string, data string) (*model.Comment, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	commentId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	comment, err := r.Core.UpdateComment(ctx, int(commentId), userId, data)
+	if err != nil {
+		r.Log.Error("update comment error:", "error", err.Error())
+		return nil, fmt.Errorf("update comment error:%w", err)
+	}
+
+	return comment, nil
+}
+
+func (r *Resolver) RemoveComment(ctx context.Context, id string) (*model.Comment, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	commentId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	comment, err := r.Core.DeleteComment(ctx, int(commentId), userId)
+	if err != nil {
+		r.Log.Error("delete comment error:", "error", err.Error())
+		return nil, fmt.Errorf("delete comment error:%w", err)
+	}
+
+	return comment, nil
+}
+
+func (r *Resolver) PutReaction(ctx context.Context, targetID string, target model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(targetID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	counts, err := r.Core.AddReaction(ctx, userId, int(id), target, kind)
+	if err != nil {
+		r.Log.Error("add reaction error:", "error", err.Error())
+		return nil, fmt.Errorf("add reaction error:%w", err)
+	}
+
+	return counts, nil
+}
+
+func (r *Resolver) DropReaction(ctx context.Context, targetID string, target model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(targetID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	counts, err := r.Core.RemoveReaction(ctx, userId, int(id), target, kind)
+	if err != nil {
+		r.Log.Error("remove reaction error:", "error", err.Error())
+		return nil, fmt.Errorf("remove reaction error:%w", err)
+	}
+
+	return counts, nil
+}
+
+func (r *Resolver) GetReactionCounts(ctx context.Context, target model.ReactionTarget, id string) ([]*model.ReactionCount, error) {
+	counts, err := loaders.GetReactionCounts(ctx, target, id)
+	if err != nil {
+		r.Log.Error("get reactions error:", "error", err.Error())
+		return nil, fmt.Errorf("get reactions error:%w", err)
+	}
+
+	return counts, nil
+}
+
+func (r *Resolver) GetViewerReaction(ctx context.Context, target model.ReactionTarget, id string) ([]model.ReactionKind, error) {
+	reactions, err := loaders.GetViewerReactions(ctx, target, id)
+	if err != nil {
+		r.Log.Error("get reactions error:", "error", err.Error())
+		return nil, fmt.Errorf("get reactions error:%w", err)
+	}
+
+	return reactions, nil
+}
+
+// GetUser resolves the login of a referenced user through the request's
+// dataloader, so a page of authors costs a single gRPC call.
+func (r *Resolver) GetUser(ctx context.Context, user *model.User) (*model.User, error) {
+	if user == nil {
+		return nil, nil
+	}
+
+	loaded, err := loaders.GetUser(ctx, user.ID)
+	if err != nil {
+		r.Log.Error("get user error:", "error", err.Error())
+		return nil, fmt.Errorf("get user error:%w", err)
+	}
+
+	return loaded, nil
+}
+
+// GetUserByID returns nil for ids unknown to the authorization service.
+func (r *Resolver) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := r.GetUser(ctx, &model.User{ID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Login == "" {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+func (r *Resolver) GetMe(ctx context.Context) (*model.User, error) {
+	// me is nullable: anonymous callers get null rather than an error.
+	if ctx.Value(variables.UserIDKey) == nil {
+		return nil, nil
+	}
+
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetUserByID(ctx, strconv.Itoa(userId))
+}
+
+func (r *Resolver) GetUserPosts(ctx context.Context, user *model.User, first *int, after *string) (*model.PostConnection, error) {
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := strconv.Atoi(user.ID)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	posts, err := r.Core.GetUserPosts(ctx, userId, pageSize, cursor)
+	if err != nil {
+		r.Log.Error("get user posts error:", "error", err.Error())
+		return nil, fmt.Errorf("get user posts error:%w", err)
+	}
+
+	return posts, nil
+}
+
+func (r *Resolver) GetUserComments(ctx context.Context, user *model.User, first *int, after *string) (*model.CommentConnection, error) {
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := strconv.Atoi(user.ID)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	comments, err := r.Core.GetUserComments(ctx, userId, pageSize, cursor)
+	if err != nil {
+		r.Log.Error("get user comments error:", "error", err.Error())
+		return nil, fmt.Errorf("get user comments error:%w", err)
+	}
+
+	return comments, nil
+}
+
+func (r *Resolver) GetPostCount(ctx context.Context, user *model.User) (int, error) {
+	activity, err := loaders.GetUserActivity(ctx, user.ID)
+	if err != nil {
+		r.Log.Error("get user activity error:", "error", err.Error())
+		return 0, fmt.Errorf("get user activity error:%w", err)
+	}
+
+	return activity.PostCount, nil
+}
+
+func (r *Resolver) GetCommentCount(ctx context.Context, user *model.User) (int, error) {
+	activity, err := loaders.GetUserActivity(ctx, user.ID)
+	if err != nil {
+		r.Log.Error("get user activity error:", "error", err.Error())
+		return 0, fmt.Errorf("get user activity error:%w", err)
+	}
+
+	return activity.CommentCount, nil
+}
+
+func (r *Resolver) ReportContent(ctx context.Context, targetID string, target model.ReactionTarget, reason string) (bool, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	id, err := strconv.ParseInt(targetID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return false, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	err = r.Core.ReportContent(ctx, userId, int(id), target, reason)
+	if err != nil {
+		r.Log.Error("report content error:", "error", err.Error())
+		return false, fmt.Errorf("report content error:%w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Resolver) ModerateContent(ctx context.Context, targetID string, target model.ReactionTarget, status model.ModerationStatus) (model.ModerationStatus, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := strconv.ParseInt(targetID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return "", fmt.Errorf("Parse id error:%w", err)
+	}
+
+	moderated, err := r.Core.ModerateContent(ctx, userId, int(id), target, status)
+	if err != nil {
+		r.Log.Error("moderate content error:", "error", err.Error())
+		return "", fmt.Errorf("moderate content error:%w", err)
+	}
+
+	return moderated, nil
+}
+
+func (r *Resolver) GetModerationQueue(ctx context.Context, first *int, after *string) (*model.ModerationConnection, error) {
+	userId, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize, cursor, err := r.pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := r.Core.GetModerationQueue(ctx, userId, pageSize, cursor)
+	if err != nil {
+		r.Log.Error("get moderation queue error:", "error", err.Error())
+		return nil, fmt.Errorf("get moderation queue error:%w", err)
+	}
+
+	return queue, nil
+}
+
+func (r *Resolver) BanUser(ctx context.Context, userID string, until *string, reason string) (*model.Ban, error) {
+	bannedBy, err := r.sessionUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return nil, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	var banUntil string
+	if until != nil {
+		banUntil = *until
+	}
+
+	ban, err := r.Core.BanUser(ctx, id, banUntil, reason, int64(bannedBy))
+	if err != nil {
+		r.Log.Error("ban user error:", "error", err.Error())
+		return nil, fmt.Errorf("ban user error:%w", err)
+	}
+
+	return ban, nil
+}
+
+func (r *Resolver) UnbanUser(ctx context.Context, userID string) (bool, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		r.Log.Error("Parse id error:", "error", err.Error())
+		return false, fmt.Errorf("Parse id error:%w", err)
+	}
+
+	unbanned, err := r.Core.UnbanUser(ctx, id)
+	if err != nil {
+		r.Log.Error("unban user error:", "error", err.Error())
+		return false, fmt.Errorf("unban user error:%w", err)
+	}
+
+	return unbanned, nil
+}
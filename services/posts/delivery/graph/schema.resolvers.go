@@ -9,6 +9,26 @@ import (
 	"ozon-task/services/posts/delivery/graph/model"
 )
 
+// Author is the resolver for the author field.
+func (r *commentResolver) Author(ctx context.Context, obj *model.Comment) (*model.User, error) {
+	return r.GetUser(ctx, obj.Author)
+}
+
+// Replies is the resolver for the replies field.
+func (r *commentResolver) Replies(ctx context.Context, obj *model.Comment, first *int, after *string) (*model.CommentConnection, error) {
+	return r.GetReplies(ctx, obj, first, after)
+}
+
+// ReactionCounts is the resolver for the reactionCounts field.
+func (r *commentResolver) ReactionCounts(ctx context.Context, obj *model.Comment) ([]*model.ReactionCount, error) {
+	return r.GetReactionCounts(ctx, model.ReactionTargetComment, obj.ID)
+}
+
+// ViewerReaction is the resolver for the viewerReaction field.
+func (r *commentResolver) ViewerReaction(ctx context.Context, obj *model.Comment) ([]model.ReactionKind, error) {
+	return r.GetViewerReaction(ctx, model.ReactionTargetComment, obj.ID)
+}
+
 // MutationAddPost is the resolver for the mutationAddPost field.
 func (r *mutationResolver) MutationAddPost(ctx context.Context, data string, isCommented *bool) (*model.Post, error) {
 	return r.AddPost(ctx, data, *isCommented)
@@ -19,9 +39,84 @@ func (r *mutationResolver) MutationAddComment(ctx context.Context, postID string
 	return r.AddComment(ctx, postID, data, parentID)
 }
 
+// UpdatePost is the resolver for the updatePost field.
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, data string) (*model.Post, error) {
+	return r.EditPost(ctx, id, data)
+}
+
+// DeletePost is the resolver for the deletePost field.
+func (r *mutationResolver) DeletePost(ctx context.Context, id string) (bool, error) {
+	return r.RemovePost(ctx, id)
+}
+
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id string, data string) (*model.Comment, error) {
+	return r.EditComment(ctx, id, data)
+}
+
+// DeleteComment is the resolver for the deleteComment field.
+func (r *mutationResolver) DeleteComment(ctx context.Context, id string) (*model.Comment, error) {
+	return r.RemoveComment(ctx, id)
+}
+
+// SetPostCommentsEnabled is the resolver for the setPostCommentsEnabled field.
+func (r *mutationResolver) SetPostCommentsEnabled(ctx context.Context, postID string, enabled bool) (*model.Post, error) {
+	return r.SetCommentsEnabled(ctx, postID, enabled)
+}
+
+// AddReaction is the resolver for the addReaction field.
+func (r *mutationResolver) AddReaction(ctx context.Context, targetID string, targetType model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error) {
+	return r.PutReaction(ctx, targetID, targetType, kind)
+}
+
+// RemoveReaction is the resolver for the removeReaction field.
+func (r *mutationResolver) RemoveReaction(ctx context.Context, targetID string, targetType model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error) {
+	return r.DropReaction(ctx, targetID, targetType, kind)
+}
+
+// ReportContent is the resolver for the reportContent field.
+func (r *mutationResolver) ReportContent(ctx context.Context, targetID string, targetType model.ReactionTarget, reason string) (bool, error) {
+	return r.Resolver.ReportContent(ctx, targetID, targetType, reason)
+}
+
+// ModerateContent is the resolver for the moderateContent field.
+func (r *mutationResolver) ModerateContent(ctx context.Context, targetID string, targetType model.ReactionTarget, status model.ModerationStatus) (model.ModerationStatus, error) {
+	return r.Resolver.ModerateContent(ctx, targetID, targetType, status)
+}
+
+// BanUser is the resolver for the banUser field.
+func (r *mutationResolver) BanUser(ctx context.Context, userID string, until *string, reason string) (*model.Ban, error) {
+	return r.Resolver.BanUser(ctx, userID, until, reason)
+}
+
+// UnbanUser is the resolver for the unbanUser field.
+func (r *mutationResolver) UnbanUser(ctx context.Context, userID string) (bool, error) {
+	return r.Resolver.UnbanUser(ctx, userID)
+}
+
+// Author is the resolver for the author field.
+func (r *postResolver) Author(ctx context.Context, obj *model.Post) (*model.User, error) {
+	return r.GetUser(ctx, obj.Author)
+}
+
+// CommentsToggledBy is the resolver for the commentsToggledBy field.
+func (r *postResolver) CommentsToggledBy(ctx context.Context, obj *model.Post) (*model.User, error) {
+	return r.GetUser(ctx, obj.CommentsToggledBy)
+}
+
+// ReactionCounts is the resolver for the reactionCounts field.
+func (r *postResolver) ReactionCounts(ctx context.Context, obj *model.Post) ([]*model.ReactionCount, error) {
+	return r.GetReactionCounts(ctx, model.ReactionTargetPost, obj.ID)
+}
+
+// ViewerReaction is the resolver for the viewerReaction field.
+func (r *postResolver) ViewerReaction(ctx context.Context, obj *model.Post) ([]model.ReactionKind, error) {
+	return r.GetViewerReaction(ctx, model.ReactionTargetPost, obj.ID)
+}
+
 // QueryGetPosts is the resolver for the queryGetPosts field.
-func (r *queryResolver) QueryGetPosts(ctx context.Context, limit *int, offset *int) ([]*model.Post, error) {
-	return r.GetPosts(ctx, limit, offset)
+func (r *queryResolver) QueryGetPosts(ctx context.Context, first *int, after *string, orderBy *model.PostOrder) (*model.PostConnection, error) {
+	return r.GetPosts(ctx, first, after, orderBy)
 }
 
 // QueryGetPost is the resolver for the queryGetPost field.
@@ -30,15 +125,81 @@ func (r *queryResolver) QueryGetPost(ctx context.Context, id string) (*model.Pos
 }
 
 // QueryGetComments is the resolver for the queryGetComments field.
-func (r *queryResolver) QueryGetComments(ctx context.Context, postID string, limit, offset *int) ([]*model.Comment, error) {
-	return r.GetCommentsByPostID(ctx, postID, limit, offset)
+func (r *queryResolver) QueryGetComments(ctx context.Context, postID string, first *int, after *string, depth *int) (*model.CommentConnection, error) {
+	return r.GetCommentsByPostID(ctx, postID, first, after, depth)
+}
+
+// SearchPosts is the resolver for the searchPosts field.
+func (r *queryResolver) SearchPosts(ctx context.Context, query string, first *int, after *string) (*model.PostSearchConnection, error) {
+	return r.FindPosts(ctx, query, first, after)
+}
+
+// SearchComments is the resolver for the searchComments field.
+func (r *queryResolver) SearchComments(ctx context.Context, postID string, query string) ([]*model.CommentSearchResult, error) {
+	return r.FindComments(ctx, postID, query)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
+	return r.GetUserByID(ctx, id)
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	return r.GetMe(ctx)
 }
 
+// ModerationQueue is the resolver for the moderationQueue field.
+func (r *queryResolver) ModerationQueue(ctx context.Context, first *int, after *string) (*model.ModerationConnection, error) {
+	return r.GetModerationQueue(ctx, first, after)
+}
+
+// CommentAdded is the resolver for the commentAdded field.
+func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
+	return r.SubscribeComments(ctx, postID)
+}
+
+// Posts is the resolver for the posts field.
+func (r *userResolver) Posts(ctx context.Context, obj *model.User, first *int, after *string) (*model.PostConnection, error) {
+	return r.GetUserPosts(ctx, obj, first, after)
+}
+
+// Comments is the resolver for the comments field.
+func (r *userResolver) Comments(ctx context.Context, obj *model.User, first *int, after *string) (*model.CommentConnection, error) {
+	return r.GetUserComments(ctx, obj, first, after)
+}
+
+// PostCount is the resolver for the postCount field.
+func (r *userResolver) PostCount(ctx context.Context, obj *model.User) (int, error) {
+	return r.GetPostCount(ctx, obj)
+}
+
+// CommentCount is the resolver for the commentCount field.
+func (r *userResolver) CommentCount(ctx context.Context, obj *model.User) (int, error) {
+	return r.GetCommentCount(ctx, obj)
+}
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Post returns PostResolver implementation.
+func (r *Resolver) Post() PostResolver { return &postResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type commentResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,193 @@
+package loaders
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/variables"
+	"ozon-task/services/posts/delivery/graph/model"
+	"strconv"
+	"time"
+
+	"github.com/vikstrous/dataloadgen"
+)
+
+const loadWait = 2 * time.Millisecond
+
+type ICore interface {
+	GetUsersByIds(ctx context.Context, ids []int64) (map[int64]string, error)
+	GetReactionCounts(ctx context.Context, target model.ReactionTarget, ids []int) (map[int][]*model.ReactionCount, error)
+	GetViewerReactions(ctx context.Context, target model.ReactionTarget, ids []int, userId int) (map[int][]model.ReactionKind, error)
+	GetUsersActivity(ctx context.Context, ids []int64) (map[int64]*models.UserActivity, error)
+}
+
+// Loaders batches the lookups made while resolving one request. They
+// cache what they load, so a new set is created for every request.
+type Loaders struct {
+	userLoader            *dataloadgen.Loader[int64, *model.User]
+	reactionCountsLoader  *dataloadgen.Loader[reactionKey, []*model.ReactionCount]
+	viewerReactionsLoader *dataloadgen.Loader[reactionKey, []model.ReactionKind]
+	activityLoader        *dataloadgen.Loader[int64, *models.UserActivity]
+}
+
+type reactionKey struct {
+	target model.ReactionTarget
+	id     int
+}
+
+// fetchByTarget splits a batch of reaction keys by target type, so every
+// type is fetched with a single call.
+func fetchByTarget[T any](keys []reactionKey, fetch func(target model.ReactionTarget, ids []int) (map[int]T, error)) ([]T, []error) {
+	ids := make(map[model.ReactionTarget][]int)
+	for _, key := range keys {
+		ids[key.target] = append(ids[key.target], key.id)
+	}
+
+	fetched := make(map[model.ReactionTarget]map[int]T, len(ids))
+	for target, targetIds := range ids {
+		values, err := fetch(target, targetIds)
+		if err != nil {
+			return nil, []error{err}
+		}
+		fetched[target] = values
+	}
+
+	values := make([]T, len(keys))
+	for i, key := range keys {
+		values[i] = fetched[key.target][key.id]
+	}
+	return values, nil
+}
+
+func NewLoaders(core ICore) *Loaders {
+	fetchUsers := func(ctx context.Context, ids []int64) ([]*model.User, []error) {
+		logins, err := core.GetUsersByIds(ctx, ids)
+		if err != nil {
+			return nil, []error{err}
+		}
+
+		users := make([]*model.User, len(ids))
+		for i, id := range ids {
+			users[i] = &model.User{ID: strconv.FormatInt(id, 10), Login: logins[id]}
+		}
+		return users, nil
+	}
+
+	fetchReactionCounts := func(ctx context.Context, keys []reactionKey) ([][]*model.ReactionCount, []error) {
+		return fetchByTarget(keys, func(target model.ReactionTarget, ids []int) (map[int][]*model.ReactionCount, error) {
+			return core.GetReactionCounts(ctx, target, ids)
+		})
+	}
+
+	// Viewer reactions are only loaded for requests with a session, see
+	// GetViewerReactions.
+	fetchViewerReactions := func(ctx context.Context, keys []reactionKey) ([][]model.ReactionKind, []error) {
+		userId, ok := ctx.Value(variables.UserIDKey).(int64)
+		if !ok {
+			return nil, []error{fmt.Errorf("session is nil")}
+		}
+
+		return fetchByTarget(keys, func(target model.ReactionTarget, ids []int) (map[int][]model.ReactionKind, error) {
+			return core.GetViewerReactions(ctx, target, ids, int(userId))
+		})
+	}
+
+	fetchActivity := func(ctx context.Context, ids []int64) ([]*models.UserActivity, []error) {
+		activity, err := core.GetUsersActivity(ctx, ids)
+		if err != nil {
+			return nil, []error{err}
+		}
+
+		usersActivity := make([]*models.UserActivity, len(ids))
+		for i, id := range ids {
+			usersActivity[i] = activity[id]
+		}
+		return usersActivity, nil
+	}
+
+	return &Loaders{
+		userLoader:            dataloadgen.NewLoader(fetchUsers, dataloadgen.WithWait(loadWait)),
+		reactionCountsLoader:  dataloadgen.NewLoader(fetchReactionCounts, dataloadgen.WithWait(loadWait)),
+		viewerReactionsLoader: dataloadgen.NewLoader(fetchViewerReactions, dataloadgen.WithWait(loadWait)),
+		activityLoader:        dataloadgen.NewLoader(fetchActivity, dataloadgen.WithWait(loadWait)),
+	}
+}
+
+func LoadersMiddleware(next http.Handler, core ICore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), variables.LoadersKey, NewLoaders(core)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getLoaders(ctx context.Context) (*Loaders, error) {
+	loaders, ok := ctx.Value(variables.LoadersKey).(*Loaders)
+	if !ok {
+		return nil, fmt.Errorf("loaders are not set")
+	}
+
+	return loaders, nil
+}
+
+func GetUser(ctx context.Context, id string) (*model.User, error) {
+	loaders, err := getLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return loaders.userLoader.Load(ctx, userId)
+}
+
+func GetUserActivity(ctx context.Context, id string) (*models.UserActivity, error) {
+	loaders, err := getLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return loaders.activityLoader.Load(ctx, userId)
+}
+
+func GetReactionCounts(ctx context.Context, target model.ReactionTarget, id string) ([]*model.ReactionCount, error) {
+	loaders, err := getLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targetId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return loaders.reactionCountsLoader.Load(ctx, reactionKey{target: target, id: targetId})
+}
+
+// GetViewerReactions returns the reactions the session user left on the
+// target, none for anonymous requests.
+func GetViewerReactions(ctx context.Context, target model.ReactionTarget, id string) ([]model.ReactionKind, error) {
+	if ctx.Value(variables.UserIDKey) == nil {
+		return []model.ReactionKind{}, nil
+	}
+
+	loaders, err := getLoaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targetId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return loaders.viewerReactionsLoader.Load(ctx, reactionKey{target: target, id: targetId})
+}
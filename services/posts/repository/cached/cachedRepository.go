@@ -0,0 +1,343 @@
+package cached_repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/variables"
+	"ozon-task/services/posts/delivery/graph/model"
+	relational_repository "ozon-task/services/posts/repository/relational"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/sync/singleflight"
+)
+
+// PostsCachedRepository keeps posts and the first pages of their comments in
+// Redis in front of Postgres. Writes go to Postgres first and then drop the
+// cached entries they touch, everything it doesn't cache goes straight to
+// Postgres.
+type PostsCachedRepository struct {
+	*relational_repository.ProfileRelationalRepository
+	redisClient *redis.Client
+	ttl         time.Duration
+	logger      *slog.Logger
+	loads       singleflight.Group
+	hits        atomic.Int64
+	misses      atomic.Int64
+}
+
+// storeScript caches ARGV[2] under KEYS[1], or under the field ARGV[3] of
+// the KEYS[1] hash, unless the version in KEYS[2] moved on from ARGV[1]
+// while it was read from Postgres. ARGV[4] is the TTL in milliseconds.
+var storeScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '') ~= ARGV[1] then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('SET', KEYS[1], ARGV[2])
+else
+	redis.call('HSET', KEYS[1], ARGV[3], ARGV[2])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return 1
+`)
+
+// commentsPage is a cached first page of the comments of a post.
+type commentsPage struct {
+	Comments    []*model.Comment `json:"comments"`
+	HasNextPage bool             `json:"hasNextPage"`
+}
+
+func GetPostsRepository(postsRelConfig *variables.RelationalDataBaseConfig, postsCacheConfig *variables.CacheDataBaseConfig, cacheConfig *variables.RepoCacheConfig, logger *slog.Logger) (*PostsCachedRepository, error) {
+	relational, err := relational_repository.GetPostsRepository(postsRelConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     postsCacheConfig.Host,
+		Password: postsCacheConfig.Password,
+		DB:       postsCacheConfig.DbNumber,
+	})
+
+	_, err = redisClient.Ping().Result()
+	if err != nil {
+		return nil, err
+	}
+
+	repository := &PostsCachedRepository{
+		ProfileRelationalRepository: relational,
+		redisClient:                 redisClient,
+		ttl:                         cacheConfig.TTL,
+		logger:                      logger,
+	}
+
+	if cacheConfig.StatsInterval > 0 {
+		go repository.logStats(cacheConfig.StatsInterval)
+	}
+
+	return repository, nil
+}
+
+// Stats returns the cache hits and misses since the start. A miss is a read
+// that went to Postgres, concurrent misses of a key share one query.
+func (repository *PostsCachedRepository) Stats() (hits int64, misses int64) {
+	return repository.hits.Load(), repository.misses.Load()
+}
+
+// logStats logs the hits and misses every interval.
+func (repository *PostsCachedRepository) logStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		hits, misses := repository.Stats()
+		repository.logger.Info(variables.CacheStatsMessage, "hits", hits, "misses", misses)
+	}
+}
+
+func postKey(id int) string {
+	return "cache:post:" + strconv.Itoa(id)
+}
+
+func commentsKey(postID int) string {
+	return "cache:post:" + strconv.Itoa(postID) + ":comments"
+}
+
+// versionKey counts the invalidations of key.
+func versionKey(key string) string {
+	return key + ":version"
+}
+
+// load runs fetch once for all the concurrent misses of key, so a hot entry
+// that expires doesn't send every reader to Postgres. The shared call
+// outlives the cancellation of the caller that started it.
+func (repository *PostsCachedRepository) load(ctx context.Context, key string, fetch func(ctx context.Context) (any, error)) (any, error) {
+	repository.misses.Add(1)
+	value, err, _ := repository.loads.Do(key, func() (any, error) {
+		return fetch(context.WithoutCancel(ctx))
+	})
+	return value, err
+}
+
+// version returns the current version of key, taken before reading it from
+// Postgres so store can tell whether a write came in between.
+func (repository *PostsCachedRepository) version(key string) string {
+	version, err := repository.redisClient.Get(versionKey(key)).Result()
+	if err != nil && err != redis.Nil {
+		repository.logger.Error(variables.CacheReadError, "error", err.Error(), "key", key)
+	}
+	return version
+}
+
+// invalidate drops the keys and moves their versions on, so reads that
+// started before the write don't put their results back. The versions live
+// a minute longer than the entries, a read can't take longer than that.
+func (repository *PostsCachedRepository) invalidate(keys ...string) {
+	pipe := repository.redisClient.TxPipeline()
+	pipe.Del(keys...)
+	for _, key := range keys {
+		pipe.Incr(versionKey(key))
+		if repository.ttl > 0 {
+			pipe.Expire(versionKey(key), repository.ttl+time.Minute)
+		}
+	}
+
+	_, err := pipe.Exec()
+	if err != nil {
+		repository.logger.Error(variables.CacheInvalidateError, "error", err.Error(), "keys", keys)
+	}
+}
+
+func (repository *PostsCachedRepository) GetPostByID(ctx context.Context, id int) (*model.Post, error) {
+	key := postKey(id)
+	cached, err := repository.redisClient.Get(key).Bytes()
+	if err == nil {
+		var post model.Post
+		err = json.Unmarshal(cached, &post)
+		if err == nil {
+			repository.hits.Add(1)
+			return &post, nil
+		}
+	}
+	if err != nil && err != redis.Nil {
+		repository.logger.Error(variables.CacheReadError, "error", err.Error(), "key", key)
+	}
+
+	value, err := repository.load(ctx, key, func(ctx context.Context) (any, error) {
+		version := repository.version(key)
+		post, err := repository.ProfileRelationalRepository.GetPostByID(ctx, id)
+		if err != nil || post == nil {
+			return post, err
+		}
+
+		repository.store(key, "", version, post)
+		return post, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*model.Post), nil
+}
+
+// GetCommentsByPostID caches only the first page of a post, the one every
+// reader opens, keyed by its size and depth.
+func (repository *PostsCachedRepository) GetCommentsByPostID(ctx context.Context, postID int, first int, after *models.Cursor, depth int) ([]*model.Comment, bool, error) {
+	if after != nil {
+		return repository.ProfileRelationalRepository.GetCommentsByPostID(ctx, postID, first, after, depth)
+	}
+
+	key := commentsKey(postID)
+	field := strconv.Itoa(first) + ":" + strconv.Itoa(depth)
+	cached, err := repository.redisClient.HGet(key, field).Bytes()
+	if err == nil {
+		var page commentsPage
+		err = json.Unmarshal(cached, &page)
+		if err == nil {
+			repository.hits.Add(1)
+			return page.Comments, page.HasNextPage, nil
+		}
+	}
+	if err != nil && err != redis.Nil {
+		repository.logger.Error(variables.CacheReadError, "error", err.Error(), "key", key)
+	}
+
+	value, err := repository.load(ctx, key+":"+field, func(ctx context.Context) (any, error) {
+		version := repository.version(key)
+		comments, hasNextPage, err := repository.ProfileRelationalRepository.GetCommentsByPostID(ctx, postID, first, nil, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		page := &commentsPage{Comments: comments, HasNextPage: hasNextPage}
+		repository.store(key, field, version, page)
+		return page, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	page := value.(*commentsPage)
+	return page.Comments, page.HasNextPage, nil
+}
+
+// store caches value under key, or under field of the key hash when field
+// is set, unless key was invalidated since version was taken. A failed
+// write only costs a later miss.
+func (repository *PostsCachedRepository) store(key string, field string, version string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		repository.logger.Error(variables.CacheWriteError, "error", err.Error(), "key", key)
+		return
+	}
+
+	err = storeScript.Run(repository.redisClient, []string{key, versionKey(key)},
+		version, data, field, repository.ttl.Milliseconds()).Err()
+	if err != nil {
+		repository.logger.Error(variables.CacheWriteError, "error", err.Error(), "key", key)
+	}
+}
+
+func (repository *PostsCachedRepository) AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int, status model.ModerationStatus) (*model.Comment, error) {
+	comment, err := repository.ProfileRelationalRepository.AddComment(ctx, post, user, data, parentID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.invalidatePost(post.ID)
+	return comment, nil
+}
+
+func (repository *PostsCachedRepository) UpdatePost(ctx context.Context, id int, data string) (*model.Post, error) {
+	post, err := repository.ProfileRelationalRepository.UpdatePost(ctx, id, data)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.invalidate(postKey(id))
+	return post, nil
+}
+
+func (repository *PostsCachedRepository) DeletePost(ctx context.Context, id int) error {
+	err := repository.ProfileRelationalRepository.DeletePost(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	repository.invalidate(postKey(id), commentsKey(id))
+	return nil
+}
+
+func (repository *PostsCachedRepository) SetCommentsAllowed(ctx context.Context, id int, allowed bool, user *model.User) (*model.Post, error) {
+	post, err := repository.ProfileRelationalRepository.SetCommentsAllowed(ctx, id, allowed, user)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.invalidate(postKey(id))
+	return post, nil
+}
+
+func (repository *PostsCachedRepository) UpdateComment(ctx context.Context, id int, data string) (*model.Comment, error) {
+	comment, err := repository.ProfileRelationalRepository.UpdateComment(ctx, id, data)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.invalidatePost(comment.Post.ID)
+	return comment, nil
+}
+
+func (repository *PostsCachedRepository) DeleteComment(ctx context.Context, id int) (*model.Comment, error) {
+	comment, err := repository.ProfileRelationalRepository.DeleteComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.invalidatePost(comment.Post.ID)
+	return comment, nil
+}
+
+// SetModerationStatus drops the post with its comments either way, a
+// comment changing status also changes the comment count of its post.
+func (repository *PostsCachedRepository) SetModerationStatus(ctx context.Context, target model.ReactionTarget, targetID int, status model.ModerationStatus) error {
+	postID := strconv.Itoa(targetID)
+	if target == model.ReactionTargetComment {
+		comment, err := repository.ProfileRelationalRepository.GetCommentByID(ctx, targetID)
+		if err != nil {
+			return err
+		}
+		if comment == nil {
+			return fmt.Errorf(variables.CommentNotFoundError)
+		}
+		postID = comment.Post.ID
+	}
+
+	err := repository.ProfileRelationalRepository.SetModerationStatus(ctx, target, targetID, status)
+	if err != nil {
+		return err
+	}
+
+	repository.invalidatePost(postID)
+	return nil
+}
+
+// invalidatePost drops the post, whose comment count may have changed, and
+// its cached comment pages.
+func (repository *PostsCachedRepository) invalidatePost(postID string) {
+	id, err := strconv.Atoi(postID)
+	if err != nil {
+		repository.logger.Error(variables.CacheInvalidateError, "error", err.Error(), "post", postID)
+		return
+	}
+
+	repository.invalidate(postKey(id), commentsKey(id))
+}
@@ -0,0 +1,25 @@
+package cached_repository_test
+
+import (
+	"ozon-task/pkg/variables"
+	cached_repository "ozon-task/services/posts/repository/cached"
+	"ozon-task/services/posts/repository/conformance"
+	"ozon-task/services/posts/usecase"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	postgresConfig := conformance.PostgresConfig(t)
+	redisConfig := conformance.RedisConfig(t)
+	repository, err := cached_repository.GetPostsRepository(postgresConfig, redisConfig, &variables.RepoCacheConfig{TTL: time.Minute}, conformance.Logger())
+	if err != nil {
+		t.Fatalf("GetPostsRepository: %v", err)
+	}
+
+	conformance.Run(t, func(t *testing.T) usecase.IRepository {
+		conformance.ResetPostgres(t, postgresConfig)
+		conformance.ResetRedis(t, redisConfig)
+		return repository
+	})
+}
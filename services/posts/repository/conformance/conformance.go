@@ -0,0 +1,769 @@
+// Package conformance holds the tests every posts repository has to pass, so
+// the stores stay interchangeable. Each implementation runs Run from its own
+// tests, the ones needing Postgres or Redis only when they are available.
+package conformance
+
+import (
+	"context"
+	"ozon-task/pkg/models"
+	"ozon-task/services/posts/delivery/graph/model"
+	"ozon-task/services/posts/usecase"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tests = []struct {
+	name string
+	run  func(t *testing.T, repository usecase.IRepository)
+}{
+	{"Posts", testPosts},
+	{"FeedOrders", testFeedOrders},
+	{"Premoderation", testPremoderation},
+	{"CommentTree", testCommentTree},
+	{"CommentEditing", testCommentEditing},
+	{"UserContent", testUserContent},
+	{"Reactions", testReactions},
+	{"Search", testSearch},
+	{"Reports", testReports},
+	{"DeletePost", testDeletePost},
+}
+
+// Run runs the suite, newRepository returns an empty repository for every
+// test.
+func Run(t *testing.T, newRepository func(t *testing.T) usecase.IRepository) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepository(t))
+		})
+	}
+}
+
+var (
+	ctx      = context.Background()
+	approved = model.ModerationStatusApproved
+	pending  = model.ModerationStatusPending
+	rejected = model.ModerationStatusRejected
+	alice    = &model.User{ID: "1"}
+	bob      = &model.User{ID: "2"}
+)
+
+func id(t *testing.T, value string) int {
+	t.Helper()
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		t.Fatalf("id %q: %v", value, err)
+	}
+	return parsed
+}
+
+// nodeCursor is the cursor the core builds for a node of a time ordered
+// page.
+func nodeCursor(t *testing.T, nodeId string, createdAt string) *models.Cursor {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		t.Fatalf("created at %q: %v", createdAt, err)
+	}
+	return &models.Cursor{CreatedAt: parsed, ID: id(t, nodeId)}
+}
+
+func addPost(t *testing.T, repository usecase.IRepository, user *model.User, content string, status model.ModerationStatus) *model.Post {
+	t.Helper()
+	post, err := repository.AddPost(ctx, content, user, true, status)
+	if err != nil {
+		t.Fatalf("AddPost: %v", err)
+	}
+	return post
+}
+
+func addComment(t *testing.T, repository usecase.IRepository, post *model.Post, user *model.User, parent *model.Comment, content string, status model.ModerationStatus) *model.Comment {
+	t.Helper()
+	parentID := 0
+	if parent != nil {
+		parentID = id(t, parent.ID)
+	}
+
+	comment, err := repository.AddComment(ctx, post, user, content, parentID, status)
+	if err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	return comment
+}
+
+func getPost(t *testing.T, repository usecase.IRepository, post *model.Post) *model.Post {
+	t.Helper()
+	got, err := repository.GetPostByID(ctx, id(t, post.ID))
+	if err != nil {
+		t.Fatalf("GetPostByID: %v", err)
+	}
+	return got
+}
+
+func getComment(t *testing.T, repository usecase.IRepository, comment *model.Comment) *model.Comment {
+	t.Helper()
+	got, err := repository.GetCommentByID(ctx, id(t, comment.ID))
+	if err != nil {
+		t.Fatalf("GetCommentByID: %v", err)
+	}
+	return got
+}
+
+func postIds(posts []*model.Post) []string {
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func commentIds(comments []*model.Comment) []string {
+	ids := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	return ids
+}
+
+func replyIds(comment *model.Comment) []string {
+	if comment.Replies == nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(comment.Replies.Edges))
+	for _, edge := range comment.Replies.Edges {
+		ids = append(ids, edge.Node.ID)
+	}
+	return ids
+}
+
+func expectIds(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+// expectSame compares ignoring the order, where the stores may differ.
+func expectSame[T ~string](t *testing.T, what string, got []T, want ...T) {
+	t.Helper()
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func expectPage(t *testing.T, what string, hasNextPage bool, wantNextPage bool, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	if hasNextPage != wantNextPage {
+		t.Errorf("%s: hasNextPage %v, want %v", what, hasNextPage, wantNextPage)
+	}
+}
+
+func feed(t *testing.T, repository usecase.IRepository, order model.PostOrder, first int, after *models.Cursor, wantNextPage bool) []string {
+	t.Helper()
+	posts, hasNextPage, err := repository.GetPosts(ctx, first, after, order)
+	expectPage(t, "GetPosts "+string(order), hasNextPage, wantNextPage, err)
+	return postIds(posts)
+}
+
+func thread(t *testing.T, repository usecase.IRepository, post *model.Post, first int, after *models.Cursor, depth int, wantNextPage bool) []*model.Comment {
+	t.Helper()
+	comments, hasNextPage, err := repository.GetCommentsByPostID(ctx, id(t, post.ID), first, after, depth)
+	expectPage(t, "GetCommentsByPostID", hasNextPage, wantNextPage, err)
+	return comments
+}
+
+func queue(t *testing.T, repository usecase.IRepository, targets []model.ReactionTarget, first int, after *models.Cursor, wantNextPage bool) []*model.ModerationItem {
+	t.Helper()
+	items, hasNextPage, err := repository.GetModerationQueue(ctx, targets, first, after)
+	expectPage(t, "GetModerationQueue", hasNextPage, wantNextPage, err)
+	return items
+}
+
+// queueIds names the items by their targets, like "POST:1".
+func queueIds(items []*model.ModerationItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.Post != nil {
+			ids = append(ids, string(item.TargetType)+":"+item.Post.ID)
+		} else if item.Comment != nil {
+			ids = append(ids, string(item.TargetType)+":"+item.Comment.ID)
+		}
+	}
+	return ids
+}
+
+func target(kind model.ReactionTarget, nodeId string) string {
+	return string(kind) + ":" + nodeId
+}
+
+// nonZero drops the kinds nobody reacted with any more, some stores keep
+// their counters at zero.
+func nonZero(counts map[model.ReactionKind]int) map[model.ReactionKind]int {
+	kept := make(map[model.ReactionKind]int, len(counts))
+	for kind, count := range counts {
+		if count != 0 {
+			kept[kind] = count
+		}
+	}
+	return kept
+}
+
+func expectCounts(t *testing.T, what string, got map[model.ReactionKind]int, err error, want map[model.ReactionKind]int) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+
+	got = nonZero(got)
+	if len(got) != len(want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+		return
+	}
+	for kind, count := range want {
+		if got[kind] != count {
+			t.Errorf("%s: got %v, want %v", what, got, want)
+			return
+		}
+	}
+}
+
+func testPosts(t *testing.T, repository usecase.IRepository) {
+	post := addPost(t, repository, alice, "first post", approved)
+	if post.Content != "first post" || post.ModerationStatus != approved {
+		t.Errorf("AddPost returned %+v", post)
+	}
+
+	got := getPost(t, repository, post)
+	if got == nil {
+		t.Fatalf("GetPostByID: post %s not found", post.ID)
+	}
+	if got.Content != "first post" || got.Author == nil || got.Author.ID != alice.ID || got.CreatedAt == "" {
+		t.Errorf("GetPostByID returned %+v", got)
+	}
+	if got.IsCommented == nil || !*got.IsCommented || got.CommentsCount != 0 || got.ModerationStatus != approved {
+		t.Errorf("GetPostByID returned %+v", got)
+	}
+
+	missing, err := repository.GetPostByID(ctx, id(t, post.ID)+1000)
+	if err != nil || missing != nil {
+		t.Errorf("GetPostByID of a missing post: %+v, %v", missing, err)
+	}
+
+	updated, err := repository.UpdatePost(ctx, id(t, post.ID), "edited post")
+	if err != nil {
+		t.Fatalf("UpdatePost: %v", err)
+	}
+	if updated.Content != "edited post" || getPost(t, repository, post).Content != "edited post" {
+		t.Errorf("UpdatePost did not change the content")
+	}
+
+	toggled, err := repository.SetCommentsAllowed(ctx, id(t, post.ID), false, bob)
+	if err != nil {
+		t.Fatalf("SetCommentsAllowed: %v", err)
+	}
+	for _, got := range []*model.Post{toggled, getPost(t, repository, post)} {
+		if got.IsCommented == nil || *got.IsCommented || got.CommentsToggledBy == nil || got.CommentsToggledBy.ID != bob.ID || got.CommentsToggledAt == nil {
+			t.Errorf("SetCommentsAllowed left %+v", got)
+		}
+	}
+
+	err = repository.DeletePost(ctx, id(t, post.ID))
+	if err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	if getPost(t, repository, post) != nil {
+		t.Errorf("DeletePost left the post")
+	}
+}
+
+func testFeedOrders(t *testing.T, repository usecase.IRepository) {
+	first := addPost(t, repository, alice, "one", approved)
+	second := addPost(t, repository, alice, "two", approved)
+	third := addPost(t, repository, bob, "three", approved)
+	addPost(t, repository, bob, "hidden", pending)
+
+	addComment(t, repository, first, bob, nil, "a", approved)
+	addComment(t, repository, second, bob, nil, "b", approved)
+	addComment(t, repository, second, alice, nil, "c", approved)
+
+	if got := getPost(t, repository, second).CommentsCount; got != 2 {
+		t.Errorf("comments count %d, want 2", got)
+	}
+
+	expectIds(t, "newest", feed(t, repository, model.PostOrderNewest, 10, nil, false), third.ID, second.ID, first.ID)
+	expectIds(t, "oldest", feed(t, repository, model.PostOrderOldest, 10, nil, false), first.ID, second.ID, third.ID)
+	expectIds(t, "most commented", feed(t, repository, model.PostOrderMostCommented, 10, nil, false), second.ID, first.ID, third.ID)
+	expectIds(t, "trending", feed(t, repository, model.PostOrderTrending, 10, nil, false), second.ID, first.ID, third.ID)
+
+	page, hasNextPage, err := repository.GetPosts(ctx, 2, nil, model.PostOrderNewest)
+	expectPage(t, "newest page", hasNextPage, true, err)
+	expectIds(t, "newest page", postIds(page), third.ID, second.ID)
+	last := page[len(page)-1]
+	expectIds(t, "newest next page", feed(t, repository, model.PostOrderNewest, 2, nodeCursor(t, last.ID, last.CreatedAt), false), first.ID)
+
+	oldest := feed(t, repository, model.PostOrderOldest, 1, nodeCursor(t, first.ID, first.CreatedAt), true)
+	expectIds(t, "oldest next page", oldest, second.ID)
+
+	mostCommented := feed(t, repository, model.PostOrderMostCommented, 1, &models.Cursor{Score: 2, ID: id(t, second.ID)}, true)
+	expectIds(t, "most commented next page", mostCommented, first.ID)
+	mostCommented = feed(t, repository, model.PostOrderMostCommented, 1, &models.Cursor{Score: 1, ID: id(t, first.ID)}, false)
+	expectIds(t, "most commented last page", mostCommented, third.ID)
+
+	page, hasNextPage, err = repository.GetPosts(ctx, 2, nil, model.PostOrderTrending)
+	expectPage(t, "trending page", hasNextPage, true, err)
+	last = page[len(page)-1]
+	trending := feed(t, repository, model.PostOrderTrending, 2, &models.Cursor{Score: last.TrendingScore, ID: id(t, last.ID)}, false)
+	expectIds(t, "trending next page", trending, third.ID)
+
+	_, _, err = repository.GetPosts(ctx, 10, nil, model.PostOrder("UNKNOWN"))
+	if err == nil {
+		t.Errorf("GetPosts accepted an unknown order")
+	}
+}
+
+func testPremoderation(t *testing.T, repository usecase.IRepository) {
+	post := addPost(t, repository, alice, "waiting post", pending)
+	expectIds(t, "feed with a pending post", feed(t, repository, model.PostOrderNewest, 10, nil, false))
+
+	items := queue(t, repository, []model.ReactionTarget{model.ReactionTargetPost, model.ReactionTargetComment}, 10, nil, false)
+	expectIds(t, "queue", queueIds(items), target(model.ReactionTargetPost, post.ID))
+	if len(items) == 1 && (items[0].Status != pending || items[0].ReportCount != 0) {
+		t.Errorf("queue item %+v", items[0])
+	}
+
+	err := repository.SetModerationStatus(ctx, model.ReactionTargetPost, id(t, post.ID), approved)
+	if err != nil {
+		t.Fatalf("SetModerationStatus: %v", err)
+	}
+	expectIds(t, "feed with an approved post", feed(t, repository, model.PostOrderNewest, 10, nil, false), post.ID)
+	expectIds(t, "queue after approval", queueIds(queue(t, repository, []model.ReactionTarget{model.ReactionTargetPost}, 10, nil, false)))
+
+	comment := addComment(t, repository, post, bob, nil, "waiting comment", pending)
+	expectIds(t, "thread with a pending comment", commentIds(thread(t, repository, post, 10, nil, 0, false)))
+	if got := getPost(t, repository, post).CommentsCount; got != 0 {
+		t.Errorf("pending comment counted: %d", got)
+	}
+	expectIds(t, "comments queue", queueIds(queue(t, repository, []model.ReactionTarget{model.ReactionTargetComment}, 10, nil, false)), target(model.ReactionTargetComment, comment.ID))
+
+	err = repository.SetModerationStatus(ctx, model.ReactionTargetComment, id(t, comment.ID), approved)
+	if err != nil {
+		t.Fatalf("SetModerationStatus: %v", err)
+	}
+	expectIds(t, "thread with an approved comment", commentIds(thread(t, repository, post, 10, nil, 0, false)), comment.ID)
+	if got := getPost(t, repository, post).CommentsCount; got != 1 {
+		t.Errorf("approved comment not counted: %d", got)
+	}
+
+	err = repository.SetModerationStatus(ctx, model.ReactionTargetComment, id(t, comment.ID), rejected)
+	if err != nil {
+		t.Fatalf("SetModerationStatus: %v", err)
+	}
+	expectIds(t, "thread with a rejected comment", commentIds(thread(t, repository, post, 10, nil, 0, false)))
+	if got := getPost(t, repository, post).CommentsCount; got != 0 {
+		t.Errorf("rejected comment counted: %d", got)
+	}
+	if got := getComment(t, repository, comment); got == nil || got.ModerationStatus != rejected {
+		t.Errorf("rejected comment %+v", got)
+	}
+
+	err = repository.SetModerationStatus(ctx, model.ReactionTargetPost, id(t, post.ID)+1000, approved)
+	if err == nil {
+		t.Errorf("SetModerationStatus accepted a missing post")
+	}
+}
+
+func testCommentTree(t *testing.T, repository usecase.IRepository) {
+	post := addPost(t, repository, alice, "thread", approved)
+	first := addComment(t, repository, post, bob, nil, "first", approved)
+	second := addComment(t, repository, post, alice, nil, "second", approved)
+	reply := addComment(t, repository, post, alice, first, "reply", approved)
+	nested := addComment(t, repository, post, bob, reply, "nested", approved)
+
+	if reply.ParentID != first.ID || first.ParentID != "0" {
+		t.Errorf("parents %q and %q", reply.ParentID, first.ParentID)
+	}
+
+	flat := thread(t, repository, post, 10, nil, 0, false)
+	expectIds(t, "top level", commentIds(flat), first.ID, second.ID)
+	if len(flat) > 0 && flat[0].Replies != nil {
+		t.Errorf("replies loaded at depth 0")
+	}
+
+	tree := thread(t, repository, post, 10, nil, 2, false)
+	if len(tree) != 2 {
+		t.Fatalf("tree has %d comments, want 2", len(tree))
+	}
+	expectIds(t, "replies", replyIds(tree[0]), reply.ID)
+	expectIds(t, "second replies", replyIds(tree[1]))
+	if tree[0].Replies != nil && len(tree[0].Replies.Edges) == 1 {
+		expectIds(t, "nested replies", replyIds(tree[0].Replies.Edges[0].Node), nested.ID)
+	}
+
+	expectIds(t, "first page", commentIds(thread(t, repository, post, 1, nil, 0, true)), first.ID)
+	expectIds(t, "next page", commentIds(thread(t, repository, post, 1, nodeCursor(t, first.ID, first.CreatedAt), 0, false)), second.ID)
+
+	later := addComment(t, repository, post, bob, first, "later reply", approved)
+	replies, hasNextPage, err := repository.GetReplies(ctx, id(t, post.ID), id(t, first.ID), 1, nil)
+	expectPage(t, "GetReplies", hasNextPage, true, err)
+	expectIds(t, "replies page", commentIds(replies), reply.ID)
+
+	replies, hasNextPage, err = repository.GetReplies(ctx, id(t, post.ID), id(t, first.ID), 1, nodeCursor(t, reply.ID, reply.CreatedAt))
+	expectPage(t, "GetReplies", hasNextPage, false, err)
+	expectIds(t, "replies next page", commentIds(replies), later.ID)
+}
+
+func testCommentEditing(t *testing.T, repository usecase.IRepository) {
+	post := addPost(t, repository, alice, "post", approved)
+	comment := addComment(t, repository, post, bob, nil, "comment", approved)
+
+	updated, err := repository.UpdateComment(ctx, id(t, comment.ID), "edited comment")
+	if err != nil {
+		t.Fatalf("UpdateComment: %v", err)
+	}
+	if updated.Content != "edited comment" || getComment(t, repository, comment).Content != "edited comment" {
+		t.Errorf("UpdateComment did not change the content")
+	}
+
+	deleted, err := repository.DeleteComment(ctx, id(t, comment.ID))
+	if err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if !deleted.IsDeleted || deleted.Content != "" {
+		t.Errorf("DeleteComment returned %+v", deleted)
+	}
+	if got := getPost(t, repository, post).CommentsCount; got != 0 {
+		t.Errorf("deleted comment counted: %d", got)
+	}
+
+	// A repeated delete or a moderation decision leaves the count alone.
+	_, err = repository.DeleteComment(ctx, id(t, comment.ID))
+	if err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	err = repository.SetModerationStatus(ctx, model.ReactionTargetComment, id(t, comment.ID), rejected)
+	if err != nil {
+		t.Fatalf("SetModerationStatus: %v", err)
+	}
+	err = repository.SetModerationStatus(ctx, model.ReactionTargetComment, id(t, comment.ID), approved)
+	if err != nil {
+		t.Fatalf("SetModerationStatus: %v", err)
+	}
+	if got := getPost(t, repository, post).CommentsCount; got != 0 {
+		t.Errorf("deleted comment counted after moderation: %d", got)
+	}
+
+	// The tombstone keeps its place in the thread.
+	tree := thread(t, repository, post, 10, nil, 0, false)
+	expectIds(t, "thread with a tombstone", commentIds(tree), comment.ID)
+	if len(tree) == 1 && !tree[0].IsDeleted {
+		t.Errorf("thread shows the deleted comment %+v", tree[0])
+	}
+
+	comments, _, err := repository.GetCommentsByUser(ctx, id(t, bob.ID), 10, nil)
+	if err != nil {
+		t.Fatalf("GetCommentsByUser: %v", err)
+	}
+	expectIds(t, "comments of the user", commentIds(comments))
+
+	_, err = repository.UpdateComment(ctx, id(t, comment.ID), "revived")
+	if err == nil {
+		t.Errorf("UpdateComment changed a deleted comment")
+	}
+
+	missing, err := repository.GetCommentByID(ctx, id(t, comment.ID)+1000)
+	if err != nil || missing != nil {
+		t.Errorf("GetCommentByID of a missing comment: %+v, %v", missing, err)
+	}
+}
+
+func testUserContent(t *testing.T, repository usecase.IRepository) {
+	older := addPost(t, repository, alice, "older", approved)
+	newer := addPost(t, repository, alice, "newer", approved)
+	addPost(t, repository, alice, "pending", pending)
+	other := addPost(t, repository, bob, "other", approved)
+
+	kept := addComment(t, repository, other, alice, nil, "kept", approved)
+	addComment(t, repository, other, alice, nil, "pending", pending)
+	removed := addComment(t, repository, other, alice, nil, "removed", approved)
+	addComment(t, repository, older, bob, nil, "reply", approved)
+
+	posts, hasNextPage, err := repository.GetPostsByUser(ctx, id(t, alice.ID), 10, nil)
+	expectPage(t, "GetPostsByUser", hasNextPage, false, err)
+	expectIds(t, "posts of the user", postIds(posts), newer.ID, older.ID)
+
+	posts, hasNextPage, err = repository.GetPostsByUser(ctx, id(t, alice.ID), 1, nodeCursor(t, newer.ID, newer.CreatedAt))
+	expectPage(t, "GetPostsByUser", hasNextPage, false, err)
+	expectIds(t, "posts of the user after a cursor", postIds(posts), older.ID)
+
+	_, err = repository.DeleteComment(ctx, id(t, removed.ID))
+	if err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+
+	comments, hasNextPage, err := repository.GetCommentsByUser(ctx, id(t, alice.ID), 10, nil)
+	expectPage(t, "GetCommentsByUser", hasNextPage, false, err)
+	expectIds(t, "comments of the user", commentIds(comments), kept.ID)
+
+	activity, err := repository.GetUsersActivity(ctx, []int{id(t, alice.ID), id(t, bob.ID), 1000})
+	if err != nil {
+		t.Fatalf("GetUsersActivity: %v", err)
+	}
+	want := map[int]models.UserActivity{id(t, alice.ID): {PostCount: 2, CommentCount: 1}, id(t, bob.ID): {PostCount: 1, CommentCount: 1}, 1000: {}}
+	for userId, wantActivity := range want {
+		got := activity[userId]
+		if got == nil || *got != wantActivity {
+			t.Errorf("activity of %d: got %+v, want %+v", userId, got, wantActivity)
+		}
+	}
+}
+
+func testReactions(t *testing.T, repository usecase.IRepository) {
+	post := addPost(t, repository, alice, "post", approved)
+	comment := addComment(t, repository, post, bob, nil, "comment", approved)
+	postID := id(t, post.ID)
+	like, heart := model.ReactionKindLike, model.ReactionKindHeart
+
+	counts, err := repository.AddReaction(ctx, model.ReactionTargetPost, postID, 1, like)
+	expectCounts(t, "first like", counts, err, map[model.ReactionKind]int{like: 1})
+	counts, err = repository.AddReaction(ctx, model.ReactionTargetPost, postID, 1, like)
+	expectCounts(t, "repeated like", counts, err, map[model.ReactionKind]int{like: 1})
+	counts, err = repository.AddReaction(ctx, model.ReactionTargetPost, postID, 2, like)
+	expectCounts(t, "second like", counts, err, map[model.ReactionKind]int{like: 2})
+	counts, err = repository.AddReaction(ctx, model.ReactionTargetPost, postID, 1, heart)
+	expectCounts(t, "heart", counts, err, map[model.ReactionKind]int{like: 2, heart: 1})
+	counts, err = repository.RemoveReaction(ctx, model.ReactionTargetPost, postID, 2, like)
+	expectCounts(t, "withdrawn like", counts, err, map[model.ReactionKind]int{like: 1, heart: 1})
+	counts, err = repository.RemoveReaction(ctx, model.ReactionTargetPost, postID, 2, like)
+	expectCounts(t, "withdrawn again", counts, err, map[model.ReactionKind]int{like: 1, heart: 1})
+	counts, err = repository.RemoveReaction(ctx, model.ReactionTargetPost, postID, 1, heart)
+	expectCounts(t, "withdrawn heart", counts, err, map[model.ReactionKind]int{like: 1})
+
+	commentID := id(t, comment.ID)
+	counts, err = repository.AddReaction(ctx, model.ReactionTargetComment, commentID, 1, heart)
+	expectCounts(t, "comment heart", counts, err, map[model.ReactionKind]int{heart: 1})
+
+	all, err := repository.GetReactionCounts(ctx, model.ReactionTargetPost, []int{postID, postID + 1000})
+	expectCounts(t, "post counts", all[postID], err, map[model.ReactionKind]int{like: 1})
+	expectCounts(t, "counts of a post without reactions", all[postID+1000], err, map[model.ReactionKind]int{})
+
+	all, err = repository.GetReactionCounts(ctx, model.ReactionTargetComment, []int{commentID})
+	expectCounts(t, "comment counts", all[commentID], err, map[model.ReactionKind]int{heart: 1})
+
+	own, err := repository.GetUserReactions(ctx, model.ReactionTargetPost, []int{postID}, 1)
+	if err != nil {
+		t.Fatalf("GetUserReactions: %v", err)
+	}
+	expectSame(t, "reactions of the user", own[postID], like)
+
+	own, err = repository.GetUserReactions(ctx, model.ReactionTargetPost, []int{postID}, 2)
+	if err != nil {
+		t.Fatalf("GetUserReactions: %v", err)
+	}
+	expectSame(t, "withdrawn reactions of the user", own[postID])
+}
+
+func testSearch(t *testing.T, repository usecase.IRepository) {
+	generics := addPost(t, repository, alice, "Golang generics are here", approved)
+	addPost(t, repository, alice, "Redis streams explained", approved)
+	both := addPost(t, repository, bob, "golang and redis together", approved)
+	addPost(t, repository, bob, "golang waiting for review", pending)
+
+	edges, hasNextPage, err := repository.SearchPosts(ctx, "golang", 10, nil)
+	expectPage(t, "SearchPosts", hasNextPage, false, err)
+	found := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		found = append(found, edge.Node.ID)
+		if !strings.Contains(strings.ToLower(edge.Snippet), "<b>golang</b>") {
+			t.Errorf("snippet %q does not mark the match", edge.Snippet)
+		}
+	}
+	expectSame(t, "posts about golang", found, generics.ID, both.ID)
+
+	edges, _, err = repository.SearchPosts(ctx, "golang redis", 10, nil)
+	if err != nil {
+		t.Fatalf("SearchPosts: %v", err)
+	}
+	if len(edges) != 1 || edges[0].Node.ID != both.ID {
+		t.Errorf("every word of the query must match, got %d posts", len(edges))
+	}
+
+	page, hasNextPage, err := repository.SearchPosts(ctx, "golang", 1, nil)
+	expectPage(t, "SearchPosts page", hasNextPage, true, err)
+	next, hasNextPage, err := repository.SearchPosts(ctx, "golang", 1, &models.Cursor{Score: page[0].Rank, ID: id(t, page[0].Node.ID)})
+	expectPage(t, "SearchPosts next page", hasNextPage, false, err)
+	if len(next) == 1 {
+		expectSame(t, "search pages", []string{page[0].Node.ID, next[0].Node.ID}, generics.ID, both.ID)
+	} else {
+		t.Errorf("search next page has %d posts, want 1", len(next))
+	}
+
+	nice := addComment(t, repository, both, alice, nil, "nice post", approved)
+	nicer := addComment(t, repository, both, bob, nice, "very nice indeed, nice", approved)
+	addComment(t, repository, both, bob, nil, "something else", approved)
+	addComment(t, repository, both, bob, nil, "nice but pending", pending)
+	removed := addComment(t, repository, both, bob, nil, "nice but removed", approved)
+	_, err = repository.DeleteComment(ctx, id(t, removed.ID))
+	if err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+
+	results, err := repository.SearchComments(ctx, id(t, both.ID), "nice", 10)
+	if err != nil {
+		t.Fatalf("SearchComments: %v", err)
+	}
+	matched := make([]string, 0, len(results))
+	for _, result := range results {
+		matched = append(matched, result.Comment.ID)
+		if !strings.Contains(result.Snippet, "<b>") {
+			t.Errorf("snippet %q does not mark the match", result.Snippet)
+		}
+	}
+	expectSame(t, "nice comments", matched, nice.ID, nicer.ID)
+
+	results, err = repository.SearchComments(ctx, id(t, both.ID), "nice", 1)
+	if err != nil {
+		t.Fatalf("SearchComments: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("SearchComments returned %d comments over the limit of 1", len(results))
+	}
+
+	// Snippets are HTML, the content in them must be escaped.
+	addPost(t, repository, alice, "<script>alert(1)</script> unsafe-markup", approved)
+	edges, _, err = repository.SearchPosts(ctx, "markup", 10, nil)
+	if err != nil {
+		t.Fatalf("SearchPosts: %v", err)
+	}
+	if len(edges) != 1 {
+		t.Fatalf("SearchPosts found %d posts with markup, want 1", len(edges))
+	}
+	if strings.Contains(edges[0].Snippet, "<script") || !strings.Contains(edges[0].Snippet, "<b>") {
+		t.Errorf("snippet %q is not escaped or does not mark the match", edges[0].Snippet)
+	}
+}
+
+func testReports(t *testing.T, repository usecase.IRepository) {
+	reported := addPost(t, repository, alice, "reported", approved)
+	comment := addComment(t, repository, reported, alice, nil, "rude", approved)
+	other := addPost(t, repository, bob, "other", approved)
+	reportedID := id(t, reported.ID)
+	both := []model.ReactionTarget{model.ReactionTargetPost, model.ReactionTargetComment}
+
+	reports := []struct {
+		target   model.ReactionTarget
+		targetID int
+		userId   int
+		reason   string
+	}{
+		{model.ReactionTargetPost, reportedID, 2, "spam"},
+		{model.ReactionTargetPost, reportedID, 2, "abuse"},
+		{model.ReactionTargetPost, reportedID, 3, "off topic"},
+		{model.ReactionTargetComment, id(t, comment.ID), 2, "rude"},
+		{model.ReactionTargetPost, id(t, other.ID), 4, "duplicate"},
+	}
+	for _, report := range reports {
+		err := repository.AddReport(ctx, report.target, report.targetID, report.userId, report.reason)
+		if err != nil {
+			t.Fatalf("AddReport: %v", err)
+		}
+	}
+
+	items := queue(t, repository, both, 10, nil, false)
+	expectIds(t, "queue", queueIds(items), target(model.ReactionTargetPost, reported.ID), target(model.ReactionTargetComment, comment.ID), target(model.ReactionTargetPost, other.ID))
+	if len(items) == 3 {
+		if items[0].ReportCount != 2 || items[0].Status != approved {
+			t.Errorf("queue item %+v", items[0])
+		}
+		expectSame(t, "reasons", items[0].Reasons, "abuse", "off topic")
+	}
+
+	expectIds(t, "comments queue", queueIds(queue(t, repository, []model.ReactionTarget{model.ReactionTargetComment}, 10, nil, false)), target(model.ReactionTargetComment, comment.ID))
+	expectIds(t, "posts queue", queueIds(queue(t, repository, []model.ReactionTarget{model.ReactionTargetPost}, 10, nil, false)), target(model.ReactionTargetPost, reported.ID), target(model.ReactionTargetPost, other.ID))
+
+	page := queue(t, repository, both, 1, nil, true)
+	if len(page) == 1 {
+		next := queue(t, repository, both, 1, nodeCursor(t, page[0].ID, page[0].QueuedAt), true)
+		expectIds(t, "queue next page", queueIds(next), target(model.ReactionTargetComment, comment.ID))
+	}
+
+	err := repository.SetModerationStatus(ctx, model.ReactionTargetPost, reportedID, rejected)
+	if err != nil {
+		t.Fatalf("SetModerationStatus: %v", err)
+	}
+	expectIds(t, "queue after the decision", queueIds(queue(t, repository, both, 10, nil, false)), target(model.ReactionTargetComment, comment.ID), target(model.ReactionTargetPost, other.ID))
+	expectIds(t, "feed without the rejected post", feed(t, repository, model.PostOrderNewest, 10, nil, false), other.ID)
+
+	// The reports were settled with the decision, a new one starts over.
+	err = repository.AddReport(ctx, model.ReactionTargetPost, reportedID, 5, "again")
+	if err != nil {
+		t.Fatalf("AddReport: %v", err)
+	}
+	items = queue(t, repository, []model.ReactionTarget{model.ReactionTargetPost}, 10, nil, false)
+	expectIds(t, "posts queue after a new report", queueIds(items), target(model.ReactionTargetPost, other.ID), target(model.ReactionTargetPost, reported.ID))
+	if len(items) == 2 {
+		expectSame(t, "reasons of the new report", items[1].Reasons, "again")
+		if items[1].Status != rejected {
+			t.Errorf("queue item status %s, want %s", items[1].Status, rejected)
+		}
+	}
+}
+
+func testDeletePost(t *testing.T, repository usecase.IRepository) {
+	post := addPost(t, repository, alice, "doomed", approved)
+	comment := addComment(t, repository, post, bob, nil, "comment", approved)
+	reply := addComment(t, repository, post, alice, comment, "reply", approved)
+	addComment(t, repository, post, bob, nil, "pending", pending)
+	kept := addPost(t, repository, bob, "kept", approved)
+
+	_, err := repository.AddReaction(ctx, model.ReactionTargetPost, id(t, post.ID), 2, model.ReactionKindLike)
+	if err != nil {
+		t.Fatalf("AddReaction: %v", err)
+	}
+	_, err = repository.AddReaction(ctx, model.ReactionTargetComment, id(t, comment.ID), 1, model.ReactionKindLike)
+	if err != nil {
+		t.Fatalf("AddReaction: %v", err)
+	}
+	err = repository.AddReport(ctx, model.ReactionTargetComment, id(t, reply.ID), 2, "spam")
+	if err != nil {
+		t.Fatalf("AddReport: %v", err)
+	}
+
+	err = repository.DeletePost(ctx, id(t, post.ID))
+	if err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+
+	if getPost(t, repository, post) != nil || getComment(t, repository, comment) != nil || getComment(t, repository, reply) != nil {
+		t.Errorf("DeletePost left the post or its comments")
+	}
+	expectIds(t, "feed", feed(t, repository, model.PostOrderNewest, 10, nil, false), kept.ID)
+	expectIds(t, "queue", queueIds(queue(t, repository, []model.ReactionTarget{model.ReactionTargetPost, model.ReactionTargetComment}, 10, nil, false)))
+
+	counts, err := repository.GetReactionCounts(ctx, model.ReactionTargetComment, []int{id(t, comment.ID)})
+	expectCounts(t, "reactions of a deleted comment", counts[id(t, comment.ID)], err, map[model.ReactionKind]int{})
+
+	activity, err := repository.GetUsersActivity(ctx, []int{id(t, alice.ID), id(t, bob.ID)})
+	if err != nil {
+		t.Fatalf("GetUsersActivity: %v", err)
+	}
+	if got := activity[id(t, alice.ID)]; got == nil || *got != (models.UserActivity{}) {
+		t.Errorf("activity of the author after DeletePost: %+v", got)
+	}
+	if got := activity[id(t, bob.ID)]; got == nil || *got != (models.UserActivity{PostCount: 1}) {
+		t.Errorf("activity of the commenter after DeletePost: %+v", got)
+	}
+
+	err = repository.DeletePost(ctx, id(t, post.ID))
+	if err != nil {
+		t.Errorf("DeletePost of a missing post: %v", err)
+	}
+}
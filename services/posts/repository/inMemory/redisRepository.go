@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"ozon-task/pkg/models"
 	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/posts/delivery/graph/model"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -16,6 +19,8 @@ import (
 
 type PostsCacheRepository struct {
 	postsRedisClient *redis.Client
+	// ttl bounds the life of posts and comments, zero keeps them for good.
+	ttl time.Duration
 }
 
 func (postsRedisRepository *PostsCacheRepository) reconnectRedis() error {
@@ -61,7 +66,7 @@ func (postsRedisRepository *PostsCacheRepository) pingRedis(timer int, logger *s
 	return fmt.Errorf(fmt.Sprintf(variables.AuthorizationCachePingMaxRetriesError + pingErrString + reconnectErrString))
 }
 
-func GetPostsRepository(postsConfig *variables.CacheDataBaseConfig, logger *slog.Logger) (*PostsCacheRepository, error) {
+func GetPostsRepository(postsConfig *variables.CacheDataBaseConfig, ttl time.Duration, logger *slog.Logger) (*PostsCacheRepository, error) {
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     postsConfig.Host,
 		Password: postsConfig.Password,
@@ -75,6 +80,7 @@ func GetPostsRepository(postsConfig *variables.CacheDataBaseConfig, logger *slog
 
 	postsRedisRepository := &PostsCacheRepository{
 		postsRedisClient: redisClient,
+		ttl:              ttl,
 	}
 
 	errs := make(chan error)
@@ -91,35 +97,510 @@ func GetPostsRepository(postsConfig *variables.CacheDataBaseConfig, logger *slog
 	return postsRedisRepository, nil
 }
 
-func (repo *PostsCacheRepository) GetPosts(ctx context.Context, limit int, offset int) ([]*model.Post, error) {
-	keys, err := repo.postsRedisClient.Keys("post:*").Result()
+const (
+	postsIndexKey    = "posts"
+	postsCommentsKey = "posts:comments_count"
+	postsTrendingKey = "posts:trending"
+	commentPostsKey  = "comment:posts"
+	maxWatchAttempts = 5
+
+	// Ids are taken from counters, posts and comments are numbered apart
+	// like the serial columns of the relational store.
+	postsNextIdKey    = "posts:next_id"
+	commentsNextIdKey = "comments:next_id"
+
+	// The moderation queue holds numbered entries, so it can be paged like
+	// the other indexes. The targets hash maps "<target>:<id>" to the entry
+	// of the target, the entries hash maps it back.
+	moderationQueueKey   = "moderation:queue"
+	moderationTargetsKey = "moderation:targets"
+	moderationEntriesKey = "moderation:entries"
+	moderationNextIdKey  = "moderation:next_id"
+)
+
+func postKey(id string) string {
+	return "post:" + id
+}
+
+func commentKey(postID string, id string) string {
+	return "comment:" + postID + ":" + id
+}
+
+// postCommentsIndexKey indexes the top-level comments of a post, replies
+// are indexed under their parent in commentRepliesIndexKey.
+func postCommentsIndexKey(postID string) string {
+	return "post:" + postID + ":comments"
+}
+
+func commentRepliesIndexKey(commentID string) string {
+	return "comment:" + commentID + ":replies"
+}
+
+// postCommentIdsKey holds the ids of every comment of a post, so they can
+// be removed together with it.
+func postCommentIdsKey(postID string) string {
+	return "post:" + postID + ":comment_ids"
+}
+
+// userPostsKey and userCommentsKey index the posts and live comments of a
+// user by creation time.
+func userPostsKey(userId string) string {
+	return "user:" + userId + ":posts"
+}
+
+func userCommentsKey(userId string) string {
+	return "user:" + userId + ":comments"
+}
+
+// postSearchKey and commentSearchKey are the inverted indexes: one set of
+// post or comment ids per word of their content.
+func postSearchKey(token string) string {
+	return "search:posts:" + token
+}
+
+func commentSearchKey(postID string, token string) string {
+	return "search:post:" + postID + ":comments:" + token
+}
+
+// postSearchTokensKey holds the words indexed for the comments of a post,
+// so their sets can be removed together with it.
+func postSearchTokensKey(postID string) string {
+	return "search:post:" + postID + ":tokens"
+}
+
+// reactionCountsKey holds the number of reactions of every kind left on a
+// target, reactionUsersKey the "<user>:<kind>" pairs behind them.
+func reactionCountsKey(target model.ReactionTarget, id string) string {
+	return "reactions:" + string(target) + ":" + id + ":counts"
+}
+
+func reactionUsersKey(target model.ReactionTarget, id string) string {
+	return "reactions:" + string(target) + ":" + id + ":users"
+}
+
+// moderationQueueTypeKey indexes the entries of one target type only.
+func moderationQueueTypeKey(target model.ReactionTarget) string {
+	return moderationQueueKey + ":" + string(target)
+}
+
+func moderationMember(target model.ReactionTarget, id string) string {
+	return string(target) + ":" + id
+}
+
+// reportsKey holds the reasons of the reports on a target by user.
+func reportsKey(target model.ReactionTarget, id string) string {
+	return "reports:" + string(target) + ":" + id
+}
+
+// enqueueScript puts the target ARGV[1] on the moderation queue at score
+// ARGV[2], unless it is already waiting there.
+var enqueueScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return 0
+end
+local entry = redis.call('INCR', KEYS[5])
+redis.call('HSET', KEYS[1], ARGV[1], entry)
+redis.call('HSET', KEYS[2], entry, ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[2], entry)
+redis.call('ZADD', KEYS[4], ARGV[2], entry)
+return entry
+`)
+
+// dequeueScript takes the target ARGV[1] off the moderation queue and
+// drops its reports.
+var dequeueScript = redis.NewScript(`
+local entry = redis.call('HGET', KEYS[1], ARGV[1])
+if entry then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	redis.call('HDEL', KEYS[2], entry)
+	redis.call('ZREM', KEYS[3], entry)
+	redis.call('ZREM', KEYS[4], entry)
+end
+redis.call('DEL', KEYS[5])
+return 1
+`)
+
+func enqueue(pipeline redis.Pipeliner, target model.ReactionTarget, id string, queuedAt time.Time) {
+	keys := []string{moderationTargetsKey, moderationEntriesKey, moderationQueueKey, moderationQueueTypeKey(target), moderationNextIdKey}
+	enqueueScript.Eval(pipeline, keys, moderationMember(target, id), cursorScore(queuedAt))
+}
+
+func dequeue(pipeline redis.Pipeliner, target model.ReactionTarget, id string) {
+	keys := []string{moderationTargetsKey, moderationEntriesKey, moderationQueueKey, moderationQueueTypeKey(target), reportsKey(target, id)}
+	dequeueScript.Eval(pipeline, keys, moderationMember(target, id))
+}
+
+// changeReactionScript records (ARGV[3] = 1) or withdraws (ARGV[3] = -1)
+// the reaction ARGV[2] of the user pair ARGV[1] and moves the counter only
+// if that changed anything. Both keys expire ARGV[4] milliseconds later,
+// unless it is zero. It returns the counts of the target.
+var changeReactionScript = redis.NewScript(`
+local changed
+if tonumber(ARGV[3]) > 0 then
+	changed = redis.call('HSETNX', KEYS[1], ARGV[1], 1)
+else
+	changed = redis.call('HDEL', KEYS[1], ARGV[1])
+end
+if changed == 1 then
+	if redis.call('HINCRBY', KEYS[2], ARGV[2], ARGV[3]) <= 0 then
+		redis.call('HDEL', KEYS[2], ARGV[2])
+	end
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[2], ARGV[4])
+end
+return redis.call('HGETALL', KEYS[2])
+`)
+
+// foldTrendingScript adds an activity of log-weight ARGV[2] to the trending
+// score of the post ARGV[1] as ln(e^score + e^weight). Deleted posts are
+// left out of the index.
+var foldTrendingScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return 0
+end
+score = tonumber(score)
+local weight = tonumber(ARGV[2])
+local folded = math.max(score, weight) + math.log(1 + math.exp(-math.abs(score - weight)))
+redis.call('ZADD', KEYS[1], string.format('%.17g', folded), ARGV[1])
+return 1
+`)
+
+// postIndexes holds the sorted set behind every feed order. Only the time
+// ordered one is scored by the creation time of the posts.
+var postIndexes = map[model.PostOrder]struct {
+	key        string
+	descending bool
+	byScore    bool
+}{
+	model.PostOrderNewest:        {key: postsIndexKey, descending: true},
+	model.PostOrderOldest:        {key: postsIndexKey},
+	model.PostOrderMostCommented: {key: postsCommentsKey, descending: true, byScore: true},
+	model.PostOrderTrending:      {key: postsTrendingKey, descending: true, byScore: true},
+}
+
+// cursorScore maps a creation time to a sorted set score. Microseconds
+// stay exact in a float64 for the foreseeable future.
+func cursorScore(createdAt time.Time) float64 {
+	return float64(createdAt.UnixMicro())
+}
+
+// rangeIndex returns up to first+1 members of an index that follow the
+// cursor. The index is time ordered unless byScore tells it is ordered by
+// the cursor score. Members sharing the cursor score are ordered by id.
+func (repo *PostsCacheRepository) rangeIndex(indexKey string, first int, after *models.Cursor, descending bool, byScore bool) ([]string, error) {
+	var ids []string
+	if after != nil {
+		position := after.Score
+		if !byScore {
+			position = cursorScore(after.CreatedAt)
+		}
+		score := strconv.FormatFloat(position, 'f', -1, 64)
+		ties, err := repo.postsRedisClient.ZRangeByScore(indexKey, redis.ZRangeBy{Min: score, Max: score}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Slice(ties, func(i, j int) bool {
+			left, _ := strconv.Atoi(ties[i])
+			right, _ := strconv.Atoi(ties[j])
+			if descending {
+				return left > right
+			}
+			return left < right
+		})
+
+		for _, tie := range ties {
+			tieId, err := strconv.Atoi(tie)
+			if err != nil {
+				return nil, err
+			}
+			if (descending && tieId < after.ID) || (!descending && tieId > after.ID) {
+				ids = append(ids, tie)
+			}
+		}
+
+		if len(ids) > first {
+			return ids[:first+1], nil
+		}
+
+		if descending {
+			rest, err := repo.postsRedisClient.ZRevRangeByScore(indexKey, redis.ZRangeBy{Min: "-inf", Max: "(" + score, Count: int64(first + 1 - len(ids))}).Result()
+			if err != nil {
+				return nil, err
+			}
+			return append(ids, rest...), nil
+		}
+
+		rest, err := repo.postsRedisClient.ZRangeByScore(indexKey, redis.ZRangeBy{Min: "(" + score, Max: "+inf", Count: int64(first + 1 - len(ids))}).Result()
+		if err != nil {
+			return nil, err
+		}
+		return append(ids, rest...), nil
+	}
+
+	if descending {
+		return repo.postsRedisClient.ZRevRange(indexKey, 0, int64(first)).Result()
+	}
+	return repo.postsRedisClient.ZRange(indexKey, 0, int64(first)).Result()
+}
+
+// getValues fetches the JSON values of keys in one round trip and decodes
+// them with decode. Expired keys are skipped.
+func (repo *PostsCacheRepository) getValues(keys []string, decode func(value string) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	values, err := repo.postsRedisClient.MGet(keys...).Result()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var posts []*model.Post
+	for _, value := range values {
+		stringValue, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		err = decode(stringValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetch gets the values under keys, an empty key standing for an id whose
+// value is not known any more. It returns the values found in order and
+// the positions of the keys whose values expired.
+func (repo *PostsCacheRepository) fetch(keys []string) ([]string, []int, error) {
+	known := make([]string, 0, len(keys))
 	for _, key := range keys {
-		val, err := repo.postsRedisClient.Get(key).Result()
+		if key != "" {
+			known = append(known, key)
+		}
+	}
+
+	var values []interface{}
+	if len(known) > 0 {
+		var err error
+		values, err = repo.postsRedisClient.MGet(known...).Result()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+
+	found := make([]string, 0, len(keys))
+	var expired []int
+	for i, key := range keys {
+		if key == "" {
+			expired = append(expired, i)
+			continue
+		}
+
+		value, ok := values[0].(string)
+		values = values[1:]
+		if !ok {
+			expired = append(expired, i)
+			continue
+		}
+		found = append(found, value)
+	}
+
+	return found, expired, nil
+}
+
+// rangeValues pages an index like rangeIndex and fetches the values of the
+// page, keysOf giving the key of every id. Values expire while their ids
+// stay indexed, so dangling ids are removed from the index and handed to
+// prune, then the page is ranged again until every id on it has a value.
+// It returns the ids of the page with their values.
+func (repo *PostsCacheRepository) rangeValues(indexKey string, first int, after *models.Cursor, descending bool, byScore bool,
+	keysOf func(ids []string) ([]string, error), prune func(pipeline redis.Pipeliner, ids []string)) ([]string, []string, bool, error) {
+	for {
+		ids, err := repo.rangeIndex(indexKey, first, after, descending, byScore)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		keys, err := keysOf(ids)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		values, expired, err := repo.fetch(keys)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		if len(expired) == 0 {
+			hasNextPage := len(values) > first
+			if hasNextPage {
+				ids, values = ids[:first], values[:first]
+			}
+			return ids, values, hasNextPage, nil
+		}
+
+		dangling := make([]string, 0, len(expired))
+		for _, i := range expired {
+			dangling = append(dangling, ids[i])
+		}
+
+		pipeline := repo.postsRedisClient.TxPipeline()
+		pipeline.ZRem(indexKey, members(dangling)...)
+		prune(pipeline, dangling)
+		_, err = pipeline.Exec()
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+}
+
+func members(ids []string) []interface{} {
+	values := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, id)
+	}
+	return values
+}
+
+func postKeys(ids []string) ([]string, error) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, postKey(id))
+	}
+	return keys, nil
+}
+
+// commentKeys resolves the keys of comments of any posts, the ids of
+// unknown comments get an empty key.
+func (repo *PostsCacheRepository) commentKeys(ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	postIds, err := repo.postsRedisClient.HMGet(commentPostsKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for i, id := range ids {
+		postID, ok := postIds[i].(string)
+		if !ok {
+			keys = append(keys, "")
+			continue
+		}
+		keys = append(keys, commentKey(postID, id))
+	}
+	return keys, nil
+}
+
+// threadKeys gives the keys of comments of the post postID.
+func threadKeys(postID string) func(ids []string) ([]string, error) {
+	return func(ids []string) ([]string, error) {
+		keys := make([]string, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, commentKey(postID, id))
 		}
+		return keys, nil
+	}
+}
+
+// prunePosts drops expired posts from the feeds, whichever one found them.
+func prunePosts(pipeline redis.Pipeliner, ids []string) {
+	pipeline.ZRem(postsIndexKey, members(ids)...)
+	pipeline.ZRem(postsCommentsKey, members(ids)...)
+	pipeline.ZRem(postsTrendingKey, members(ids)...)
+}
 
+// pruneComments forgets the posts of expired comments.
+func pruneComments(pipeline redis.Pipeliner, ids []string) {
+	pipeline.HDel(commentPostsKey, ids...)
+}
+
+func decodePosts(values []string) ([]*model.Post, error) {
+	posts := make([]*model.Post, 0, len(values))
+	for _, value := range values {
 		var post model.Post
-		err = json.Unmarshal([]byte(val), &post)
+		err := json.Unmarshal([]byte(value), &post)
 		if err != nil {
 			return nil, err
 		}
 		posts = append(posts, &post)
 	}
-
 	return posts, nil
 }
 
+func decodeComments(values []string) ([]*model.Comment, error) {
+	comments := make([]*model.Comment, 0, len(values))
+	for _, value := range values {
+		var comment model.Comment
+		err := json.Unmarshal([]byte(value), &comment)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+	return comments, nil
+}
+
+// withScores fills the feed counters of posts from the sorted sets, which
+// are their source of truth.
+func (repo *PostsCacheRepository) withScores(posts ...*model.Post) error {
+	pipeline := repo.postsRedisClient.Pipeline()
+	comments := make([]*redis.FloatCmd, 0, len(posts))
+	trending := make([]*redis.FloatCmd, 0, len(posts))
+	for _, post := range posts {
+		comments = append(comments, pipeline.ZScore(postsCommentsKey, post.ID))
+		trending = append(trending, pipeline.ZScore(postsTrendingKey, post.ID))
+	}
+	_, err := pipeline.Exec()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	for i, post := range posts {
+		post.CommentsCount = int(comments[i].Val())
+		post.TrendingScore = trending[i].Val()
+	}
+
+	return nil
+}
+
+func (repo *PostsCacheRepository) GetPosts(ctx context.Context, first int, after *models.Cursor, order model.PostOrder) ([]*model.Post, bool, error) {
+	index, ok := postIndexes[order]
+	if !ok {
+		return nil, false, fmt.Errorf(variables.InvalidPostOrder)
+	}
+
+	_, values, hasNextPage, err := repo.rangeValues(index.key, first, after, index.descending, index.byScore, postKeys, prunePosts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	posts, err := decodePosts(values)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = repo.withScores(posts...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return posts, hasNextPage, nil
+}
+
 func (repo *PostsCacheRepository) GetPostByID(ctx context.Context, id int) (*model.Post, error) {
-	key := "post:" + strconv.Itoa(id)
+	key := postKey(strconv.Itoa(id))
 	val, err := repo.postsRedisClient.Get(key).Result()
 	if err == redis.Nil {
-		return nil, fmt.Errorf("post not found")
+		return nil, nil
 	} else if err != nil {
 		return nil, err
 	}
@@ -130,40 +611,186 @@ func (repo *PostsCacheRepository) GetPostByID(ctx context.Context, id int) (*mod
 		return nil, err
 	}
 
+	err = repo.withScores(&post)
+	if err != nil {
+		return nil, err
+	}
+
 	return &post, nil
 }
 
-func (repo *PostsCacheRepository) GetCommentsByPostID(ctx context.Context, postID int, limit int, offset int) ([]*model.Comment, error) {
-	keys, err := repo.postsRedisClient.Keys("comment:" + strconv.Itoa(postID) + ":*").Result()
+func (repo *PostsCacheRepository) getComments(postID string, ids []string) ([]*model.Comment, error) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, commentKey(postID, id))
+	}
+
+	var comments []*model.Comment
+	err := repo.getValues(keys, func(value string) error {
+		var comment model.Comment
+		err := json.Unmarshal([]byte(value), &comment)
+		if err != nil {
+			return err
+		}
+		comments = append(comments, &comment)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var comments []*model.Comment
-	for _, key := range keys {
-		val, err := repo.postsRedisClient.Get(key).Result()
+	return comments, nil
+}
+
+// getChildren loads up to first+1 replies of every parent for the given
+// number of levels, one pipelined round trip for the indexes per level.
+func (repo *PostsCacheRepository) getChildren(postID string, parents []*model.Comment, first int, levels int) (map[string][]*model.Comment, error) {
+	children := make(map[string][]*model.Comment)
+	for level := 0; level < levels && len(parents) > 0; {
+		pipeline := repo.postsRedisClient.Pipeline()
+		ranges := make([]*redis.StringSliceCmd, 0, len(parents))
+		for _, parent := range parents {
+			ranges = append(ranges, pipeline.ZRange(commentRepliesIndexKey(parent.ID), 0, int64(first)))
+		}
+		_, err := pipeline.Exec()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		var ids, indexKeys []string
+		for i, idsRange := range ranges {
+			for _, id := range idsRange.Val() {
+				ids = append(ids, id)
+				indexKeys = append(indexKeys, commentRepliesIndexKey(parents[i].ID))
+			}
+		}
+
+		keys, _ := threadKeys(postID)(ids)
+		values, expired, err := repo.fetch(keys)
 		if err != nil {
 			return nil, err
 		}
 
-		var comment model.Comment
-		err = json.Unmarshal([]byte(val), &comment)
+		// Expired replies leave the ranges short, they are removed and the
+		// level is ranged again.
+		if len(expired) > 0 {
+			pipeline := repo.postsRedisClient.TxPipeline()
+			dangling := make([]string, 0, len(expired))
+			for _, i := range expired {
+				pipeline.ZRem(indexKeys[i], ids[i])
+				dangling = append(dangling, ids[i])
+			}
+			pruneComments(pipeline, dangling)
+			_, err = pipeline.Exec()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		replies, err := decodeComments(values)
 		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, &comment)
+
+		for _, reply := range replies {
+			children[reply.ParentID] = append(children[reply.ParentID], reply)
+		}
+		parents = replies
+		level++
 	}
 
-	return comments, nil
+	return children, nil
+}
+
+func (repo *PostsCacheRepository) GetCommentsByPostID(ctx context.Context, postID int, first int, after *models.Cursor, depth int) ([]*model.Comment, bool, error) {
+	post := strconv.Itoa(postID)
+	_, values, hasNextPage, err := repo.rangeValues(postCommentsIndexKey(post), first, after, false, false, threadKeys(post), pruneComments)
+	if err != nil {
+		return nil, false, err
+	}
+
+	comments, err := decodeComments(values)
+	if err != nil {
+		return nil, false, err
+	}
+
+	children, err := repo.getChildren(post, comments, first, depth)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = model.BuildCommentTree(comments, children, first, depth)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return comments, hasNextPage, nil
+}
+
+func (repo *PostsCacheRepository) GetReplies(ctx context.Context, postID int, parentID int, first int, after *models.Cursor) ([]*model.Comment, bool, error) {
+	_, values, hasNextPage, err := repo.rangeValues(commentRepliesIndexKey(strconv.Itoa(parentID)), first, after, false, false,
+		threadKeys(strconv.Itoa(postID)), pruneComments)
+	if err != nil {
+		return nil, false, err
+	}
+
+	replies, err := decodeComments(values)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return replies, hasNextPage, nil
+}
+
+// expire gives index keys the ttl of the values they list. Every member was
+// stored before now, so its value is gone by the time the key is. The feeds
+// shared by all posts never expire, their dangling ids are pruned on reads.
+func expire(pipeline redis.Pipeliner, ttl time.Duration, keys ...string) {
+	if ttl <= 0 {
+		return
+	}
+
+	for _, key := range keys {
+		pipeline.Expire(key, ttl)
+	}
 }
 
-func (repo *PostsCacheRepository) AddPost(ctx context.Context, data string, user *model.User, isCommented bool) (*model.Post, error) {
+// addToFeeds puts an approved post into the feed, user and search indexes.
+func addToFeeds(pipeline redis.Pipeliner, post *model.Post, createdAt time.Time, ttl time.Duration) {
+	pipeline.ZAdd(postsIndexKey, redis.Z{Score: cursorScore(createdAt), Member: post.ID})
+	pipeline.ZAdd(userPostsKey(post.Author.ID), redis.Z{Score: cursorScore(createdAt), Member: post.ID})
+	pipeline.ZAddNX(postsCommentsKey, redis.Z{Score: 0, Member: post.ID})
+	pipeline.ZAddNX(postsTrendingKey, redis.Z{Score: post.TrendingScore, Member: post.ID})
+	expire(pipeline, ttl, userPostsKey(post.Author.ID))
+	indexPost(pipeline, post.ID, "", post.Content, ttl)
+}
+
+func removeFromFeeds(pipeline redis.Pipeliner, post *model.Post) {
+	pipeline.ZRem(postsIndexKey, post.ID)
+	pipeline.ZRem(userPostsKey(post.Author.ID), post.ID)
+	pipeline.ZRem(postsCommentsKey, post.ID)
+	pipeline.ZRem(postsTrendingKey, post.ID)
+	indexPost(pipeline, post.ID, post.Content, "", 0)
+}
+
+// AddPost stores a pending post outside of every index, it only waits on
+// the moderation queue.
+func (repo *PostsCacheRepository) AddPost(ctx context.Context, data string, user *model.User, isCommented bool, status model.ModerationStatus) (*model.Post, error) {
+	id, err := repo.postsRedisClient.Incr(postsNextIdKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now().UTC()
 	post := &model.Post{
-		ID:          strconv.Itoa(util.RandInt()),
-		Author:      user,
-		Content:     data,
-		IsCommented: &isCommented,
-		CreatedAt:   time.Now().String(),
+		ID:               strconv.FormatInt(id, 10),
+		Author:           user,
+		Content:          data,
+		IsCommented:      &isCommented,
+		CreatedAt:        createdAt.Format(time.RFC3339Nano),
+		TrendingScore:    util.TrendingWeight(createdAt),
+		ModerationStatus: status,
 	}
 
 	postBytes, err := json.Marshal(post)
@@ -171,8 +798,14 @@ func (repo *PostsCacheRepository) AddPost(ctx context.Context, data string, user
 		return nil, err
 	}
 
-	key := "post:" + post.ID
-	err = repo.postsRedisClient.Set(key, postBytes, time.Duration(time.Hour*24)).Err()
+	pipeline := repo.postsRedisClient.TxPipeline()
+	pipeline.Set(postKey(post.ID), postBytes, repo.ttl)
+	if status == model.ModerationStatusApproved {
+		addToFeeds(pipeline, post, createdAt, repo.ttl)
+	} else {
+		enqueue(pipeline, model.ReactionTargetPost, post.ID, createdAt)
+	}
+	_, err = pipeline.Exec()
 	if err != nil {
 		return nil, err
 	}
@@ -180,14 +813,58 @@ func (repo *PostsCacheRepository) AddPost(ctx context.Context, data string, user
 	return post, nil
 }
 
-func (repo *PostsCacheRepository) AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int) (*model.Comment, error) {
+// threadIndexKey is the index listing the comment under its parent.
+func threadIndexKey(comment *model.Comment) string {
+	if comment.ParentID != "0" {
+		return commentRepliesIndexKey(comment.ParentID)
+	}
+	return postCommentsIndexKey(comment.Post.ID)
+}
+
+// addToThread puts an approved comment into the thread and, while it is
+// live, into the user and search indexes and the counters of its post.
+func addToThread(pipeline redis.Pipeliner, comment *model.Comment, createdAt time.Time, ttl time.Duration) {
+	pipeline.ZAdd(threadIndexKey(comment), redis.Z{Score: cursorScore(createdAt), Member: comment.ID})
+	expire(pipeline, ttl, threadIndexKey(comment))
+	if comment.IsDeleted {
+		return
+	}
+
+	pipeline.ZAdd(userCommentsKey(comment.Author.ID), redis.Z{Score: cursorScore(createdAt), Member: comment.ID})
+	expire(pipeline, ttl, userCommentsKey(comment.Author.ID))
+	indexComment(pipeline, comment.Post.ID, comment.ID, "", comment.Content, ttl)
+	pipeline.ZIncrBy(postsCommentsKey, 1, comment.Post.ID)
+	foldTrendingScript.Eval(pipeline, []string{postsTrendingKey}, comment.Post.ID, util.TrendingWeight(createdAt))
+}
+
+// removeFromThread is the reverse of addToThread, except that the trending
+// score keeps the weight of the comment.
+func removeFromThread(pipeline redis.Pipeliner, comment *model.Comment) {
+	pipeline.ZRem(threadIndexKey(comment), comment.ID)
+	if comment.IsDeleted {
+		return
+	}
+
+	pipeline.ZRem(userCommentsKey(comment.Author.ID), comment.ID)
+	indexComment(pipeline, comment.Post.ID, comment.ID, comment.Content, "", 0)
+	pipeline.ZIncrBy(postsCommentsKey, -1, comment.Post.ID)
+}
+
+func (repo *PostsCacheRepository) AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int, status model.ModerationStatus) (*model.Comment, error) {
+	id, err := repo.postsRedisClient.Incr(commentsNextIdKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now().UTC()
 	comment := &model.Comment{
-		ID:        strconv.Itoa(util.RandInt()),
-		Author:    user,
-		Post:      post,
-		ParentID:  strconv.Itoa(parentID),
-		Content:   data,
-		CreatedAt: time.Now().String(),
+		ID:               strconv.FormatInt(id, 10),
+		Author:           user,
+		Post:             post,
+		ParentID:         strconv.Itoa(parentID),
+		Content:          data,
+		CreatedAt:        createdAt.Format(time.RFC3339Nano),
+		ModerationStatus: status,
 	}
 
 	commentBytes, err := json.Marshal(comment)
@@ -195,11 +872,837 @@ func (repo *PostsCacheRepository) AddComment(ctx context.Context, post *model.Po
 		return nil, err
 	}
 
-	key := "comment:" + post.ID + ":" + comment.ID
-	err = repo.postsRedisClient.Set(key, commentBytes, time.Duration(time.Hour*24)).Err()
+	pipeline := repo.postsRedisClient.TxPipeline()
+	pipeline.Set(commentKey(post.ID, comment.ID), commentBytes, repo.ttl)
+	pipeline.HSet(commentPostsKey, comment.ID, post.ID)
+	pipeline.SAdd(postCommentIdsKey(post.ID), comment.ID)
+	expire(pipeline, repo.ttl, postCommentIdsKey(post.ID))
+	if status == model.ModerationStatusApproved {
+		addToThread(pipeline, comment, createdAt, repo.ttl)
+	} else {
+		enqueue(pipeline, model.ReactionTargetComment, comment.ID, createdAt)
+	}
+	_, err = pipeline.Exec()
 	if err != nil {
 		return nil, err
 	}
 
 	return comment, nil
 }
+
+// updateJSON rewrites the JSON value under key with update, keeping its TTL.
+// The value is watched, so a concurrent write makes the update start over.
+func (repo *PostsCacheRepository) updateJSON(key string, value any, update func() error) error {
+	var err error
+	for attempt := 0; attempt < maxWatchAttempts; attempt++ {
+		err = repo.postsRedisClient.Watch(func(tx *redis.Tx) error {
+			current, err := tx.Get(key).Result()
+			if err != nil {
+				return err
+			}
+
+			ttl, err := tx.TTL(key).Result()
+			if err != nil {
+				return err
+			}
+
+			if ttl < 0 {
+				ttl = 0
+			}
+
+			err = json.Unmarshal([]byte(current), value)
+			if err != nil {
+				return err
+			}
+
+			err = update()
+			if err != nil {
+				return err
+			}
+
+			updated, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Pipelined(func(pipeline redis.Pipeliner) error {
+				pipeline.Set(key, updated, ttl)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (repo *PostsCacheRepository) getCommentKey(id int) (string, error) {
+	commentId := strconv.Itoa(id)
+	postID, err := repo.postsRedisClient.HGet(commentPostsKey, commentId).Result()
+	if err != nil {
+		return "", err
+	}
+
+	return commentKey(postID, commentId), nil
+}
+
+func (repo *PostsCacheRepository) GetCommentByID(ctx context.Context, id int) (*model.Comment, error) {
+	key, err := repo.getCommentKey(id)
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	val, err := repo.postsRedisClient.Get(key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var comment model.Comment
+	err = json.Unmarshal([]byte(val), &comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (repo *PostsCacheRepository) UpdatePost(ctx context.Context, id int, data string) (*model.Post, error) {
+	var post model.Post
+	var previous string
+	err := repo.updateJSON(postKey(strconv.Itoa(id)), &post, func() error {
+		previous = post.Content
+		post.Content = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if post.ModerationStatus == model.ModerationStatusApproved {
+		pipeline := repo.postsRedisClient.TxPipeline()
+		indexPost(pipeline, post.ID, previous, data, repo.ttl)
+		_, err = pipeline.Exec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.withScores(&post)
+	if err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+func (repo *PostsCacheRepository) SetCommentsAllowed(ctx context.Context, id int, allowed bool, user *model.User) (*model.Post, error) {
+	var post model.Post
+	err := repo.updateJSON(postKey(strconv.Itoa(id)), &post, func() error {
+		toggledAt := time.Now().UTC().Format(time.RFC3339Nano)
+		post.IsCommented = &allowed
+		post.CommentsToggledBy = user
+		post.CommentsToggledAt = &toggledAt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.withScores(&post)
+	if err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+func (repo *PostsCacheRepository) DeletePost(ctx context.Context, id int) error {
+	post := strconv.Itoa(id)
+	commentIds, err := repo.postsRedisClient.SMembers(postCommentIdsKey(post)).Result()
+	if err != nil {
+		return err
+	}
+
+	commentTokens, err := repo.postsRedisClient.SMembers(postSearchTokensKey(post)).Result()
+	if err != nil {
+		return err
+	}
+
+	var stored model.Post
+	value, err := repo.postsRedisClient.Get(postKey(post)).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(value), &stored)
+		if err != nil {
+			return err
+		}
+	}
+
+	comments, err := repo.getComments(post, commentIds)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{postKey(post), postCommentsIndexKey(post), postCommentIdsKey(post), postSearchTokensKey(post),
+		reactionCountsKey(model.ReactionTargetPost, post), reactionUsersKey(model.ReactionTargetPost, post)}
+	for _, commentId := range commentIds {
+		keys = append(keys, commentKey(post, commentId), commentRepliesIndexKey(commentId),
+			reactionCountsKey(model.ReactionTargetComment, commentId), reactionUsersKey(model.ReactionTargetComment, commentId))
+	}
+	for _, token := range commentTokens {
+		keys = append(keys, commentSearchKey(post, token))
+	}
+
+	pipeline := repo.postsRedisClient.TxPipeline()
+	pipeline.Del(keys...)
+	indexPost(pipeline, post, stored.Content, "", 0)
+	if stored.Author != nil {
+		pipeline.ZRem(userPostsKey(stored.Author.ID), post)
+	}
+	for _, comment := range comments {
+		pipeline.ZRem(userCommentsKey(comment.Author.ID), comment.ID)
+	}
+	dequeue(pipeline, model.ReactionTargetPost, post)
+	for _, commentId := range commentIds {
+		dequeue(pipeline, model.ReactionTargetComment, commentId)
+	}
+	pipeline.ZRem(postsIndexKey, post)
+	pipeline.ZRem(postsCommentsKey, post)
+	pipeline.ZRem(postsTrendingKey, post)
+	if len(commentIds) > 0 {
+		pipeline.HDel(commentPostsKey, commentIds...)
+	}
+	_, err = pipeline.Exec()
+	return err
+}
+
+func (repo *PostsCacheRepository) UpdateComment(ctx context.Context, id int, data string) (*model.Comment, error) {
+	key, err := repo.getCommentKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var comment model.Comment
+	var previous string
+	err = repo.updateJSON(key, &comment, func() error {
+		if comment.IsDeleted {
+			return fmt.Errorf(variables.CommentDeletedError)
+		}
+		previous = comment.Content
+		comment.Content = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.ModerationStatus == model.ModerationStatusApproved {
+		pipeline := repo.postsRedisClient.TxPipeline()
+		indexComment(pipeline, comment.Post.ID, comment.ID, previous, data, repo.ttl)
+		_, err = pipeline.Exec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &comment, nil
+}
+
+func (repo *PostsCacheRepository) DeleteComment(ctx context.Context, id int) (*model.Comment, error) {
+	key, err := repo.getCommentKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var comment model.Comment
+	var previous string
+	var counted bool
+	err = repo.updateJSON(key, &comment, func() error {
+		previous = comment.Content
+		counted = !comment.IsDeleted && comment.ModerationStatus == model.ModerationStatusApproved
+		comment.Content = ""
+		comment.IsDeleted = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := repo.postsRedisClient.TxPipeline()
+	indexComment(pipeline, comment.Post.ID, comment.ID, previous, "", 0)
+	pipeline.ZRem(userCommentsKey(comment.Author.ID), comment.ID)
+	if counted {
+		pipeline.ZIncrBy(postsCommentsKey, -1, comment.Post.ID)
+	}
+	dequeue(pipeline, model.ReactionTargetComment, comment.ID)
+	_, err = pipeline.Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// reindex moves id from the sets of the words that are only in previous
+// to the sets of the words of current, which expire after ttl.
+func reindex(pipeline redis.Pipeliner, key func(token string) string, id string, previous string, current string, ttl time.Duration) []string {
+	currentTokens := util.UniqueTokens(current)
+	kept := make(map[string]bool, len(currentTokens))
+	for _, token := range currentTokens {
+		kept[token] = true
+		pipeline.SAdd(key(token), id)
+		expire(pipeline, ttl, key(token))
+	}
+
+	for _, token := range util.UniqueTokens(previous) {
+		if !kept[token] {
+			pipeline.SRem(key(token), id)
+		}
+	}
+
+	return currentTokens
+}
+
+func indexPost(pipeline redis.Pipeliner, postID string, previous string, current string, ttl time.Duration) {
+	reindex(pipeline, postSearchKey, postID, previous, current, ttl)
+}
+
+func indexComment(pipeline redis.Pipeliner, postID string, commentID string, previous string, current string, ttl time.Duration) {
+	tokens := reindex(pipeline, func(token string) string {
+		return commentSearchKey(postID, token)
+	}, commentID, previous, current, ttl)
+
+	if len(tokens) > 0 {
+		pipeline.SAdd(postSearchTokensKey(postID), members(tokens)...)
+		expire(pipeline, ttl, postSearchTokensKey(postID))
+	}
+}
+
+// searchIds returns the ids present in the index sets of every query word.
+func (repo *PostsCacheRepository) searchIds(tokens []string, key func(token string) string) ([]string, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		keys = append(keys, key(token))
+	}
+
+	return repo.postsRedisClient.SInter(keys...).Result()
+}
+
+// unindexExpired takes the ids at the expired positions out of the sets
+// of the query words and returns them.
+func unindexExpired(pipeline redis.Pipeliner, ids []string, expired []int, tokens []string, key func(token string) string) []string {
+	dangling := make([]string, 0, len(expired))
+	for _, i := range expired {
+		dangling = append(dangling, ids[i])
+	}
+
+	for _, token := range tokens {
+		pipeline.SRem(key(token), members(dangling)...)
+	}
+
+	return dangling
+}
+
+// rankedBefore orders search results by rank, then by id, both descending.
+func rankedBefore(leftRank float64, leftId string, rightRank float64, rightId string) bool {
+	if leftRank != rightRank {
+		return leftRank > rightRank
+	}
+
+	left, _ := strconv.Atoi(leftId)
+	right, _ := strconv.Atoi(rightId)
+	return left > right
+}
+
+func (repo *PostsCacheRepository) SearchPosts(ctx context.Context, search string, first int, after *models.Cursor) ([]*model.PostSearchEdge, bool, error) {
+	tokens := util.UniqueTokens(search)
+	ids, err := repo.searchIds(tokens, postSearchKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	keys, _ := postKeys(ids)
+	values, expired, err := repo.fetch(keys)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(expired) > 0 {
+		pipeline := repo.postsRedisClient.TxPipeline()
+		dangling := unindexExpired(pipeline, ids, expired, tokens, postSearchKey)
+		prunePosts(pipeline, dangling)
+		_, err = pipeline.Exec()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	found, err := decodePosts(values)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var edges []*model.PostSearchEdge
+	for _, post := range found {
+		rank := util.SearchRank(post.Content, tokens)
+		if after != nil && !rankedBefore(after.Score, strconv.Itoa(after.ID), rank, post.ID) {
+			continue
+		}
+
+		edges = append(edges, &model.PostSearchEdge{Node: post, Rank: rank})
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return rankedBefore(edges[i].Rank, edges[i].Node.ID, edges[j].Rank, edges[j].Node.ID)
+	})
+
+	hasNextPage := len(edges) > first
+	if hasNextPage {
+		edges = edges[:first]
+	}
+
+	posts := make([]*model.Post, 0, len(edges))
+	for _, edge := range edges {
+		edge.Snippet = util.Highlight(edge.Node.Content, tokens)
+		posts = append(posts, edge.Node)
+	}
+
+	err = repo.withScores(posts...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return edges, hasNextPage, nil
+}
+
+func (repo *PostsCacheRepository) SearchComments(ctx context.Context, postID int, search string, limit int) ([]*model.CommentSearchResult, error) {
+	post := strconv.Itoa(postID)
+	tokens := util.UniqueTokens(search)
+	ids, err := repo.searchIds(tokens, func(token string) string {
+		return commentSearchKey(post, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _ := threadKeys(post)(ids)
+	values, expired, err := repo.fetch(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(expired) > 0 {
+		pipeline := repo.postsRedisClient.TxPipeline()
+		dangling := unindexExpired(pipeline, ids, expired, tokens, func(token string) string {
+			return commentSearchKey(post, token)
+		})
+		pruneComments(pipeline, dangling)
+		_, err = pipeline.Exec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	comments, err := decodeComments(values)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*model.CommentSearchResult, 0, len(comments))
+	for _, comment := range comments {
+		results = append(results, &model.CommentSearchResult{
+			Comment: comment,
+			Rank:    util.SearchRank(comment.Content, tokens),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return rankedBefore(results[i].Rank, results[i].Comment.ID, results[j].Rank, results[j].Comment.ID)
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	for _, result := range results {
+		result.Snippet = util.Highlight(result.Comment.Content, tokens)
+	}
+
+	return results, nil
+}
+
+func reactionCounts(values map[string]string) (map[model.ReactionKind]int, error) {
+	counts := make(map[model.ReactionKind]int, len(values))
+	for kind, value := range values {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		counts[model.ReactionKind(kind)] = count
+	}
+
+	return counts, nil
+}
+
+func (repo *PostsCacheRepository) changeReaction(target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind, delta int) (map[model.ReactionKind]int, error) {
+	id := strconv.Itoa(targetID)
+	keys := []string{reactionUsersKey(target, id), reactionCountsKey(target, id)}
+	result, err := changeReactionScript.Run(repo.postsRedisClient, keys, strconv.Itoa(userId)+":"+string(kind), string(kind), delta,
+		repo.ttl.Milliseconds()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reaction counts %v", result)
+	}
+
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		kind, _ := pairs[i].(string)
+		value, _ := pairs[i+1].(string)
+		values[kind] = value
+	}
+
+	return reactionCounts(values)
+}
+
+func (repo *PostsCacheRepository) AddReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	return repo.changeReaction(target, targetID, userId, kind, 1)
+}
+
+func (repo *PostsCacheRepository) RemoveReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	return repo.changeReaction(target, targetID, userId, kind, -1)
+}
+
+func (repo *PostsCacheRepository) GetReactionCounts(ctx context.Context, target model.ReactionTarget, ids []int) (map[int]map[model.ReactionKind]int, error) {
+	pipeline := repo.postsRedisClient.Pipeline()
+	results := make([]*redis.StringStringMapCmd, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, pipeline.HGetAll(reactionCountsKey(target, strconv.Itoa(id))))
+	}
+	_, err := pipeline.Exec()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counts := make(map[int]map[model.ReactionKind]int, len(ids))
+	for i, id := range ids {
+		counts[id], err = reactionCounts(results[i].Val())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+func (repo *PostsCacheRepository) GetUserReactions(ctx context.Context, target model.ReactionTarget, ids []int, userId int) (map[int][]model.ReactionKind, error) {
+	fields := make([]string, 0, len(model.AllReactionKind))
+	for _, kind := range model.AllReactionKind {
+		fields = append(fields, strconv.Itoa(userId)+":"+string(kind))
+	}
+
+	pipeline := repo.postsRedisClient.Pipeline()
+	results := make([]*redis.SliceCmd, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, pipeline.HMGet(reactionUsersKey(target, strconv.Itoa(id)), fields...))
+	}
+	_, err := pipeline.Exec()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	reactions := make(map[int][]model.ReactionKind, len(ids))
+	for i, id := range ids {
+		for j, value := range results[i].Val() {
+			if value != nil {
+				reactions[id] = append(reactions[id], model.AllReactionKind[j])
+			}
+		}
+	}
+
+	return reactions, nil
+}
+
+func (repo *PostsCacheRepository) GetPostsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Post, bool, error) {
+	_, values, hasNextPage, err := repo.rangeValues(userPostsKey(strconv.Itoa(userId)), first, after, true, false, postKeys, prunePosts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	posts, err := decodePosts(values)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = repo.withScores(posts...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return posts, hasNextPage, nil
+}
+
+func (repo *PostsCacheRepository) GetCommentsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Comment, bool, error) {
+	_, values, hasNextPage, err := repo.rangeValues(userCommentsKey(strconv.Itoa(userId)), first, after, true, false, repo.commentKeys, pruneComments)
+	if err != nil {
+		return nil, false, err
+	}
+
+	comments, err := decodeComments(values)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return comments, hasNextPage, nil
+}
+
+func (repo *PostsCacheRepository) GetUsersActivity(ctx context.Context, ids []int) (map[int]*models.UserActivity, error) {
+	pipeline := repo.postsRedisClient.Pipeline()
+	posts := make([]*redis.IntCmd, 0, len(ids))
+	comments := make([]*redis.IntCmd, 0, len(ids))
+	for _, id := range ids {
+		posts = append(posts, pipeline.ZCard(userPostsKey(strconv.Itoa(id))))
+		comments = append(comments, pipeline.ZCard(userCommentsKey(strconv.Itoa(id))))
+	}
+	_, err := pipeline.Exec()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	activity := make(map[int]*models.UserActivity, len(ids))
+	for i, id := range ids {
+		activity[id] = &models.UserActivity{
+			PostCount:    int(posts[i].Val()),
+			CommentCount: int(comments[i].Val()),
+		}
+	}
+
+	return activity, nil
+}
+
+// SetModerationStatus approves or rejects the target and takes it off the
+// moderation queue together with its reports. Content entering the approved
+// ones is indexed, content leaving them is taken out of the indexes.
+func (repo *PostsCacheRepository) SetModerationStatus(ctx context.Context, target model.ReactionTarget, targetID int, status model.ModerationStatus) error {
+	id := strconv.Itoa(targetID)
+	var previous model.ModerationStatus
+	setStatus := func(current *model.ModerationStatus) func() error {
+		return func() error {
+			previous = *current
+			*current = status
+			return nil
+		}
+	}
+
+	pipeline := repo.postsRedisClient.TxPipeline()
+	switch target {
+	case model.ReactionTargetPost:
+		var post model.Post
+		err := repo.updateJSON(postKey(id), &post, setStatus(&post.ModerationStatus))
+		if err == redis.Nil {
+			return fmt.Errorf(variables.PostNotFoundError)
+		}
+		if err != nil {
+			return err
+		}
+
+		if previous != model.ModerationStatusApproved && status == model.ModerationStatusApproved {
+			createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+			if err != nil {
+				return err
+			}
+			addToFeeds(pipeline, &post, createdAt, repo.ttl)
+		} else if previous == model.ModerationStatusApproved && status != model.ModerationStatusApproved {
+			removeFromFeeds(pipeline, &post)
+		}
+	case model.ReactionTargetComment:
+		key, err := repo.getCommentKey(targetID)
+		if err == redis.Nil {
+			return fmt.Errorf(variables.CommentNotFoundError)
+		}
+		if err != nil {
+			return err
+		}
+
+		var comment model.Comment
+		err = repo.updateJSON(key, &comment, setStatus(&comment.ModerationStatus))
+		if err == redis.Nil {
+			return fmt.Errorf(variables.CommentNotFoundError)
+		}
+		if err != nil {
+			return err
+		}
+
+		if previous != model.ModerationStatusApproved && status == model.ModerationStatusApproved {
+			createdAt, err := time.Parse(time.RFC3339Nano, comment.CreatedAt)
+			if err != nil {
+				return err
+			}
+			addToThread(pipeline, &comment, createdAt, repo.ttl)
+		} else if previous == model.ModerationStatusApproved && status != model.ModerationStatusApproved {
+			removeFromThread(pipeline, &comment)
+		}
+	default:
+		return fmt.Errorf(variables.InvalidReactionTarget)
+	}
+
+	dequeue(pipeline, target, id)
+	_, err := pipeline.Exec()
+	return err
+}
+
+// AddReport records the report of the user, a repeated one replaces the
+// reason, and puts the target on the moderation queue.
+func (repo *PostsCacheRepository) AddReport(ctx context.Context, target model.ReactionTarget, targetID int, userId int, reason string) error {
+	id := strconv.Itoa(targetID)
+	pipeline := repo.postsRedisClient.TxPipeline()
+	pipeline.HSet(reportsKey(target, id), strconv.Itoa(userId), reason)
+	expire(pipeline, repo.ttl, reportsKey(target, id))
+	enqueue(pipeline, target, id, time.Now().UTC())
+	_, err := pipeline.Exec()
+	return err
+}
+
+// GetModerationQueue returns up to first items of the targets, oldest
+// first, with the reasons of their reports. Entries of expired targets are
+// taken off the queue.
+func (repo *PostsCacheRepository) GetModerationQueue(ctx context.Context, targets []model.ReactionTarget, first int, after *models.Cursor) ([]*model.ModerationItem, bool, error) {
+	queueKey := moderationQueueKey
+	if len(targets) == 1 {
+		queueKey = moderationQueueTypeKey(targets[0])
+	}
+
+	targetOf := make(map[string][]string)
+	keysOf := func(entries []string) ([]string, error) {
+		if len(entries) == 0 {
+			return nil, nil
+		}
+
+		entryMembers, err := repo.postsRedisClient.HMGet(moderationEntriesKey, entries...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]string, len(entries))
+		var commentIds []string
+		var commentAt []int
+		for i, entry := range entries {
+			member, ok := entryMembers[i].(string)
+			if !ok {
+				continue
+			}
+
+			parts := strings.SplitN(member, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			targetOf[entry] = parts
+			if model.ReactionTarget(parts[0]) == model.ReactionTargetPost {
+				keys[i] = postKey(parts[1])
+			} else {
+				commentIds = append(commentIds, parts[1])
+				commentAt = append(commentAt, i)
+			}
+		}
+
+		commentKeys, err := repo.commentKeys(commentIds)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range commentAt {
+			keys[i] = commentKeys[j]
+		}
+
+		return keys, nil
+	}
+
+	prune := func(pipeline redis.Pipeliner, entries []string) {
+		for _, entry := range entries {
+			parts, ok := targetOf[entry]
+			if ok {
+				dequeue(pipeline, model.ReactionTarget(parts[0]), parts[1])
+				continue
+			}
+
+			pipeline.HDel(moderationEntriesKey, entry)
+			pipeline.ZRem(moderationQueueKey, entry)
+			pipeline.ZRem(moderationQueueTypeKey(model.ReactionTargetPost), entry)
+			pipeline.ZRem(moderationQueueTypeKey(model.ReactionTargetComment), entry)
+		}
+	}
+
+	entries, values, hasNextPage, err := repo.rangeValues(queueKey, first, after, false, false, keysOf, prune)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(entries) == 0 {
+		return nil, hasNextPage, nil
+	}
+
+	items := make([]*model.ModerationItem, 0, len(entries))
+	var posts []*model.Post
+	pipeline := repo.postsRedisClient.Pipeline()
+	scores := make([]*redis.FloatCmd, 0, len(entries))
+	reasons := make([]*redis.StringSliceCmd, 0, len(entries))
+	for i, entry := range entries {
+		parts := targetOf[entry]
+		item := &model.ModerationItem{ID: entry, TargetType: model.ReactionTarget(parts[0])}
+		if item.TargetType == model.ReactionTargetPost {
+			var post model.Post
+			err = json.Unmarshal([]byte(values[i]), &post)
+			if err != nil {
+				return nil, false, err
+			}
+			item.Post = &post
+			item.Status = post.ModerationStatus
+			posts = append(posts, &post)
+		} else {
+			var comment model.Comment
+			err = json.Unmarshal([]byte(values[i]), &comment)
+			if err != nil {
+				return nil, false, err
+			}
+			item.Comment = &comment
+			item.Status = comment.ModerationStatus
+		}
+
+		scores = append(scores, pipeline.ZScore(queueKey, entry))
+		reasons = append(reasons, pipeline.HVals(reportsKey(item.TargetType, parts[1])))
+		items = append(items, item)
+	}
+	_, err = pipeline.Exec()
+	if err != nil && err != redis.Nil {
+		return nil, false, err
+	}
+
+	for i, item := range items {
+		item.QueuedAt = time.UnixMicro(int64(scores[i].Val())).UTC().Format(time.RFC3339Nano)
+		item.Reasons = reasons[i].Val()
+		item.ReportCount = len(item.Reasons)
+	}
+
+	err = repo.withScores(posts...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return items, hasNextPage, nil
+}
@@ -0,0 +1,21 @@
+package inmemory_repository_test
+
+import (
+	"ozon-task/services/posts/repository/conformance"
+	inmemory_repository "ozon-task/services/posts/repository/inMemory"
+	"ozon-task/services/posts/usecase"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	config := conformance.RedisConfig(t)
+	repository, err := inmemory_repository.GetPostsRepository(config, 0, conformance.Logger())
+	if err != nil {
+		t.Fatalf("GetPostsRepository: %v", err)
+	}
+
+	conformance.Run(t, func(t *testing.T) usecase.IRepository {
+		conformance.ResetRedis(t, config)
+		return repository
+	})
+}
@@ -0,0 +1,1001 @@
+package local_repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/util"
+	"ozon-task/pkg/variables"
+	"ozon-task/services/posts/delivery/graph/model"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PostsLocalRepository keeps posts and comments in the memory of the
+// process, for tests and local development without Postgres or Redis. Maps
+// hold the records and ordered indexes serve the pages the way the indexes
+// of the relational store do, all behind one lock.
+type PostsLocalRepository struct {
+	mutex sync.RWMutex
+
+	posts         map[int]*storedPost
+	comments      map[int]*storedComment
+	nextPostId    int
+	nextCommentId int
+
+	// The feed indexes hold approved posts only, the thread and user
+	// indexes approved comments only.
+	feed          *orderedIndex
+	mostCommented *orderedIndex
+	trending      *orderedIndex
+	userPosts     map[int]*orderedIndex
+	userComments  map[int]*orderedIndex
+	postComments  map[int]*orderedIndex
+	replies       map[int]*orderedIndex
+
+	reactions map[targetKey]*targetReactions
+	reports   map[targetKey][]*report
+
+	queue       *orderedIndex
+	queued      map[targetKey]*queueEntry
+	entries     map[int]*queueEntry
+	nextEntryId int
+}
+
+type storedPost struct {
+	post       model.Post
+	id         int
+	userId     int
+	createdAt  time.Time
+	commentIds []int
+}
+
+type storedComment struct {
+	comment   model.Comment
+	id        int
+	postID    int
+	parentID  int
+	userId    int
+	createdAt time.Time
+}
+
+type targetKey struct {
+	target model.ReactionTarget
+	id     int
+}
+
+// targetReactions holds the counts of a target and the kinds every user
+// left on it, in the order they were left.
+type targetReactions struct {
+	counts map[model.ReactionKind]int
+	users  map[int][]model.ReactionKind
+}
+
+type report struct {
+	userId int
+	reason string
+}
+
+type queueEntry struct {
+	id       int
+	target   targetKey
+	queuedAt time.Time
+}
+
+func GetPostsRepository() *PostsLocalRepository {
+	return &PostsLocalRepository{
+		posts:         make(map[int]*storedPost),
+		comments:      make(map[int]*storedComment),
+		feed:          &orderedIndex{},
+		mostCommented: &orderedIndex{byScore: true},
+		trending:      &orderedIndex{byScore: true},
+		userPosts:     make(map[int]*orderedIndex),
+		userComments:  make(map[int]*orderedIndex),
+		postComments:  make(map[int]*orderedIndex),
+		replies:       make(map[int]*orderedIndex),
+		reactions:     make(map[targetKey]*targetReactions),
+		reports:       make(map[targetKey][]*report),
+		queue:         &orderedIndex{},
+		queued:        make(map[targetKey]*queueEntry),
+		entries:       make(map[int]*queueEntry),
+	}
+}
+
+// indexEntry places an id in an ordered index, by time or by score.
+type indexEntry struct {
+	id        int
+	createdAt time.Time
+	score     float64
+}
+
+// orderedIndex keeps its entries sorted by (createdAt, id), or by
+// (score, id) when byScore is set, so pages are ranges of it.
+type orderedIndex struct {
+	byScore bool
+	entries []indexEntry
+}
+
+func (index *orderedIndex) compare(left indexEntry, right indexEntry) int {
+	if index.byScore {
+		if left.score != right.score {
+			return cmp.Compare(left.score, right.score)
+		}
+	} else if order := left.createdAt.Compare(right.createdAt); order != 0 {
+		return order
+	}
+
+	return cmp.Compare(left.id, right.id)
+}
+
+// search returns the position of the first entry not before entry.
+func (index *orderedIndex) search(entry indexEntry) int {
+	return sort.Search(len(index.entries), func(i int) bool {
+		return index.compare(index.entries[i], entry) >= 0
+	})
+}
+
+func (index *orderedIndex) insert(entry indexEntry) {
+	index.entries = slices.Insert(index.entries, index.search(entry), entry)
+}
+
+// remove takes entry out, it must carry the time or score it was inserted
+// with.
+func (index *orderedIndex) remove(entry indexEntry) {
+	if index == nil {
+		return
+	}
+
+	position := index.search(entry)
+	if position < len(index.entries) && index.entries[position].id == entry.id {
+		index.entries = slices.Delete(index.entries, position, position+1)
+	}
+}
+
+func (index *orderedIndex) len() int {
+	if index == nil {
+		return 0
+	}
+	return len(index.entries)
+}
+
+// page returns up to first+1 ids that follow the cursor in the direction
+// of the page and pass keep, which may be nil.
+func (index *orderedIndex) page(first int, after *models.Cursor, descending bool, keep func(id int) bool) []int {
+	if index == nil {
+		return nil
+	}
+
+	position, step := 0, 1
+	if descending {
+		position, step = len(index.entries)-1, -1
+	}
+
+	if after != nil {
+		cursor := indexEntry{id: after.ID, createdAt: after.CreatedAt, score: after.Score}
+		position = index.search(cursor)
+		if descending {
+			position--
+		} else if position < len(index.entries) && index.compare(index.entries[position], cursor) == 0 {
+			position++
+		}
+	}
+
+	var ids []int
+	for ; position >= 0 && position < len(index.entries) && len(ids) <= first; position += step {
+		id := index.entries[position].id
+		if keep == nil || keep(id) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// indexOf returns the index under key, creating it if needed.
+func indexOf(indexes map[int]*orderedIndex, key int) *orderedIndex {
+	index, ok := indexes[key]
+	if !ok {
+		index = &orderedIndex{}
+		indexes[key] = index
+	}
+	return index
+}
+
+// now is truncated to microseconds like the timestamps of Postgres.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (stored *storedPost) timeEntry() indexEntry {
+	return indexEntry{id: stored.id, createdAt: stored.createdAt}
+}
+
+func (stored *storedPost) copy() *model.Post {
+	post := stored.post
+	return &post
+}
+
+func (stored *storedComment) timeEntry() indexEntry {
+	return indexEntry{id: stored.id, createdAt: stored.createdAt}
+}
+
+func (stored *storedComment) copy() *model.Comment {
+	comment := stored.comment
+	return &comment
+}
+
+// postIndex returns the index behind the feed order and whether the feed
+// reads it backwards.
+func (repository *PostsLocalRepository) postIndex(order model.PostOrder) (*orderedIndex, bool, bool) {
+	switch order {
+	case model.PostOrderNewest:
+		return repository.feed, true, true
+	case model.PostOrderOldest:
+		return repository.feed, false, true
+	case model.PostOrderMostCommented:
+		return repository.mostCommented, true, true
+	case model.PostOrderTrending:
+		return repository.trending, true, true
+	}
+	return nil, false, false
+}
+
+func (repository *PostsLocalRepository) addToFeeds(stored *storedPost) {
+	repository.feed.insert(stored.timeEntry())
+	repository.mostCommented.insert(indexEntry{id: stored.id, score: float64(stored.post.CommentsCount)})
+	repository.trending.insert(indexEntry{id: stored.id, score: stored.post.TrendingScore})
+	indexOf(repository.userPosts, stored.userId).insert(stored.timeEntry())
+}
+
+func (repository *PostsLocalRepository) removeFromFeeds(stored *storedPost) {
+	repository.feed.remove(stored.timeEntry())
+	repository.mostCommented.remove(indexEntry{id: stored.id, score: float64(stored.post.CommentsCount)})
+	repository.trending.remove(indexEntry{id: stored.id, score: stored.post.TrendingScore})
+	repository.userPosts[stored.userId].remove(stored.timeEntry())
+}
+
+// setCounters moves the comments count of the post by delta and folds an
+// activity of log-weight weight into its trending score, unless weight is
+// nil. An approved post is moved along in the feed indexes.
+func (repository *PostsLocalRepository) setCounters(stored *storedPost, delta int, weight *float64) {
+	approved := stored.post.ModerationStatus == model.ModerationStatusApproved
+	if approved {
+		repository.removeFromFeeds(stored)
+	}
+
+	stored.post.CommentsCount += delta
+	if weight != nil {
+		score := stored.post.TrendingScore
+		stored.post.TrendingScore = math.Max(score, *weight) + math.Log1p(math.Exp(-math.Abs(score-*weight)))
+	}
+
+	if approved {
+		repository.addToFeeds(stored)
+	}
+}
+
+// threadIndex is the index listing the comment under its parent.
+func (repository *PostsLocalRepository) threadIndex(stored *storedComment) *orderedIndex {
+	if stored.parentID != 0 {
+		return indexOf(repository.replies, stored.parentID)
+	}
+	return indexOf(repository.postComments, stored.postID)
+}
+
+// addToThread puts an approved comment into the thread and, while it is
+// live, into the user index and the counters of its post.
+func (repository *PostsLocalRepository) addToThread(stored *storedComment, weight float64) {
+	repository.threadIndex(stored).insert(stored.timeEntry())
+	if stored.comment.IsDeleted {
+		return
+	}
+
+	indexOf(repository.userComments, stored.userId).insert(stored.timeEntry())
+	post, ok := repository.posts[stored.postID]
+	if ok {
+		repository.setCounters(post, 1, &weight)
+	}
+}
+
+// removeFromThread is the reverse of addToThread, except that the trending
+// score keeps the weight of the comment.
+func (repository *PostsLocalRepository) removeFromThread(stored *storedComment) {
+	repository.threadIndex(stored).remove(stored.timeEntry())
+	if stored.comment.IsDeleted {
+		return
+	}
+
+	repository.userComments[stored.userId].remove(stored.timeEntry())
+	repository.uncount(stored)
+}
+
+// uncount takes a live comment out of the comments count of its post.
+func (repository *PostsLocalRepository) uncount(stored *storedComment) {
+	post, ok := repository.posts[stored.postID]
+	if ok {
+		repository.setCounters(post, -1, nil)
+	}
+}
+
+func (repository *PostsLocalRepository) enqueue(target targetKey, queuedAt time.Time) {
+	if _, ok := repository.queued[target]; ok {
+		return
+	}
+
+	repository.nextEntryId++
+	entry := &queueEntry{id: repository.nextEntryId, target: target, queuedAt: queuedAt}
+	repository.queued[target] = entry
+	repository.entries[entry.id] = entry
+	repository.queue.insert(indexEntry{id: entry.id, createdAt: queuedAt})
+}
+
+// dequeue takes the target off the moderation queue and drops its reports.
+func (repository *PostsLocalRepository) dequeue(target targetKey) {
+	entry, ok := repository.queued[target]
+	if ok {
+		repository.queue.remove(indexEntry{id: entry.id, createdAt: entry.queuedAt})
+		delete(repository.queued, target)
+		delete(repository.entries, entry.id)
+	}
+	delete(repository.reports, target)
+}
+
+// forget drops everything kept about the target besides its record.
+func (repository *PostsLocalRepository) forget(target targetKey) {
+	repository.dequeue(target)
+	delete(repository.reactions, target)
+}
+
+func (repository *PostsLocalRepository) GetPosts(ctx context.Context, first int, after *models.Cursor, order model.PostOrder) ([]*model.Post, bool, error) {
+	index, descending, ok := repository.postIndex(order)
+	if !ok {
+		return nil, false, fmt.Errorf(variables.InvalidPostOrder)
+	}
+
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	return repository.postsPage(index.page(first, after, descending, nil), first)
+}
+
+func (repository *PostsLocalRepository) postsPage(ids []int, first int) ([]*model.Post, bool, error) {
+	hasNextPage := len(ids) > first
+	if hasNextPage {
+		ids = ids[:first]
+	}
+
+	posts := make([]*model.Post, 0, len(ids))
+	for _, id := range ids {
+		posts = append(posts, repository.posts[id].copy())
+	}
+
+	return posts, hasNextPage, nil
+}
+
+func (repository *PostsLocalRepository) commentsPage(ids []int, first int) ([]*model.Comment, bool) {
+	hasNextPage := len(ids) > first
+	if hasNextPage {
+		ids = ids[:first]
+	}
+
+	comments := make([]*model.Comment, 0, len(ids))
+	for _, id := range ids {
+		comments = append(comments, repository.comments[id].copy())
+	}
+
+	return comments, hasNextPage
+}
+
+func (repository *PostsLocalRepository) GetPostByID(ctx context.Context, id int) (*model.Post, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	stored, ok := repository.posts[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return stored.copy(), nil
+}
+
+func (repository *PostsLocalRepository) GetCommentsByPostID(ctx context.Context, postID int, first int, after *models.Cursor, depth int) ([]*model.Comment, bool, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	comments, hasNextPage := repository.commentsPage(repository.postComments[postID].page(first, after, false, nil), first)
+
+	// Every level loads up to first+1 replies of each parent, the tree
+	// builder tells from the extra one that a next page exists.
+	children := make(map[string][]*model.Comment)
+	parents := comments
+	for level := 0; level < depth && len(parents) > 0; level++ {
+		var next []*model.Comment
+		for _, parent := range parents {
+			parentID, err := strconv.Atoi(parent.ID)
+			if err != nil {
+				return nil, false, err
+			}
+
+			for _, id := range repository.replies[parentID].page(first, nil, false, nil) {
+				reply := repository.comments[id].copy()
+				children[parent.ID] = append(children[parent.ID], reply)
+				next = append(next, reply)
+			}
+		}
+		parents = next
+	}
+
+	err := model.BuildCommentTree(comments, children, first, depth)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return comments, hasNextPage, nil
+}
+
+func (repository *PostsLocalRepository) GetReplies(ctx context.Context, postID int, parentID int, first int, after *models.Cursor) ([]*model.Comment, bool, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	parent, ok := repository.comments[parentID]
+	if !ok || parent.postID != postID {
+		return nil, false, nil
+	}
+
+	replies, hasNextPage := repository.commentsPage(repository.replies[parentID].page(first, after, false, nil), first)
+	return replies, hasNextPage, nil
+}
+
+func (repository *PostsLocalRepository) GetPostsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Post, bool, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	return repository.postsPage(repository.userPosts[userId].page(first, after, true, nil), first)
+}
+
+func (repository *PostsLocalRepository) GetCommentsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Comment, bool, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	comments, hasNextPage := repository.commentsPage(repository.userComments[userId].page(first, after, true, nil), first)
+	return comments, hasNextPage, nil
+}
+
+func (repository *PostsLocalRepository) GetUsersActivity(ctx context.Context, ids []int) (map[int]*models.UserActivity, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	activity := make(map[int]*models.UserActivity, len(ids))
+	for _, id := range ids {
+		activity[id] = &models.UserActivity{
+			PostCount:    repository.userPosts[id].len(),
+			CommentCount: repository.userComments[id].len(),
+		}
+	}
+
+	return activity, nil
+}
+
+func (repository *PostsLocalRepository) AddPost(ctx context.Context, data string, user *model.User, isCommented bool, status model.ModerationStatus) (*model.Post, error) {
+	userId, err := strconv.Atoi(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.nextPostId++
+	createdAt := now()
+	stored := &storedPost{
+		id:        repository.nextPostId,
+		userId:    userId,
+		createdAt: createdAt,
+		post: model.Post{
+			ID:               strconv.Itoa(repository.nextPostId),
+			Author:           &model.User{ID: user.ID},
+			Content:          data,
+			CreatedAt:        createdAt.Format(time.RFC3339Nano),
+			IsCommented:      &isCommented,
+			TrendingScore:    util.TrendingWeight(createdAt),
+			ModerationStatus: status,
+		},
+	}
+	repository.posts[stored.id] = stored
+
+	if status == model.ModerationStatusApproved {
+		repository.addToFeeds(stored)
+	} else {
+		repository.enqueue(targetKey{model.ReactionTargetPost, stored.id}, createdAt)
+	}
+
+	post := stored.copy()
+	post.Author = user
+	return post, nil
+}
+
+// AddComment counts an approved comment for its post right away, a pending
+// one only enters the moderation queue.
+func (repository *PostsLocalRepository) AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int, status model.ModerationStatus) (*model.Comment, error) {
+	postID, err := strconv.Atoi(post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := strconv.Atoi(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	commented, ok := repository.posts[postID]
+	if !ok {
+		return nil, fmt.Errorf(variables.PostNotFoundError)
+	}
+
+	repository.nextCommentId++
+	createdAt := now()
+	stored := &storedComment{
+		id:        repository.nextCommentId,
+		postID:    postID,
+		parentID:  parentID,
+		userId:    userId,
+		createdAt: createdAt,
+		comment: model.Comment{
+			ID:               strconv.Itoa(repository.nextCommentId),
+			Author:           &model.User{ID: user.ID},
+			Post:             &model.Post{ID: post.ID},
+			ParentID:         strconv.Itoa(parentID),
+			Content:          data,
+			CreatedAt:        createdAt.Format(time.RFC3339Nano),
+			ModerationStatus: status,
+		},
+	}
+	repository.comments[stored.id] = stored
+	commented.commentIds = append(commented.commentIds, stored.id)
+
+	if status == model.ModerationStatusApproved {
+		repository.addToThread(stored, util.TrendingWeight(createdAt))
+	} else {
+		repository.enqueue(targetKey{model.ReactionTargetComment, stored.id}, createdAt)
+	}
+
+	comment := stored.copy()
+	comment.Author = user
+	comment.Post = post
+	return comment, nil
+}
+
+func (repository *PostsLocalRepository) GetCommentByID(ctx context.Context, id int) (*model.Comment, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	stored, ok := repository.comments[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return stored.copy(), nil
+}
+
+func (repository *PostsLocalRepository) UpdatePost(ctx context.Context, id int, data string) (*model.Post, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, ok := repository.posts[id]
+	if !ok {
+		return nil, fmt.Errorf(variables.PostNotFoundError)
+	}
+
+	stored.post.Content = data
+	return stored.copy(), nil
+}
+
+func (repository *PostsLocalRepository) SetCommentsAllowed(ctx context.Context, id int, allowed bool, user *model.User) (*model.Post, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, ok := repository.posts[id]
+	if !ok {
+		return nil, fmt.Errorf(variables.PostNotFoundError)
+	}
+
+	toggledAt := now().Format(time.RFC3339Nano)
+	stored.post.IsCommented = &allowed
+	stored.post.CommentsToggledBy = &model.User{ID: user.ID}
+	stored.post.CommentsToggledAt = &toggledAt
+	return stored.copy(), nil
+}
+
+// DeletePost removes the post with its comments and everything left on
+// them: reactions, reports and moderation queue entries.
+func (repository *PostsLocalRepository) DeletePost(ctx context.Context, id int) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, ok := repository.posts[id]
+	if !ok {
+		return nil
+	}
+
+	for _, commentId := range stored.commentIds {
+		comment := repository.comments[commentId]
+		repository.userComments[comment.userId].remove(comment.timeEntry())
+		repository.forget(targetKey{model.ReactionTargetComment, commentId})
+		delete(repository.replies, commentId)
+		delete(repository.comments, commentId)
+	}
+
+	if stored.post.ModerationStatus == model.ModerationStatusApproved {
+		repository.removeFromFeeds(stored)
+	}
+	repository.forget(targetKey{model.ReactionTargetPost, id})
+	delete(repository.postComments, id)
+	delete(repository.posts, id)
+	return nil
+}
+
+func (repository *PostsLocalRepository) UpdateComment(ctx context.Context, id int, data string) (*model.Comment, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, ok := repository.comments[id]
+	if !ok {
+		return nil, fmt.Errorf(variables.CommentNotFoundError)
+	}
+
+	if stored.comment.IsDeleted {
+		return nil, fmt.Errorf(variables.CommentDeletedError)
+	}
+
+	stored.comment.Content = data
+	return stored.copy(), nil
+}
+
+// DeleteComment turns the comment into a tombstone that stays in the
+// thread, and takes it off the moderation queue.
+func (repository *PostsLocalRepository) DeleteComment(ctx context.Context, id int) (*model.Comment, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	stored, ok := repository.comments[id]
+	if !ok {
+		return nil, fmt.Errorf(variables.CommentNotFoundError)
+	}
+
+	if !stored.comment.IsDeleted && stored.comment.ModerationStatus == model.ModerationStatusApproved {
+		repository.uncount(stored)
+	}
+
+	stored.comment.Content = ""
+	stored.comment.IsDeleted = true
+	repository.userComments[stored.userId].remove(stored.timeEntry())
+	repository.dequeue(targetKey{model.ReactionTargetComment, id})
+	return stored.copy(), nil
+}
+
+// matchesAll tells if content has every one of tokens, like a conjunction
+// of words in a text search query.
+func matchesAll(content string, tokens []string) bool {
+	words := make(map[string]bool)
+	for _, word := range util.Tokenize(content) {
+		words[word] = true
+	}
+
+	for _, token := range tokens {
+		if !words[token] {
+			return false
+		}
+	}
+	return true
+}
+
+// rankedBefore orders search results by rank, then by id, both descending.
+func rankedBefore(leftRank float64, leftId int, rightRank float64, rightId int) bool {
+	if leftRank != rightRank {
+		return leftRank > rightRank
+	}
+	return leftId > rightId
+}
+
+// SearchPosts scans the approved posts, which is fine for the amounts of
+// content of tests and local development.
+func (repository *PostsLocalRepository) SearchPosts(ctx context.Context, search string, first int, after *models.Cursor) ([]*model.PostSearchEdge, bool, error) {
+	tokens := util.UniqueTokens(search)
+	if len(tokens) == 0 {
+		return nil, false, nil
+	}
+
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	type match struct {
+		id   int
+		rank float64
+	}
+
+	var matches []match
+	for _, entry := range repository.feed.entries {
+		content := repository.posts[entry.id].post.Content
+		if !matchesAll(content, tokens) {
+			continue
+		}
+
+		rank := util.SearchRank(content, tokens)
+		if after != nil && !rankedBefore(after.Score, after.ID, rank, entry.id) {
+			continue
+		}
+		matches = append(matches, match{id: entry.id, rank: rank})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return rankedBefore(matches[i].rank, matches[i].id, matches[j].rank, matches[j].id)
+	})
+
+	hasNextPage := len(matches) > first
+	if hasNextPage {
+		matches = matches[:first]
+	}
+
+	edges := make([]*model.PostSearchEdge, 0, len(matches))
+	for _, match := range matches {
+		post := repository.posts[match.id].copy()
+		edges = append(edges, &model.PostSearchEdge{
+			Node:    post,
+			Rank:    match.rank,
+			Snippet: util.Highlight(post.Content, tokens),
+		})
+	}
+
+	return edges, hasNextPage, nil
+}
+
+func (repository *PostsLocalRepository) SearchComments(ctx context.Context, postID int, search string, limit int) ([]*model.CommentSearchResult, error) {
+	tokens := util.UniqueTokens(search)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	post, ok := repository.posts[postID]
+	if !ok {
+		return nil, nil
+	}
+
+	var results []*model.CommentSearchResult
+	for _, id := range post.commentIds {
+		stored := repository.comments[id]
+		if stored.comment.IsDeleted || stored.comment.ModerationStatus != model.ModerationStatusApproved || !matchesAll(stored.comment.Content, tokens) {
+			continue
+		}
+
+		results = append(results, &model.CommentSearchResult{
+			Comment: stored.copy(),
+			Rank:    util.SearchRank(stored.comment.Content, tokens),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		left, _ := strconv.Atoi(results[i].Comment.ID)
+		right, _ := strconv.Atoi(results[j].Comment.ID)
+		return rankedBefore(results[i].Rank, left, results[j].Rank, right)
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	for _, result := range results {
+		result.Snippet = util.Highlight(result.Comment.Content, tokens)
+	}
+
+	return results, nil
+}
+
+func (reactions *targetReactions) countsCopy() map[model.ReactionKind]int {
+	counts := make(map[model.ReactionKind]int, len(reactions.counts))
+	for kind, count := range reactions.counts {
+		counts[kind] = count
+	}
+	return counts
+}
+
+func (repository *PostsLocalRepository) AddReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := targetKey{target, targetID}
+	reactions, ok := repository.reactions[key]
+	if !ok {
+		reactions = &targetReactions{counts: make(map[model.ReactionKind]int), users: make(map[int][]model.ReactionKind)}
+		repository.reactions[key] = reactions
+	}
+
+	if !slices.Contains(reactions.users[userId], kind) {
+		reactions.users[userId] = append(reactions.users[userId], kind)
+		reactions.counts[kind]++
+	}
+
+	return reactions.countsCopy(), nil
+}
+
+func (repository *PostsLocalRepository) RemoveReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	reactions, ok := repository.reactions[targetKey{target, targetID}]
+	if !ok {
+		return map[model.ReactionKind]int{}, nil
+	}
+
+	position := slices.Index(reactions.users[userId], kind)
+	if position >= 0 {
+		reactions.users[userId] = slices.Delete(reactions.users[userId], position, position+1)
+		if len(reactions.users[userId]) == 0 {
+			delete(reactions.users, userId)
+		}
+
+		reactions.counts[kind]--
+		if reactions.counts[kind] <= 0 {
+			delete(reactions.counts, kind)
+		}
+	}
+
+	return reactions.countsCopy(), nil
+}
+
+func (repository *PostsLocalRepository) GetReactionCounts(ctx context.Context, target model.ReactionTarget, ids []int) (map[int]map[model.ReactionKind]int, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	counts := make(map[int]map[model.ReactionKind]int)
+	for _, id := range ids {
+		reactions, ok := repository.reactions[targetKey{target, id}]
+		if ok && len(reactions.counts) > 0 {
+			counts[id] = reactions.countsCopy()
+		}
+	}
+
+	return counts, nil
+}
+
+func (repository *PostsLocalRepository) GetUserReactions(ctx context.Context, target model.ReactionTarget, ids []int, userId int) (map[int][]model.ReactionKind, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	userReactions := make(map[int][]model.ReactionKind)
+	for _, id := range ids {
+		reactions, ok := repository.reactions[targetKey{target, id}]
+		if ok && len(reactions.users[userId]) > 0 {
+			userReactions[id] = slices.Clone(reactions.users[userId])
+		}
+	}
+
+	return userReactions, nil
+}
+
+// SetModerationStatus approves or rejects the target and takes it off the
+// moderation queue together with its reports. Content entering the approved
+// ones is indexed, content leaving them is taken out of the indexes.
+func (repository *PostsLocalRepository) SetModerationStatus(ctx context.Context, target model.ReactionTarget, targetID int, status model.ModerationStatus) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	switch target {
+	case model.ReactionTargetPost:
+		stored, ok := repository.posts[targetID]
+		if !ok {
+			return fmt.Errorf(variables.PostNotFoundError)
+		}
+
+		previous := stored.post.ModerationStatus
+		if previous == model.ModerationStatusApproved {
+			repository.removeFromFeeds(stored)
+		}
+		stored.post.ModerationStatus = status
+		if status == model.ModerationStatusApproved {
+			repository.addToFeeds(stored)
+		}
+	case model.ReactionTargetComment:
+		stored, ok := repository.comments[targetID]
+		if !ok {
+			return fmt.Errorf(variables.CommentNotFoundError)
+		}
+
+		previous := stored.comment.ModerationStatus
+		stored.comment.ModerationStatus = status
+		if previous != model.ModerationStatusApproved && status == model.ModerationStatusApproved {
+			repository.addToThread(stored, util.TrendingWeight(stored.createdAt))
+		} else if previous == model.ModerationStatusApproved && status != model.ModerationStatusApproved {
+			repository.removeFromThread(stored)
+		}
+	default:
+		return fmt.Errorf(variables.InvalidReactionTarget)
+	}
+
+	repository.dequeue(targetKey{target, targetID})
+	return nil
+}
+
+// AddReport records the report of the user, a repeated one replaces the
+// reason, and puts the target on the moderation queue.
+func (repository *PostsLocalRepository) AddReport(ctx context.Context, target model.ReactionTarget, targetID int, userId int, reason string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	key := targetKey{target, targetID}
+	reported := false
+	for _, existing := range repository.reports[key] {
+		if existing.userId == userId {
+			existing.reason = reason
+			reported = true
+		}
+	}
+
+	if !reported {
+		repository.reports[key] = append(repository.reports[key], &report{userId: userId, reason: reason})
+	}
+
+	repository.enqueue(key, now())
+	return nil
+}
+
+// GetModerationQueue returns up to first items of the targets, oldest
+// first, with the reasons of their reports.
+func (repository *PostsLocalRepository) GetModerationQueue(ctx context.Context, targets []model.ReactionTarget, first int, after *models.Cursor) ([]*model.ModerationItem, bool, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	ids := repository.queue.page(first, after, false, func(id int) bool {
+		return slices.Contains(targets, repository.entries[id].target.target)
+	})
+
+	hasNextPage := len(ids) > first
+	if hasNextPage {
+		ids = ids[:first]
+	}
+
+	items := make([]*model.ModerationItem, 0, len(ids))
+	for _, id := range ids {
+		entry := repository.entries[id]
+		item := &model.ModerationItem{
+			ID:         strconv.Itoa(entry.id),
+			TargetType: entry.target.target,
+			QueuedAt:   entry.queuedAt.Format(time.RFC3339Nano),
+			Reasons:    make([]string, 0, len(repository.reports[entry.target])),
+		}
+
+		if entry.target.target == model.ReactionTargetPost {
+			stored, ok := repository.posts[entry.target.id]
+			if !ok {
+				continue
+			}
+			item.Post = stored.copy()
+			item.Status = stored.post.ModerationStatus
+		} else {
+			stored, ok := repository.comments[entry.target.id]
+			if !ok {
+				continue
+			}
+			item.Comment = stored.copy()
+			item.Status = stored.comment.ModerationStatus
+		}
+
+		for _, report := range repository.reports[entry.target] {
+			item.Reasons = append(item.Reasons, report.reason)
+		}
+		item.ReportCount = len(item.Reasons)
+		items = append(items, item)
+	}
+
+	return items, hasNextPage, nil
+}
@@ -0,0 +1,14 @@
+package local_repository_test
+
+import (
+	"ozon-task/services/posts/repository/conformance"
+	local_repository "ozon-task/services/posts/repository/local"
+	"ozon-task/services/posts/usecase"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) usecase.IRepository {
+		return local_repository.GetPostsRepository()
+	})
+}
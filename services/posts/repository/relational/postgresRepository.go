@@ -5,11 +5,14 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/posts/delivery/graph/model"
 	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/pgtype"
 	_ "github.com/jackc/pgx/stdlib"
 )
 
@@ -23,13 +26,13 @@ func GetPostsRepository(configDatabase *variables.RelationalDataBaseConfig, logg
 
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		logger.Error(variables.SqlOpenError+"%w", "repo", "err", err)
+		logger.Error(variables.SqlOpenError, "error", err.Error())
 		return nil, err
 	}
 
 	err = db.Ping()
 	if err != nil {
-		logger.Error(variables.SqlPingError+"%w", "repo", "err", err)
+		logger.Error(variables.SqlPingError, "error", err.Error())
 		return nil, err
 	}
 
@@ -63,117 +66,992 @@ func (repository *ProfileRelationalRepository) pingDb(timer uint32, logger *slog
 		}
 
 		retries++
-		logger.Error(variables.SqlPingError+"%w", "repo", "err", err)
+		logger.Error(variables.SqlPingError, "error", err.Error())
 		time.Sleep(time.Duration(timer) * time.Second)
 	}
 
-	logger.Error(variables.SqlMaxPingRetriesError, err)
+	logger.Error(variables.SqlMaxPingRetriesError, "error", err.Error())
 	return fmt.Errorf(fmt.Sprintf(variables.SqlMaxPingRetriesError+" %v", err))
 }
-func (repository *ProfileRelationalRepository) GetPosts(ctx context.Context, limit int, offset int) ([]*model.Post, error) {
-	query := "SELECT id, user_id, content, created_at, comments_allowed FROM posts LIMIT $1 OFFSET $2"
-	rows, err := repository.db.Query(query, limit, offset)
+
+const postColumns = "id, user_id, content, created_at, comments_allowed, comments_toggled_by, comments_toggled_at, comments_count, trending_score, moderation_status"
+
+// approved keeps pending and rejected content out of feeds, trees, search
+// and activity counts.
+const approved = "moderation_status = 'APPROVED'"
+
+func scanPost(row scanner, extra ...any) (*model.Post, error) {
+	var post model.Post
+	var userId int
+	var toggledBy sql.NullInt64
+	var toggledAt sql.NullString
+	dest := append([]any{&post.ID, &userId, &post.Content, &post.CreatedAt, &post.IsCommented, &toggledBy, &toggledAt, &post.CommentsCount, &post.TrendingScore, &post.ModerationStatus}, extra...)
+	err := row.Scan(dest...)
 	if err != nil {
 		return nil, err
 	}
+	post.Author = &model.User{ID: strconv.Itoa(userId)}
+	if toggledBy.Valid {
+		post.CommentsToggledBy = &model.User{ID: strconv.FormatInt(toggledBy.Int64, 10)}
+	}
+	if toggledAt.Valid {
+		post.CommentsToggledAt = &toggledAt.String
+	}
+	return &post, nil
+}
+
+// postOrders holds the ORDER BY of every feed order and the keyset
+// condition continuing it after a cursor. Each has a matching index.
+var postOrders = map[model.PostOrder]struct{ orderBy, after string }{
+	model.PostOrderNewest:        {"created_at DESC, id DESC", "(created_at, id) < ($2, $3)"},
+	model.PostOrderOldest:        {"created_at, id", "(created_at, id) > ($2, $3)"},
+	model.PostOrderMostCommented: {"comments_count DESC, id DESC", "(comments_count, id) < ($2, $3)"},
+	model.PostOrderTrending:      {"trending_score DESC, id DESC", "(trending_score, id) < ($2, $3)"},
+}
+
+func (repository *ProfileRelationalRepository) GetPosts(ctx context.Context, first int, after *models.Cursor, order model.PostOrder) ([]*model.Post, bool, error) {
+	postOrder, ok := postOrders[order]
+	if !ok {
+		return nil, false, fmt.Errorf(variables.InvalidPostOrder)
+	}
+
+	var rows *sql.Rows
+	var err error
+	if after == nil {
+		query := `SELECT ` + postColumns + ` FROM posts WHERE ` + approved + `
+			ORDER BY ` + postOrder.orderBy + ` LIMIT $1`
+		rows, err = repository.db.QueryContext(ctx, query, first+1)
+	} else {
+		var position any = after.CreatedAt
+		switch order {
+		case model.PostOrderMostCommented:
+			position = int(after.Score)
+		case model.PostOrderTrending:
+			position = after.Score
+		}
+
+		query := `SELECT ` + postColumns + ` FROM posts
+			WHERE ` + approved + ` AND ` + postOrder.after + `
+			ORDER BY ` + postOrder.orderBy + ` LIMIT $1`
+		rows, err = repository.db.QueryContext(ctx, query, first+1, position, after.ID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
 	defer rows.Close()
 
 	var posts []*model.Post
 	for rows.Next() {
-		var post model.Post
-		err := rows.Scan(&post.ID, &post.Content, &post.CreatedAt, &post.IsCommented)
+		post, err := scanPost(rows)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-		posts = append(posts, &post)
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(posts) > first
+	if hasNextPage {
+		posts = posts[:first]
 	}
 
-	return posts, nil
+	return posts, hasNextPage, nil
 }
 
 func (repository *ProfileRelationalRepository) GetPostByID(ctx context.Context, id int) (*model.Post, error) {
-	query := "SELECT id, user_id, content, created_at, comments_allowed FROM posts WHERE id = $1"
-	row := repository.db.QueryRow(query, id)
-
-	var post model.Post
-	var user model.User
-	var userId int
-	err := row.Scan(&post.ID, &userId, &post.Content, &post.CreatedAt, &post.IsCommented)
+	query := "SELECT " + postColumns + " FROM posts WHERE id = $1"
+	post, err := scanPost(repository.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
-	user.ID = strconv.Itoa(userId)
-	post.Author = &user
-	return &post, nil
+	return post, nil
 }
 
-func (repository *ProfileRelationalRepository) GetCommentsByPostID(ctx context.Context, postID int, limit int, offset int) ([]*model.Comment, error) {
-	query := "SELECT id, user_id, post_id, parent_id, content, created_at FROM comments WHERE post_id = $1 LIMIT $2 OFFSET $3"
-	rows, err := repository.db.Query(query, postID, limit, offset)
+// commentsTreeQuery selects a page of top-level comments, filtered by the
+// %s condition, followed by up to $2 approved replies per comment for $3
+// levels.
+const commentsTreeQuery = `WITH RECURSIVE tree AS (
+		(SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status, 0 AS depth FROM comments
+			WHERE %s
+			ORDER BY created_at, id LIMIT $2)
+		UNION ALL
+		SELECT reply.id, reply.user_id, reply.post_id, reply.parent_id, reply.content, reply.created_at, reply.deleted, reply.moderation_status, tree.depth + 1
+			FROM tree
+			CROSS JOIN LATERAL (
+				SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments
+					WHERE comments.post_id = tree.post_id AND comments.parent_id = tree.id AND comments.` + approved + `
+					ORDER BY created_at, id LIMIT $2
+			) reply
+			WHERE tree.depth < $3
+	)
+	SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status, depth FROM tree
+	ORDER BY depth, created_at, id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row scanner, extra ...any) (*model.Comment, error) {
+	var comment model.Comment
+	var user model.User
+	var post model.Post
+	var postId int
+	var userId int
+	// Top-level comments have no parent, the API shows them as parent 0.
+	var parentId sql.NullInt64
+	dest := append([]any{&comment.ID, &userId, &postId, &parentId, &comment.Content, &comment.CreatedAt, &comment.IsDeleted, &comment.ModerationStatus}, extra...)
+	err := row.Scan(dest...)
 	if err != nil {
 		return nil, err
 	}
+	comment.ParentID = strconv.FormatInt(parentId.Int64, 10)
+	user.ID = strconv.Itoa(userId)
+	post.ID = strconv.Itoa(postId)
+	comment.Author = &user
+	comment.Post = &post
+	return &comment, nil
+}
+
+func (repository *ProfileRelationalRepository) GetCommentsByPostID(ctx context.Context, postID int, first int, after *models.Cursor, depth int) ([]*model.Comment, bool, error) {
+	filter := "post_id = $1 AND parent_id IS NULL AND " + approved
+	args := []any{postID, first + 1, depth}
+	if after != nil {
+		filter += " AND (created_at, id) > ($4, $5)"
+		args = append(args, after.CreatedAt, after.ID)
+	}
+
+	rows, err := repository.db.QueryContext(ctx, fmt.Sprintf(commentsTreeQuery, filter), args...)
+	if err != nil {
+		return nil, false, err
+	}
 	defer rows.Close()
 
 	var comments []*model.Comment
+	children := make(map[string][]*model.Comment)
+	for rows.Next() {
+		var level int
+		comment, err := scanComment(rows, &level)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if level == 0 {
+			comments = append(comments, comment)
+		} else {
+			children[comment.ParentID] = append(children[comment.ParentID], comment)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(comments) > first
+	if hasNextPage {
+		comments = comments[:first]
+	}
+
+	err = model.BuildCommentTree(comments, children, first, depth)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return comments, hasNextPage, nil
+}
+
+func (repository *ProfileRelationalRepository) GetReplies(ctx context.Context, postID int, parentID int, first int, after *models.Cursor) ([]*model.Comment, bool, error) {
+	var rows *sql.Rows
+	var err error
+	if after == nil {
+		query := `SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments
+			WHERE post_id = $1 AND parent_id = $2 AND ` + approved + `
+			ORDER BY created_at, id LIMIT $3`
+		rows, err = repository.db.QueryContext(ctx, query, postID, parentID, first+1)
+	} else {
+		query := `SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments
+			WHERE post_id = $1 AND parent_id = $2 AND ` + approved + ` AND (created_at, id) > ($3, $4)
+			ORDER BY created_at, id LIMIT $5`
+		rows, err = repository.db.QueryContext(ctx, query, postID, parentID, after.CreatedAt, after.ID, first+1)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var replies []*model.Comment
+	for rows.Next() {
+		reply, err := scanComment(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		replies = append(replies, reply)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(replies) > first
+	if hasNextPage {
+		replies = replies[:first]
+	}
+
+	return replies, hasNextPage, nil
+}
+
+func (repository *ProfileRelationalRepository) GetPostsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Post, bool, error) {
+	var rows *sql.Rows
+	var err error
+	if after == nil {
+		query := `SELECT ` + postColumns + ` FROM posts WHERE user_id = $1 AND ` + approved + `
+			ORDER BY created_at DESC, id DESC LIMIT $2`
+		rows, err = repository.db.QueryContext(ctx, query, userId, first+1)
+	} else {
+		query := `SELECT ` + postColumns + ` FROM posts WHERE user_id = $1 AND ` + approved + ` AND (created_at, id) < ($2, $3)
+			ORDER BY created_at DESC, id DESC LIMIT $4`
+		rows, err = repository.db.QueryContext(ctx, query, userId, after.CreatedAt, after.ID, first+1)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var posts []*model.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(posts) > first
+	if hasNextPage {
+		posts = posts[:first]
+	}
+
+	return posts, hasNextPage, nil
+}
+
+func (repository *ProfileRelationalRepository) GetCommentsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Comment, bool, error) {
+	var rows *sql.Rows
+	var err error
+	if after == nil {
+		query := `SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments
+			WHERE user_id = $1 AND NOT deleted AND ` + approved + `
+			ORDER BY created_at DESC, id DESC LIMIT $2`
+		rows, err = repository.db.QueryContext(ctx, query, userId, first+1)
+	} else {
+		query := `SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments
+			WHERE user_id = $1 AND NOT deleted AND ` + approved + ` AND (created_at, id) < ($2, $3)
+			ORDER BY created_at DESC, id DESC LIMIT $4`
+		rows, err = repository.db.QueryContext(ctx, query, userId, after.CreatedAt, after.ID, first+1)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(comments) > first
+	if hasNextPage {
+		comments = comments[:first]
+	}
+
+	return comments, hasNextPage, nil
+}
+
+func (repository *ProfileRelationalRepository) GetUsersActivity(ctx context.Context, ids []int) (map[int]*models.UserActivity, error) {
+	userIds, err := idsArray(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT user_id,
+			(SELECT count(*) FROM posts WHERE posts.user_id = users.user_id AND posts.` + approved + `),
+			(SELECT count(*) FROM comments WHERE comments.user_id = users.user_id AND NOT deleted AND comments.` + approved + `)
+		FROM unnest($1::BIGINT[]) AS users(user_id)`
+	rows, err := repository.db.QueryContext(ctx, query, userIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := make(map[int]*models.UserActivity, len(ids))
 	for rows.Next() {
-		var comment model.Comment
-		var user model.User
-		var post model.Post
-		var postId int
 		var userId int
-		err := rows.Scan(&comment.ID, &userId, &postId, &comment.ParentID, &comment.Content, &comment.CreatedAt)
+		var userActivity models.UserActivity
+		err := rows.Scan(&userId, &userActivity.PostCount, &userActivity.CommentCount)
 		if err != nil {
 			return nil, err
 		}
-		user.ID = strconv.Itoa(userId)
-		post.ID = strconv.Itoa(postId)
-		comment.Author = &user
-		comment.Post = &post
-		comments = append(comments, &comment)
+		activity[userId] = &userActivity
 	}
 
-	return comments, nil
+	return activity, rows.Err()
 }
 
-func (repository *ProfileRelationalRepository) AddPost(ctx context.Context, data string, user *model.User, isCommented bool) (*model.Post, error) {
-	query := "INSERT INTO posts (user_id, content, created_at, comments_allowed) VALUES ($1, $2, $3, $4) RETURNING id"
+func (repository *ProfileRelationalRepository) AddPost(ctx context.Context, data string, user *model.User, isCommented bool, status model.ModerationStatus) (*model.Post, error) {
+	// A pending post enters the moderation queue in the same statement.
+	query := `WITH inserted AS (
+			INSERT INTO posts (user_id, content, created_at, comments_allowed, trending_score, moderation_status) VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at, moderation_status
+		), queued AS (
+			INSERT INTO moderation_queue (target_type, target_id, queued_at)
+			SELECT 'POST', id, created_at FROM inserted WHERE moderation_status = 'PENDING'
+		)
+		SELECT id, created_at FROM inserted`
 	var postID int
-	err := repository.db.QueryRow(query, user.ID, data, time.Now(), isCommented).Scan(&postID)
+	var createdAt string
+	now := time.Now().UTC()
+	trendingScore := util.TrendingWeight(now)
+	err := repository.db.QueryRowContext(ctx, query, user.ID, data, now, isCommented, trendingScore, string(status)).Scan(&postID, &createdAt)
 	if err != nil {
 		return nil, err
 	}
 
 	post := &model.Post{
-		ID:          strconv.Itoa(postID),
-		Content:     data,
-		CreatedAt:   time.Now().String(),
-		IsCommented: &isCommented,
+		ID:               strconv.Itoa(postID),
+		Author:           user,
+		Content:          data,
+		CreatedAt:        createdAt,
+		IsCommented:      &isCommented,
+		TrendingScore:    trendingScore,
+		ModerationStatus: status,
 	}
 
 	return post, nil
 }
 
-func (repository *ProfileRelationalRepository) AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int) (*model.Comment, error) {
-	query := "INSERT INTO comments (user_id, post_id, parent_id, content, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+// foldTrending adds an activity of log-weight weight to the trending score
+// of a post as ln(e^score + e^weight).
+func foldTrending(weight string) string {
+	return "GREATEST(trending_score, " + weight + ") + LN(1 + EXP(-ABS(trending_score - " + weight + ")))"
+}
+
+func (repository *ProfileRelationalRepository) AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int, status model.ModerationStatus) (*model.Comment, error) {
+	// The counters of the post are moved in the same statement. A pending
+	// comment only enters the moderation queue, it counts once approved.
+	query := `WITH inserted AS (
+			INSERT INTO comments (user_id, post_id, parent_id, content, created_at, moderation_status) VALUES ($1, $2, NULLIF($3::int, 0), $4, $5, $7)
+			RETURNING id, created_at, moderation_status
+		), counted AS (
+			UPDATE posts SET comments_count = comments_count + 1,
+				trending_score = ` + foldTrending("$6") + `
+			WHERE id = $2 AND EXISTS (SELECT 1 FROM inserted WHERE moderation_status = 'APPROVED')
+		), queued AS (
+			INSERT INTO moderation_queue (target_type, target_id, queued_at)
+			SELECT 'COMMENT', id, created_at FROM inserted WHERE moderation_status = 'PENDING'
+		)
+		SELECT id, created_at FROM inserted`
 	var commentID int
-	err := repository.db.QueryRow(query, user.ID, post.ID, parentID, data, time.Now()).Scan(&commentID)
+	var createdAt string
+	now := time.Now().UTC()
+	err := repository.db.QueryRowContext(ctx, query, user.ID, post.ID, parentID, data, now, util.TrendingWeight(now), string(status)).Scan(&commentID, &createdAt)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(user.ID, post.ID, parentID, data, commentID)
 
 	comment := &model.Comment{
-		ID:        strconv.Itoa(commentID),
-		ParentID:  strconv.Itoa(parentID),
-		Author:    user,
-		Post:      post,
-		Content:   data,
-		CreatedAt: time.Now().String(),
+		ID:               strconv.Itoa(commentID),
+		ParentID:         strconv.Itoa(parentID),
+		Author:           user,
+		Post:             post,
+		Content:          data,
+		CreatedAt:        createdAt,
+		ModerationStatus: status,
 	}
 
 	return comment, nil
 }
+
+func (repository *ProfileRelationalRepository) GetCommentByID(ctx context.Context, id int) (*model.Comment, error) {
+	query := "SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments WHERE id = $1"
+	comment, err := scanComment(repository.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (repository *ProfileRelationalRepository) UpdatePost(ctx context.Context, id int, data string) (*model.Post, error) {
+	query := "UPDATE posts SET content = $2 WHERE id = $1 RETURNING " + postColumns
+	return scanPost(repository.db.QueryRowContext(ctx, query, id, data))
+}
+
+func (repository *ProfileRelationalRepository) SetCommentsAllowed(ctx context.Context, id int, allowed bool, user *model.User) (*model.Post, error) {
+	query := `UPDATE posts SET comments_allowed = $2, comments_toggled_by = $3, comments_toggled_at = $4
+		WHERE id = $1 RETURNING ` + postColumns
+	return scanPost(repository.db.QueryRowContext(ctx, query, id, allowed, user.ID, time.Now().UTC()))
+}
+
+func (repository *ProfileRelationalRepository) DeletePost(ctx context.Context, id int) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	targets := `(target_type = 'POST' AND target_id = $1)
+		OR (target_type = 'COMMENT' AND target_id IN (SELECT id FROM comments WHERE post_id = $1))`
+	_, err = tx.ExecContext(ctx, "DELETE FROM reactions WHERE "+targets, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM reaction_counts WHERE "+targets, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM reports WHERE "+targets, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM moderation_queue WHERE "+targets, id)
+	if err != nil {
+		return err
+	}
+
+	// The comments go with the post, their foreign key cascades.
+	_, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *ProfileRelationalRepository) UpdateComment(ctx context.Context, id int, data string) (*model.Comment, error) {
+	query := `UPDATE comments SET content = $2 WHERE id = $1 AND NOT deleted
+		RETURNING id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status`
+	return scanComment(repository.db.QueryRowContext(ctx, query, id, data))
+}
+
+// DeleteComment also takes the comment off the moderation queue, there is
+// nothing left to review, and out of the comments count of its post. The
+// previous row is locked, so a repeated delete doesn't count it twice.
+func (repository *ProfileRelationalRepository) DeleteComment(ctx context.Context, id int) (*model.Comment, error) {
+	query := `WITH previous AS (
+			SELECT post_id, deleted, moderation_status FROM comments WHERE id = $1 FOR UPDATE
+		), deleted AS (
+			UPDATE comments SET content = '', deleted = true WHERE id = $1
+			RETURNING id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status
+		), uncounted AS (
+			UPDATE posts SET comments_count = comments_count - 1
+			WHERE id IN (SELECT post_id FROM previous WHERE NOT deleted AND moderation_status = 'APPROVED')
+		), dequeued AS (
+			DELETE FROM moderation_queue WHERE target_type = 'COMMENT' AND target_id = $1
+		), unreported AS (
+			DELETE FROM reports WHERE target_type = 'COMMENT' AND target_id = $1
+		)
+		SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM deleted`
+	return scanComment(repository.db.QueryRowContext(ctx, query, id))
+}
+
+// escapedContent is the content with the characters html.EscapeString
+// escapes, so the markup of a snippet is only the one searchHeadline adds.
+const escapedContent = `replace(replace(replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// searchHeadline marks the matched words of a search result and keeps a
+// couple of fragments around them.
+const searchHeadline = "ts_headline('simple', " + escapedContent + ", query, 'StartSel=<b>, StopSel=</b>, MaxFragments=2, MaxWords=35, MinWords=15')"
+
+func (repository *ProfileRelationalRepository) SearchPosts(ctx context.Context, search string, first int, after *models.Cursor) ([]*model.PostSearchEdge, bool, error) {
+	filter := ""
+	args := []any{search, first + 1}
+	if after != nil {
+		filter = "WHERE (rank, id) < ($3, $4)"
+		args = append(args, after.Score, after.ID)
+	}
+
+	query := `SELECT ` + postColumns + `, rank, ` + searchHeadline + ` FROM (
+			SELECT ` + postColumns + `, ts_rank(search_vector, query) AS rank, query
+				FROM posts, websearch_to_tsquery('simple', $1) query
+				WHERE search_vector @@ query AND ` + approved + `
+		) ranked ` + filter + `
+		ORDER BY rank DESC, id DESC LIMIT $2`
+	rows, err := repository.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var edges []*model.PostSearchEdge
+	for rows.Next() {
+		var edge model.PostSearchEdge
+		edge.Node, err = scanPost(rows, &edge.Rank, &edge.Snippet)
+		if err != nil {
+			return nil, false, err
+		}
+		edges = append(edges, &edge)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(edges) > first
+	if hasNextPage {
+		edges = edges[:first]
+	}
+
+	return edges, hasNextPage, nil
+}
+
+func (repository *ProfileRelationalRepository) SearchComments(ctx context.Context, postID int, search string, limit int) ([]*model.CommentSearchResult, error) {
+	query := `SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status, rank, ` + searchHeadline + ` FROM (
+			SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status, ts_rank(search_vector, query) AS rank, query
+				FROM comments, websearch_to_tsquery('simple', $2) query
+				WHERE post_id = $1 AND NOT deleted AND ` + approved + ` AND search_vector @@ query
+		) ranked
+		ORDER BY rank DESC, id DESC LIMIT $3`
+	rows, err := repository.db.QueryContext(ctx, query, postID, search, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*model.CommentSearchResult
+	for rows.Next() {
+		var result model.CommentSearchResult
+		result.Comment, err = scanComment(rows, &result.Rank, &result.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// changeReaction records or withdraws a reaction of the user. The counter
+// in reaction_counts only moves when the reactions row actually changed, and
+// its row lock serializes concurrent writers of the same target and kind.
+func (repository *ProfileRelationalRepository) changeReaction(ctx context.Context, change string, counter string, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, change, string(target), targetID, userId, string(kind))
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if changed > 0 {
+		_, err = tx.ExecContext(ctx, counter, string(target), targetID, string(kind))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT kind, count FROM reaction_counts WHERE target_type = $1 AND target_id = $2", string(target), targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[model.ReactionKind]int)
+	for rows.Next() {
+		var reactionKind model.ReactionKind
+		var count int
+		err := rows.Scan(&reactionKind, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[reactionKind] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, tx.Commit()
+}
+
+func (repository *ProfileRelationalRepository) AddReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	change := `INSERT INTO reactions (target_type, target_id, user_id, kind) VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+	counter := `INSERT INTO reaction_counts (target_type, target_id, kind, count) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (target_type, target_id, kind) DO UPDATE SET count = reaction_counts.count + 1`
+	return repository.changeReaction(ctx, change, counter, target, targetID, userId, kind)
+}
+
+func (repository *ProfileRelationalRepository) RemoveReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error) {
+	change := "DELETE FROM reactions WHERE target_type = $1 AND target_id = $2 AND user_id = $3 AND kind = $4"
+	counter := `UPDATE reaction_counts SET count = count - 1
+		WHERE target_type = $1 AND target_id = $2 AND kind = $3`
+	return repository.changeReaction(ctx, change, counter, target, targetID, userId, kind)
+}
+
+func idsArray(ids []int) (*pgtype.Int8Array, error) {
+	values := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, int64(id))
+	}
+
+	array := &pgtype.Int8Array{}
+	err := array.Set(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return array, nil
+}
+
+func (repository *ProfileRelationalRepository) GetReactionCounts(ctx context.Context, target model.ReactionTarget, ids []int) (map[int]map[model.ReactionKind]int, error) {
+	targetIds, err := idsArray(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT target_id, kind, count FROM reaction_counts WHERE target_type = $1 AND target_id = ANY($2) AND count > 0"
+	rows, err := repository.db.QueryContext(ctx, query, string(target), targetIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]map[model.ReactionKind]int)
+	for rows.Next() {
+		var targetID int
+		var kind model.ReactionKind
+		var count int
+		err := rows.Scan(&targetID, &kind, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		if counts[targetID] == nil {
+			counts[targetID] = make(map[model.ReactionKind]int)
+		}
+		counts[targetID][kind] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (repository *ProfileRelationalRepository) GetUserReactions(ctx context.Context, target model.ReactionTarget, ids []int, userId int) (map[int][]model.ReactionKind, error) {
+	targetIds, err := idsArray(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT target_id, kind FROM reactions
+		WHERE target_type = $1 AND target_id = ANY($2) AND user_id = $3
+		ORDER BY created_at`
+	rows, err := repository.db.QueryContext(ctx, query, string(target), targetIds, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := make(map[int][]model.ReactionKind)
+	for rows.Next() {
+		var targetID int
+		var kind model.ReactionKind
+		err := rows.Scan(&targetID, &kind)
+		if err != nil {
+			return nil, err
+		}
+		reactions[targetID] = append(reactions[targetID], kind)
+	}
+
+	return reactions, rows.Err()
+}
+
+// SetModerationStatus approves or rejects the target and takes it off the
+// moderation queue together with its reports. The comments counter of the
+// post follows the comments entering or leaving the approved ones.
+func (repository *ProfileRelationalRepository) SetModerationStatus(ctx context.Context, target model.ReactionTarget, targetID int, status model.ModerationStatus) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch target {
+	case model.ReactionTargetPost:
+		result, err := tx.ExecContext(ctx, "UPDATE posts SET moderation_status = $2 WHERE id = $1", targetID, string(status))
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if updated == 0 {
+			return fmt.Errorf(variables.PostNotFoundError)
+		}
+	case model.ReactionTargetComment:
+		var previous model.ModerationStatus
+		var postID int
+		var createdAt time.Time
+		var deleted bool
+		err = tx.QueryRowContext(ctx, "SELECT moderation_status, post_id, created_at, deleted FROM comments WHERE id = $1 FOR UPDATE", targetID).Scan(&previous, &postID, &createdAt, &deleted)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf(variables.CommentNotFoundError)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE comments SET moderation_status = $2 WHERE id = $1", targetID, string(status))
+		if err != nil {
+			return err
+		}
+
+		// Deleted comments are out of the counters already.
+		if deleted {
+			break
+		}
+
+		if previous != model.ModerationStatusApproved && status == model.ModerationStatusApproved {
+			query := `UPDATE posts SET comments_count = comments_count + 1, trending_score = ` + foldTrending("$2") + `
+				WHERE id = $1`
+			_, err = tx.ExecContext(ctx, query, postID, util.TrendingWeight(createdAt))
+		} else if previous == model.ModerationStatusApproved && status != model.ModerationStatusApproved {
+			_, err = tx.ExecContext(ctx, "UPDATE posts SET comments_count = comments_count - 1 WHERE id = $1", postID)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf(variables.InvalidReactionTarget)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM moderation_queue WHERE target_type = $1 AND target_id = $2", string(target), targetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM reports WHERE target_type = $1 AND target_id = $2", string(target), targetID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddReport records the report of the user, a repeated one replaces the
+// reason, and puts the target on the moderation queue.
+func (repository *ProfileRelationalRepository) AddReport(ctx context.Context, target model.ReactionTarget, targetID int, userId int, reason string) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `INSERT INTO reports (target_type, target_id, user_id, reason, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (target_type, target_id, user_id) DO UPDATE SET reason = EXCLUDED.reason`, string(target), targetID, userId, reason, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO moderation_queue (target_type, target_id, queued_at) VALUES ($1, $2, $3)
+		ON CONFLICT (target_type, target_id) DO NOTHING`, string(target), targetID, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetModerationQueue returns up to first items of the targets, oldest
+// first, with the reasons of their reports.
+func (repository *ProfileRelationalRepository) GetModerationQueue(ctx context.Context, targets []model.ReactionTarget, first int, after *models.Cursor) ([]*model.ModerationItem, bool, error) {
+	targetTypes := make([]string, 0, len(targets))
+	for _, target := range targets {
+		targetTypes = append(targetTypes, string(target))
+	}
+
+	typesArray := &pgtype.TextArray{}
+	err := typesArray.Set(targetTypes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	filter := "queue.target_type = ANY($1)"
+	args := []any{typesArray, first + 1}
+	if after != nil {
+		filter += " AND (queue.queued_at, queue.id) > ($3, $4)"
+		args = append(args, after.CreatedAt, after.ID)
+	}
+
+	query := `SELECT queue.id, queue.target_type, queue.target_id, queue.queued_at,
+			COALESCE(array_agg(reports.reason ORDER BY reports.created_at) FILTER (WHERE reports.user_id IS NOT NULL), '{}')
+		FROM moderation_queue queue
+		LEFT JOIN reports ON reports.target_type = queue.target_type AND reports.target_id = queue.target_id
+		WHERE ` + filter + `
+		GROUP BY queue.id
+		ORDER BY queue.queued_at, queue.id LIMIT $2`
+	rows, err := repository.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var items []*model.ModerationItem
+	targetIds := make(map[model.ReactionTarget][]int)
+	for rows.Next() {
+		var item model.ModerationItem
+		var targetID int
+		var reasons pgtype.TextArray
+		err := rows.Scan(&item.ID, &item.TargetType, &targetID, &item.QueuedAt, &reasons)
+		if err != nil {
+			return nil, false, err
+		}
+
+		err = reasons.AssignTo(&item.Reasons)
+		if err != nil {
+			return nil, false, err
+		}
+		item.ReportCount = len(item.Reasons)
+
+		// The target id is kept in the node until it is loaded.
+		if item.TargetType == model.ReactionTargetPost {
+			item.Post = &model.Post{ID: strconv.Itoa(targetID)}
+		} else {
+			item.Comment = &model.Comment{ID: strconv.Itoa(targetID)}
+		}
+		targetIds[item.TargetType] = append(targetIds[item.TargetType], targetID)
+		items = append(items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasNextPage := len(items) > first
+	if hasNextPage {
+		items = items[:first]
+	}
+
+	posts, err := repository.getPostsByIds(ctx, targetIds[model.ReactionTargetPost])
+	if err != nil {
+		return nil, false, err
+	}
+
+	comments, err := repository.getCommentsByIds(ctx, targetIds[model.ReactionTargetComment])
+	if err != nil {
+		return nil, false, err
+	}
+
+	loaded := make([]*model.ModerationItem, 0, len(items))
+	for _, item := range items {
+		if item.Post != nil {
+			item.Post = posts[item.Post.ID]
+			if item.Post == nil {
+				continue
+			}
+			item.Status = item.Post.ModerationStatus
+		} else {
+			item.Comment = comments[item.Comment.ID]
+			if item.Comment == nil {
+				continue
+			}
+			item.Status = item.Comment.ModerationStatus
+		}
+		loaded = append(loaded, item)
+	}
+
+	return loaded, hasNextPage, nil
+}
+
+func (repository *ProfileRelationalRepository) getPostsByIds(ctx context.Context, ids []int) (map[string]*model.Post, error) {
+	posts := make(map[string]*model.Post, len(ids))
+	if len(ids) == 0 {
+		return posts, nil
+	}
+
+	postIds, err := idsArray(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repository.db.QueryContext(ctx, "SELECT "+postColumns+" FROM posts WHERE id = ANY($1)", postIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts[post.ID] = post
+	}
+
+	return posts, rows.Err()
+}
+
+func (repository *ProfileRelationalRepository) getCommentsByIds(ctx context.Context, ids []int) (map[string]*model.Comment, error) {
+	comments := make(map[string]*model.Comment, len(ids))
+	if len(ids) == 0 {
+		return comments, nil
+	}
+
+	commentIds, err := idsArray(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, user_id, post_id, parent_id, content, created_at, deleted, moderation_status FROM comments WHERE id = ANY($1)"
+	rows, err := repository.db.QueryContext(ctx, query, commentIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments[comment.ID] = comment
+	}
+
+	return comments, rows.Err()
+}
@@ -0,0 +1,21 @@
+package relational_repository_test
+
+import (
+	"ozon-task/services/posts/repository/conformance"
+	relational_repository "ozon-task/services/posts/repository/relational"
+	"ozon-task/services/posts/usecase"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	config := conformance.PostgresConfig(t)
+	repository, err := relational_repository.GetPostsRepository(config, conformance.Logger())
+	if err != nil {
+		t.Fatalf("GetPostsRepository: %v", err)
+	}
+
+	conformance.Run(t, func(t *testing.T) usecase.IRepository {
+		conformance.ResetPostgres(t, config)
+		return repository
+	})
+}
@@ -4,33 +4,91 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"ozon-task/pkg/models"
+	"ozon-task/pkg/ratelimit"
+	"ozon-task/pkg/serviceauth"
+	"ozon-task/pkg/tokens"
+	"ozon-task/pkg/util"
 	"ozon-task/pkg/variables"
 	"ozon-task/services/authorization/proto/authorization"
+	"ozon-task/services/posts/broker"
 	"ozon-task/services/posts/delivery/graph/model"
+	cached_repository "ozon-task/services/posts/repository/cached"
 	inmemory_repository "ozon-task/services/posts/repository/inMemory"
+	local_repository "ozon-task/services/posts/repository/local"
 	relational_repository "ozon-task/services/posts/repository/relational"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type IRepository interface {
-	GetPosts(ctx context.Context, limit int, offset int) ([]*model.Post, error)
+	GetPosts(ctx context.Context, first int, after *models.Cursor, order model.PostOrder) ([]*model.Post, bool, error)
 	GetPostByID(ctx context.Context, id int) (*model.Post, error)
-	GetCommentsByPostID(ctx context.Context, postID int, limit int, offset int) ([]*model.Comment, error)
-	AddPost(ctx context.Context, data string, user *model.User, isCommented bool) (*model.Post, error)
-	AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int) (*model.Comment, error)
+	GetCommentsByPostID(ctx context.Context, postID int, first int, after *models.Cursor, depth int) ([]*model.Comment, bool, error)
+	GetReplies(ctx context.Context, postID int, parentID int, first int, after *models.Cursor) ([]*model.Comment, bool, error)
+	AddPost(ctx context.Context, data string, user *model.User, isCommented bool, status model.ModerationStatus) (*model.Post, error)
+	AddComment(ctx context.Context, post *model.Post, user *model.User, data string, parentID int, status model.ModerationStatus) (*model.Comment, error)
+	GetCommentByID(ctx context.Context, id int) (*model.Comment, error)
+	UpdatePost(ctx context.Context, id int, data string) (*model.Post, error)
+	DeletePost(ctx context.Context, id int) error
+	SetCommentsAllowed(ctx context.Context, id int, allowed bool, user *model.User) (*model.Post, error)
+	UpdateComment(ctx context.Context, id int, data string) (*model.Comment, error)
+	DeleteComment(ctx context.Context, id int) (*model.Comment, error)
+	SearchPosts(ctx context.Context, query string, first int, after *models.Cursor) ([]*model.PostSearchEdge, bool, error)
+	SearchComments(ctx context.Context, postID int, query string, limit int) ([]*model.CommentSearchResult, error)
+	GetPostsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Post, bool, error)
+	GetCommentsByUser(ctx context.Context, userId int, first int, after *models.Cursor) ([]*model.Comment, bool, error)
+	GetUsersActivity(ctx context.Context, ids []int) (map[int]*models.UserActivity, error)
+	AddReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error)
+	RemoveReaction(ctx context.Context, target model.ReactionTarget, targetID int, userId int, kind model.ReactionKind) (map[model.ReactionKind]int, error)
+	GetReactionCounts(ctx context.Context, target model.ReactionTarget, ids []int) (map[int]map[model.ReactionKind]int, error)
+	GetUserReactions(ctx context.Context, target model.ReactionTarget, ids []int, userId int) (map[int][]model.ReactionKind, error)
+	SetModerationStatus(ctx context.Context, target model.ReactionTarget, targetID int, status model.ModerationStatus) error
+	AddReport(ctx context.Context, target model.ReactionTarget, targetID int, userId int, reason string) error
+	GetModerationQueue(ctx context.Context, targets []model.ReactionTarget, first int, after *models.Cursor) ([]*model.ModerationItem, bool, error)
+}
+
+type ICommentsBroker interface {
+	Publish(ctx context.Context, postID int, comment *model.Comment) error
+	Subscribe(ctx context.Context, postID int) <-chan *model.Comment
 }
 
 type Core struct {
 	postsRepository IRepository
+	commentsBroker  ICommentsBroker
 	logger          *slog.Logger
 	client          authorization.AuthorizationClient
+	tokens          *tokens.Manager
+	moderation      variables.ModerationConfig
+	limiter         *ratelimit.Limiter
+
+	permissionsMutex sync.Mutex
+	permissions      map[int64]cachedPermissions
 }
 
-func GetClient(address string) (authorization.AuthorizationClient, error) {
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// cachedPermissions keeps the permissions of a user for a short time, so
+// checking them does not cost a gRPC call on every mutation.
+type cachedPermissions struct {
+	permissions map[string]bool
+	expiresAt   time.Time
+}
+
+// GetClient connects to the authorization service, every call carries the
+// service secret.
+func GetClient(address string, secret string) (authorization.AuthorizationClient, error) {
+	err := serviceauth.CheckSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(serviceauth.ClientInterceptor(secret)))
 	if err != nil {
 		return nil, fmt.Errorf("grpc connect err: %w", err)
 	}
@@ -39,11 +97,17 @@ func GetClient(address string) (authorization.AuthorizationClient, error) {
 	return client, nil
 }
 
-func GetCore(postsRelConfig *variables.RelationalDataBaseConfig, postsCacheConfig *variables.CacheDataBaseConfig, grpcCfg *variables.GrpcConfig, inMemory bool, logger *slog.Logger) (*Core, error) {
+func GetCore(postsRelConfig *variables.RelationalDataBaseConfig, postsCacheConfig *variables.CacheDataBaseConfig, grpcCfg *variables.GrpcConfig, appConfig *variables.AppConfig, logger *slog.Logger) (*Core, error) {
+	inMemory := appConfig.InMemory
+
 	var repository IRepository
 	var err error
-	if inMemory {
-		repository, err = inmemory_repository.GetPostsRepository(postsCacheConfig, logger)
+	if appConfig.InProcess {
+		repository = local_repository.GetPostsRepository()
+	} else if inMemory {
+		repository, err = inmemory_repository.GetPostsRepository(postsCacheConfig, appConfig.InMemoryTTL, logger)
+	} else if appConfig.Cache.Enabled {
+		repository, err = cached_repository.GetPostsRepository(postsRelConfig, postsCacheConfig, &appConfig.Cache, logger)
 	} else {
 		repository, err = relational_repository.GetPostsRepository(postsRelConfig, logger)
 	}
@@ -52,46 +116,226 @@ func GetCore(postsRelConfig *variables.RelationalDataBaseConfig, postsCacheConfi
 		return nil, fmt.Errorf(fmt.Sprintf("Repository can't create %v", err))
 	}
 
-	postsGrpcClient, err := GetClient(grpcCfg.Address + ":" + grpcCfg.Port)
+	// Replicas sharing Redis share the comments broker too, so subscribers
+	// see comments written on any of them.
+	usesRedis := !appConfig.InProcess && (inMemory || appConfig.Cache.Enabled)
+	var commentsBroker ICommentsBroker
+	if usesRedis {
+		commentsBroker, err = broker.GetRedisCommentsBroker(postsCacheConfig, logger)
+	} else {
+		commentsBroker = broker.GetCommentsBroker(logger)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("comments broker can't create: %w", err)
+	}
+
+	postsGrpcClient, err := GetClient(grpcCfg.Address+":"+grpcCfg.Port, grpcCfg.Secret)
 
 	if err != nil {
 		return nil, fmt.Errorf("grpc connect err: %w", err)
 	}
 
+	tokenManager, err := tokens.GetManager(&appConfig.Token)
+	if err != nil {
+		return nil, fmt.Errorf(variables.TokenConfigError+": %w", err)
+	}
+
+	// The in-process mode runs without Redis, so without rate limits.
+	var limiter *ratelimit.Limiter
+	if !appConfig.InProcess {
+		limiter, err = ratelimit.GetLimiter(postsCacheConfig, &appConfig.RateLimit)
+		if err != nil {
+			return nil, fmt.Errorf(variables.RateLimitError+": %w", err)
+		}
+	}
+
 	return &Core{
 		postsRepository: repository,
+		commentsBroker:  commentsBroker,
 		logger:          logger,
 		client:          postsGrpcClient,
+		tokens:          tokenManager,
+		moderation:      appConfig.Moderation,
+		limiter:         limiter,
+		permissions:     map[int64]cachedPermissions{},
 	}, nil
 }
 
-func (core *Core) GetPosts(ctx context.Context, limit int, offset int) ([]*model.Post, error) {
-	posts, err := core.postsRepository.GetPosts(ctx, limit, offset)
+func (core *Core) GetPosts(ctx context.Context, first int, after string, order model.PostOrder) (*model.PostConnection, error) {
+	if !order.IsValid() {
+		return nil, fmt.Errorf(variables.InvalidPostOrder)
+	}
+
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, hasNextPage, err := core.postsRepository.GetPosts(ctx, first, cursor, order)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
 	}
-	return posts, nil
+
+	return model.NewPostConnection(posts, hasNextPage, order)
 }
 
-func (core *Core) GetPostByID(ctx context.Context, id int, limit int, offset int) (*model.Post, error) {
+// GetPostByID shows a pending or rejected post only to its author and to
+// moderators, viewerId is zero for guests.
+func (core *Core) GetPostByID(ctx context.Context, id int, viewerId int) (*model.Post, error) {
 	post, err := core.postsRepository.GetPostByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
 	}
+
+	if post == nil || post.ModerationStatus == model.ModerationStatusApproved {
+		return post, nil
+	}
+
+	if viewerId == 0 {
+		return nil, nil
+	}
+
+	if post.Author != nil && post.Author.ID == strconv.Itoa(viewerId) {
+		return post, nil
+	}
+
+	visible, err := core.HasPermission(ctx, int64(viewerId), variables.PermissionPostModerate)
+	if err != nil {
+		return nil, err
+	}
+
+	if !visible {
+		return nil, nil
+	}
 	return post, nil
 }
 
-func (core *Core) GetCommentsByPostID(ctx context.Context, postID int, limit int, offset int) ([]*model.Comment, error) {
-	comments, err := core.postsRepository.GetCommentsByPostID(ctx, postID, limit, offset)
+func (core *Core) GetCommentsByPostID(ctx context.Context, postID int, first int, after string, depth int) (*model.CommentConnection, error) {
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, hasNextPage, err := core.postsRepository.GetCommentsByPostID(ctx, postID, first, cursor, depth)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Comments Not Founded %v", err))
+	}
+
+	return model.NewCommentConnection(comments, hasNextPage)
+}
+
+func (core *Core) GetReplies(ctx context.Context, comment *model.Comment, first int, after string) (*model.CommentConnection, error) {
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	postID, err := strconv.Atoi(comment.Post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	parentID, err := strconv.Atoi(comment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, hasNextPage, err := core.postsRepository.GetReplies(ctx, postID, parentID, first, cursor)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Comments Not Founded %v", err))
+	}
+
+	return model.NewCommentConnection(replies, hasNextPage)
+}
+
+func (core *Core) GetUserPosts(ctx context.Context, userId int, first int, after string) (*model.PostConnection, error) {
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, hasNextPage, err := core.postsRepository.GetPostsByUser(ctx, userId, first, cursor)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
+	}
+
+	return model.NewPostConnection(posts, hasNextPage, model.PostOrderNewest)
+}
+
+func (core *Core) GetUserComments(ctx context.Context, userId int, first int, after string) (*model.CommentConnection, error) {
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, hasNextPage, err := core.postsRepository.GetCommentsByUser(ctx, userId, first, cursor)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Comments Not Founded %v", err))
 	}
-	return comments, nil
+
+	return model.NewCommentConnection(comments, hasNextPage)
+}
+
+// GetUsersActivity counts the posts and live comments of every user, users
+// without any get zero counts.
+func (core *Core) GetUsersActivity(ctx context.Context, ids []int64) (map[int64]*models.UserActivity, error) {
+	userIds := make([]int, 0, len(ids))
+	for _, id := range ids {
+		userIds = append(userIds, int(id))
+	}
+
+	activity, err := core.postsRepository.GetUsersActivity(ctx, userIds)
+	if err != nil {
+		return nil, fmt.Errorf(variables.UserActivityError+": %w", err)
+	}
+
+	usersActivity := make(map[int64]*models.UserActivity, len(ids))
+	for _, id := range ids {
+		usersActivity[id] = activity[int(id)]
+		if usersActivity[id] == nil {
+			usersActivity[id] = &models.UserActivity{}
+		}
+	}
+	return usersActivity, nil
+}
+
+// initialStatus approves content of trusted users and of moderators right
+// away, with premoderation on the rest waits in the moderation queue.
+func (core *Core) initialStatus(ctx context.Context, userId int, moderatePermission string) (model.ModerationStatus, error) {
+	if !core.moderation.Premoderation {
+		return model.ModerationStatusApproved, nil
+	}
+
+	isModerator, err := core.HasPermission(ctx, int64(userId), moderatePermission)
+	if err != nil {
+		return "", err
+	}
+
+	if isModerator {
+		return model.ModerationStatusApproved, nil
+	}
+
+	activity, err := core.postsRepository.GetUsersActivity(ctx, []int{userId})
+	if err != nil {
+		return "", fmt.Errorf(variables.UserActivityError+": %w", err)
+	}
+
+	if userActivity := activity[userId]; userActivity != nil &&
+		userActivity.PostCount+userActivity.CommentCount >= core.moderation.TrustedContentCount {
+		return model.ModerationStatusApproved, nil
+	}
+	return model.ModerationStatusPending, nil
 }
 
 func (core *Core) AddPost(ctx context.Context, data string, userId int, isCommented bool) (*model.Post, error) {
+	status, err := core.initialStatus(ctx, userId, variables.PermissionPostModerate)
+	if err != nil {
+		return nil, err
+	}
+
 	user := model.User{ID: strconv.Itoa(userId)}
-	post, err := core.postsRepository.AddPost(ctx, data, &user, isCommented)
+	post, err := core.postsRepository.AddPost(ctx, data, &user, isCommented, status)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
 	}
@@ -99,23 +343,490 @@ func (core *Core) AddPost(ctx context.Context, data string, userId int, isCommen
 }
 
 func (core *Core) AddComment(ctx context.Context, postID int, userId int, data string, parentID int) (*model.Comment, error) {
-	post, err := core.postsRepository.GetPostByID(ctx, postID)
+	post, err := core.getApprovedPost(ctx, postID)
 	user := model.User{ID: strconv.Itoa(userId)}
 	if err != nil {
-		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
+		return nil, err
 	}
 
-	if !*post.IsCommented {
+	if post.IsCommented != nil && !*post.IsCommented {
 		return nil, fmt.Errorf("Post can't be commented")
 	}
 
-	comment, err := core.postsRepository.AddComment(ctx, post, &user, data, parentID)
+	if parentID != 0 {
+		parent, err := core.getComment(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent.Post == nil || parent.Post.ID != post.ID {
+			return nil, fmt.Errorf(variables.ParentCommentError)
+		}
+
+		if parent.ModerationStatus != model.ModerationStatusApproved {
+			return nil, fmt.Errorf(variables.CommentNotFoundError)
+		}
+	}
+
+	status, err := core.initialStatus(ctx, userId, variables.PermissionCommentModerate)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := core.postsRepository.AddComment(ctx, post, &user, data, parentID, status)
 	if err != nil {
 		return nil, fmt.Errorf(fmt.Sprintf("Comments Not Founded %v", err))
 	}
+
+	if status != model.ModerationStatusApproved {
+		return comment, nil
+	}
+
+	err = core.commentsBroker.Publish(ctx, postID, comment)
+	if err != nil {
+		core.logger.Error("publish comment error:", "error", err.Error())
+	}
 	return comment, nil
 }
 
+func (core *Core) getPost(ctx context.Context, id int) (*model.Post, error) {
+	post, err := core.postsRepository.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf(variables.PostNotFoundError+": %w", err)
+	}
+
+	if post == nil {
+		return nil, fmt.Errorf(variables.PostNotFoundError)
+	}
+
+	return post, nil
+}
+
+// getApprovedPost hides posts awaiting or failed moderation from everything
+// but their author's edits.
+func (core *Core) getApprovedPost(ctx context.Context, id int) (*model.Post, error) {
+	post, err := core.getPost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.ModerationStatus != model.ModerationStatusApproved {
+		return nil, fmt.Errorf(variables.PostNotFoundError)
+	}
+
+	return post, nil
+}
+
+func (core *Core) getComment(ctx context.Context, id int) (*model.Comment, error) {
+	comment, err := core.postsRepository.GetCommentByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf(variables.CommentNotFoundError+": %w", err)
+	}
+
+	if comment == nil {
+		return nil, fmt.Errorf(variables.CommentNotFoundError)
+	}
+
+	return comment, nil
+}
+
+// canModify tells whether the user may change content of the author.
+// Authors still need the permission to create such content, which a ban
+// takes away, others need the permission for any content.
+func (core *Core) canModify(ctx context.Context, userId int, author *model.User, ownPermission string, anyPermission string) (bool, error) {
+	permissions, err := core.GetUserPermissions(ctx, int64(userId))
+	if err != nil {
+		return false, err
+	}
+
+	if author != nil && author.ID == strconv.Itoa(userId) && permissions[ownPermission] {
+		return true, nil
+	}
+	return permissions[anyPermission], nil
+}
+
+// requirePermission fails with Forbidden without the permission.
+func (core *Core) requirePermission(ctx context.Context, userId int, permission string) error {
+	permitted, err := core.HasPermission(ctx, int64(userId), permission)
+	if err != nil {
+		return err
+	}
+
+	if !permitted {
+		return fmt.Errorf(variables.StatusForbiddenError)
+	}
+	return nil
+}
+
+func (core *Core) UpdatePost(ctx context.Context, postID int, userId int, data string) (*model.Post, error) {
+	post, err := core.getPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	permitted, err := core.canModify(ctx, userId, post.Author, variables.PermissionPostCreate, variables.PermissionPostUpdateAny)
+	if err != nil {
+		return nil, err
+	}
+
+	if !permitted {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return core.postsRepository.UpdatePost(ctx, postID, data)
+}
+
+func (core *Core) DeletePost(ctx context.Context, postID int, userId int) error {
+	post, err := core.getPost(ctx, postID)
+	if err != nil {
+		return err
+	}
+
+	permitted, err := core.canModify(ctx, userId, post.Author, variables.PermissionPostCreate, variables.PermissionPostDeleteAny)
+	if err != nil {
+		return err
+	}
+
+	if !permitted {
+		return fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return core.postsRepository.DeletePost(ctx, postID)
+}
+
+func (core *Core) SetPostCommentsEnabled(ctx context.Context, postID int, userId int, enabled bool) (*model.Post, error) {
+	post, err := core.getPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	permitted, err := core.canModify(ctx, userId, post.Author, variables.PermissionPostCreate, variables.PermissionPostUpdateAny)
+	if err != nil {
+		return nil, err
+	}
+
+	if !permitted {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return core.postsRepository.SetCommentsAllowed(ctx, postID, enabled, &model.User{ID: strconv.Itoa(userId)})
+}
+
+func (core *Core) UpdateComment(ctx context.Context, commentID int, userId int, data string) (*model.Comment, error) {
+	comment, err := core.getComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.IsDeleted {
+		return nil, fmt.Errorf(variables.CommentDeletedError)
+	}
+
+	permitted, err := core.canModify(ctx, userId, comment.Author, variables.PermissionCommentCreate, variables.PermissionCommentUpdateAny)
+	if err != nil {
+		return nil, err
+	}
+
+	if !permitted {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return core.postsRepository.UpdateComment(ctx, commentID, data)
+}
+
+// DeleteComment turns the comment into a tombstone, so its replies stay
+// attached to the tree.
+func (core *Core) DeleteComment(ctx context.Context, commentID int, userId int) (*model.Comment, error) {
+	comment, err := core.getComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.IsDeleted {
+		return comment, nil
+	}
+
+	permitted, err := core.canModify(ctx, userId, comment.Author, variables.PermissionCommentCreate, variables.PermissionCommentDeleteAny)
+	if err != nil {
+		return nil, err
+	}
+
+	if !permitted {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	return core.postsRepository.DeleteComment(ctx, commentID)
+}
+
+func (core *Core) SearchPosts(ctx context.Context, query string, first int, after string) (*model.PostSearchConnection, error) {
+	if len(util.Tokenize(query)) == 0 {
+		return nil, fmt.Errorf(variables.EmptySearchQuery)
+	}
+
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	edges, hasNextPage, err := core.postsRepository.SearchPosts(ctx, query, first, cursor)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
+	}
+
+	return model.NewPostSearchConnection(edges, hasNextPage)
+}
+
+func (core *Core) SearchComments(ctx context.Context, postID int, query string) ([]*model.CommentSearchResult, error) {
+	if len(util.Tokenize(query)) == 0 {
+		return nil, fmt.Errorf(variables.EmptySearchQuery)
+	}
+
+	_, err := core.getApprovedPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := core.postsRepository.SearchComments(ctx, postID, query, variables.MaxPageSize)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Comments Not Founded %v", err))
+	}
+
+	return results, nil
+}
+
+// checkReactionTarget makes sure the target exists, is approved and still
+// takes reactions.
+func (core *Core) checkReactionTarget(ctx context.Context, target model.ReactionTarget, targetID int) error {
+	switch target {
+	case model.ReactionTargetPost:
+		_, err := core.getApprovedPost(ctx, targetID)
+		return err
+	case model.ReactionTargetComment:
+		comment, err := core.getComment(ctx, targetID)
+		if err != nil {
+			return err
+		}
+
+		if comment.IsDeleted {
+			return fmt.Errorf(variables.CommentDeletedError)
+		}
+
+		if comment.ModerationStatus != model.ModerationStatusApproved {
+			return fmt.Errorf(variables.CommentNotFoundError)
+		}
+		return nil
+	}
+
+	return fmt.Errorf(variables.InvalidReactionTarget)
+}
+
+func (core *Core) AddReaction(ctx context.Context, userId int, targetID int, target model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error) {
+	err := core.requirePermission(ctx, userId, variables.PermissionReactionCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = core.checkReactionTarget(ctx, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := core.postsRepository.AddReaction(ctx, target, targetID, userId, kind)
+	if err != nil {
+		return nil, fmt.Errorf(variables.ReactionError+": %w", err)
+	}
+
+	return model.NewReactionCounts(counts), nil
+}
+
+func (core *Core) RemoveReaction(ctx context.Context, userId int, targetID int, target model.ReactionTarget, kind model.ReactionKind) ([]*model.ReactionCount, error) {
+	err := core.requirePermission(ctx, userId, variables.PermissionReactionCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = core.checkReactionTarget(ctx, target, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := core.postsRepository.RemoveReaction(ctx, target, targetID, userId, kind)
+	if err != nil {
+		return nil, fmt.Errorf(variables.ReactionError+": %w", err)
+	}
+
+	return model.NewReactionCounts(counts), nil
+}
+
+func (core *Core) GetReactionCounts(ctx context.Context, target model.ReactionTarget, ids []int) (map[int][]*model.ReactionCount, error) {
+	counts, err := core.postsRepository.GetReactionCounts(ctx, target, ids)
+	if err != nil {
+		return nil, fmt.Errorf(variables.ReactionError+": %w", err)
+	}
+
+	reactionCounts := make(map[int][]*model.ReactionCount, len(ids))
+	for _, id := range ids {
+		reactionCounts[id] = model.NewReactionCounts(counts[id])
+	}
+	return reactionCounts, nil
+}
+
+func (core *Core) GetViewerReactions(ctx context.Context, target model.ReactionTarget, ids []int, userId int) (map[int][]model.ReactionKind, error) {
+	reactions, err := core.postsRepository.GetUserReactions(ctx, target, ids, userId)
+	if err != nil {
+		return nil, fmt.Errorf(variables.ReactionError+": %w", err)
+	}
+
+	for _, id := range ids {
+		if reactions[id] == nil {
+			reactions[id] = []model.ReactionKind{}
+		}
+	}
+	return reactions, nil
+}
+
+// ReportContent puts approved content on the moderation queue, every user
+// reports a target once and a repeated report replaces the reason.
+func (core *Core) ReportContent(ctx context.Context, userId int, targetID int, target model.ReactionTarget, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf(variables.EmptyReportReason)
+	}
+
+	err := core.requirePermission(ctx, userId, variables.PermissionContentReport)
+	if err != nil {
+		return err
+	}
+
+	err = core.checkReactionTarget(ctx, target, targetID)
+	if err != nil {
+		return err
+	}
+
+	err = core.postsRepository.AddReport(ctx, target, targetID, userId, reason)
+	if err != nil {
+		return fmt.Errorf(variables.ReportError+": %w", err)
+	}
+	return nil
+}
+
+// moderatePermission is the permission to moderate targets of the type.
+func moderatePermission(target model.ReactionTarget) string {
+	if target == model.ReactionTargetComment {
+		return variables.PermissionCommentModerate
+	}
+	return variables.PermissionPostModerate
+}
+
+// ModerateContent approves or rejects the target and takes it off the
+// moderation queue. Rejected content stays rejected, a comment approved
+// late reaches the subscribers of its post only now.
+func (core *Core) ModerateContent(ctx context.Context, userId int, targetID int, target model.ReactionTarget, status model.ModerationStatus) (model.ModerationStatus, error) {
+	if status != model.ModerationStatusApproved && status != model.ModerationStatusRejected {
+		return "", fmt.Errorf(variables.InvalidModerationStatus)
+	}
+
+	if !target.IsValid() {
+		return "", fmt.Errorf(variables.InvalidReactionTarget)
+	}
+
+	permitted, err := core.HasPermission(ctx, int64(userId), moderatePermission(target))
+	if err != nil {
+		return "", err
+	}
+
+	if !permitted {
+		return "", fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	var current model.ModerationStatus
+	var comment *model.Comment
+	if target == model.ReactionTargetPost {
+		post, err := core.getPost(ctx, targetID)
+		if err != nil {
+			return "", err
+		}
+		current = post.ModerationStatus
+	} else {
+		comment, err = core.getComment(ctx, targetID)
+		if err != nil {
+			return "", err
+		}
+
+		if comment.IsDeleted {
+			return "", fmt.Errorf(variables.CommentDeletedError)
+		}
+		current = comment.ModerationStatus
+	}
+
+	if current == model.ModerationStatusRejected {
+		return "", fmt.Errorf(variables.ContentRejectedError)
+	}
+
+	err = core.postsRepository.SetModerationStatus(ctx, target, targetID, status)
+	if err != nil {
+		return "", fmt.Errorf(variables.ModerationError+": %w", err)
+	}
+
+	if comment != nil && current != model.ModerationStatusApproved && status == model.ModerationStatusApproved {
+		comment.ModerationStatus = status
+		postID, err := strconv.Atoi(comment.Post.ID)
+		if err == nil {
+			err = core.commentsBroker.Publish(ctx, postID, comment)
+		}
+		if err != nil {
+			core.logger.Error("publish comment error:", "error", err.Error())
+		}
+	}
+
+	return status, nil
+}
+
+// GetModerationQueue lists the queued targets the user may moderate, oldest
+// first.
+func (core *Core) GetModerationQueue(ctx context.Context, userId int, first int, after string) (*model.ModerationConnection, error) {
+	permissions, err := core.GetUserPermissions(ctx, int64(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []model.ReactionTarget
+	for _, target := range model.AllReactionTarget {
+		if permissions[moderatePermission(target)] {
+			targets = append(targets, target)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf(variables.StatusForbiddenError)
+	}
+
+	cursor, err := util.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	items, hasNextPage, err := core.postsRepository.GetModerationQueue(ctx, targets, first, cursor)
+	if err != nil {
+		return nil, fmt.Errorf(variables.ModerationError+": %w", err)
+	}
+
+	return model.NewModerationConnection(items, hasNextPage)
+}
+
+func (core *Core) SubscribeComments(ctx context.Context, postID int) (<-chan *model.Comment, error) {
+	post, err := core.postsRepository.GetPostByID(ctx, postID)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Posts Not Founded %v", err))
+	}
+
+	if post == nil || post.ModerationStatus != model.ModerationStatusApproved {
+		return nil, fmt.Errorf("Posts Not Founded")
+	}
+
+	return core.commentsBroker.Subscribe(ctx, postID), nil
+}
+
 func (core *Core) GetUserRole(ctx context.Context, id int64) (string, error) {
 	grpcRequest := authorization.RoleRequest{Id: id}
 
@@ -127,13 +838,141 @@ func (core *Core) GetUserRole(ctx context.Context, id int64) (string, error) {
 	return grpcResponse.GetRole(), nil
 }
 
-func (core *Core) GetUserId(ctx context.Context, sid string) (int64, error) {
+// GetUserPermissions returns the permissions of the user, cached for
+// PermissionsCacheTTL.
+func (core *Core) GetUserPermissions(ctx context.Context, id int64) (map[string]bool, error) {
+	now := time.Now()
+
+	core.permissionsMutex.Lock()
+	cached, found := core.permissions[id]
+	core.permissionsMutex.Unlock()
+	if found && now.Before(cached.expiresAt) {
+		return cached.permissions, nil
+	}
+
+	grpcResponse, err := core.client.GetPermissions(ctx, &authorization.PermissionsRequest{Id: id})
+	if err != nil {
+		core.logger.Error(variables.GrpcRecievError, "error", err.Error())
+		return nil, fmt.Errorf(variables.GrpcRecievError+": %w", err)
+	}
+
+	permissions := make(map[string]bool, len(grpcResponse.GetPermissions()))
+	for _, permission := range grpcResponse.GetPermissions() {
+		permissions[permission] = true
+	}
+
+	core.permissionsMutex.Lock()
+	defer core.permissionsMutex.Unlock()
+	for userId, entry := range core.permissions {
+		if now.After(entry.expiresAt) {
+			delete(core.permissions, userId)
+		}
+	}
+	core.permissions[id] = cachedPermissions{permissions: permissions, expiresAt: now.Add(variables.PermissionsCacheTTL)}
+
+	return permissions, nil
+}
+
+func (core *Core) HasPermission(ctx context.Context, id int64, permission string) (bool, error) {
+	permissions, err := core.GetUserPermissions(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions[permission], nil
+}
+
+// GetUserId returns the owner of the session, and the session itself when
+// the authorization service has rotated its id.
+func (core *Core) GetUserId(ctx context.Context, sid string) (int64, *models.Session, error) {
 	grpcRequest := authorization.FindIdRequest{Sid: sid}
 
 	grpcResponse, err := core.client.GetId(ctx, &grpcRequest)
 	if err != nil {
-		core.logger.Error(variables.GrpcRecievError, err)
-		return 0, fmt.Errorf(variables.GrpcRecievError, err)
+		core.logger.Error(variables.GrpcRecievError, "error", err.Error())
+		return 0, nil, fmt.Errorf(variables.GrpcRecievError+": %w", err)
+	}
+
+	if grpcResponse.GetSid() == "" {
+		return grpcResponse.GetValue(), nil, nil
+	}
+
+	rotated := &models.Session{
+		SID:       grpcResponse.GetSid(),
+		ExpiresAt: time.Unix(grpcResponse.GetExpiresAt(), 0),
+	}
+	return grpcResponse.GetValue(), rotated, nil
+}
+
+// CheckRateLimit records a request of the ip and the user in the scope and
+// returns how long the client has to wait, zero while it is within limits.
+func (core *Core) CheckRateLimit(ctx context.Context, scope string, ip string, userId int64) (time.Duration, error) {
+	if core.limiter == nil {
+		return 0, nil
+	}
+
+	return core.limiter.Allow(ctx, scope, ip, userId)
+}
+
+// GetTokenUserId checks the access token with the shared key, so bearer
+// requests cost no call to the authorization service.
+func (core *Core) GetTokenUserId(ctx context.Context, token string) (int64, error) {
+	return core.tokens.Verify(token)
+}
+
+func (core *Core) GetUsersByIds(ctx context.Context, ids []int64) (map[int64]string, error) {
+	grpcRequest := authorization.UsersRequest{Ids: ids}
+
+	grpcResponse, err := core.client.GetUsersByIds(ctx, &grpcRequest)
+	if err != nil {
+		core.logger.Error(variables.GrpcRecievError, "error", err.Error())
+		return nil, fmt.Errorf(variables.GrpcRecievError+": %w", err)
+	}
+
+	logins := make(map[int64]string, len(grpcResponse.GetUsers()))
+	for _, user := range grpcResponse.GetUsers() {
+		logins[user.GetId()] = user.GetLogin()
+	}
+	return logins, nil
+}
+
+// BanUser bans the user until the RFC 3339 time, for good without it.
+// bannedBy goes along as the acting user of the call.
+func (core *Core) BanUser(ctx context.Context, userId int64, until string, reason string, bannedBy int64) (*model.Ban, error) {
+	grpcRequest := authorization.BanRequest{Id: userId, Reason: reason}
+	if until != "" {
+		untilTime, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf(variables.InvalidUntilError)
+		}
+		grpcRequest.Until = untilTime.Unix()
 	}
-	return grpcResponse.Value, nil
+
+	grpcResponse, err := core.client.BanUser(serviceauth.WithActingUser(ctx, bannedBy), &grpcRequest)
+	if err != nil {
+		core.logger.Error(variables.GrpcRecievError, "error", err.Error())
+		return nil, fmt.Errorf("%s", status.Convert(err).Message())
+	}
+
+	ban := &model.Ban{
+		UserID:    strconv.FormatInt(grpcResponse.GetUserId(), 10),
+		Reason:    grpcResponse.GetReason(),
+		CreatedAt: time.Unix(grpcResponse.GetCreatedAt(), 0).UTC().Format(time.RFC3339),
+	}
+	if grpcResponse.GetUntil() != 0 {
+		banUntil := time.Unix(grpcResponse.GetUntil(), 0).UTC().Format(time.RFC3339)
+		ban.Until = &banUntil
+	}
+	return ban, nil
+}
+
+// UnbanUser lifts the ban of the user, false if there was none.
+func (core *Core) UnbanUser(ctx context.Context, userId int64) (bool, error) {
+	grpcResponse, err := core.client.UnbanUser(ctx, &authorization.UserRequest{Id: userId})
+	if err != nil {
+		core.logger.Error(variables.GrpcRecievError, "error", err.Error())
+		return false, fmt.Errorf("%s", status.Convert(err).Message())
+	}
+
+	return grpcResponse.GetUnbanned(), nil
 }